@@ -2,12 +2,10 @@ package adapter
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
-	"math"
-	"net/http"
+	"maps"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -25,73 +23,80 @@ func Create[T service.Creatable](ctx context.Context, request events.APIGatewayV
 	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
 }
 
-func Retrieve[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.RetrieveSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
-	return RetrieveAndTransform(ctx, request, sql, idParam, func(t T) (T, error) { return t, nil })
+func Retrieve[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.RetrieveSQL[T], versionSQL service.VersionSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
+	return RetrieveAndTransform(ctx, request, sql, versionSQL, idParam, func(t T) (T, error) { return t, nil })
 }
 
-func RetrieveAndTransform[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.RetrieveSQL[T], idParam string, transformer func(t T) (T, error)) events.APIGatewayV2HTTPResponse {
-	status, body := service.Retrieve(ctx, sql, request.PathParameters[idParam], transformer)
-	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
+func RetrieveAndTransform[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.RetrieveSQL[T], versionSQL service.VersionSQL[T], idParam string, transformer func(t T) (T, error)) events.APIGatewayV2HTTPResponse {
+	status, body, etag := service.RetrieveConditional(ctx, sql, versionSQL, request.PathParameters[idParam], request.Headers["if-none-match"], transformer)
+	return ETagResponse(status, body, etag)
 }
 
-func Update[K any, T service.Updatable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.UpdateSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
-	return UpdateAndFinalize(ctx, request, sql, idParam, func(id K, t T) error { return nil })
+func Update[K any, T service.Updatable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.UpdateSQL[T], versionSQL service.VersionSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
+	return UpdateAndFinalize(ctx, request, sql, versionSQL, idParam, func(id K, t T) error { return nil })
 }
 
-func UpdateAndFinalize[K any, T service.Updatable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.UpdateSQL[T], idParam string, finalizer func(id K, t T) error) events.APIGatewayV2HTTPResponse {
-	status, body := service.Update(ctx, sql, request.PathParameters[idParam], []byte(request.Body), finalizer)
-	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
+func UpdateAndFinalize[K any, T service.Updatable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.UpdateSQL[T], versionSQL service.VersionSQL[T], idParam string, finalizer func(id K, t T) error) events.APIGatewayV2HTTPResponse {
+	status, body, etag := service.UpdateConditional(ctx, sql, versionSQL, request.PathParameters[idParam], []byte(request.Body), request.Headers["if-match"], finalizer)
+	return ETagResponse(status, body, etag)
 }
 
-func Delete[K any, T service.Identifiable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.DeleteSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
-	return DeleteAndFinalize(ctx, request, sql, idParam, func(id K) error { return nil })
+func Patch[K any, T service.Patchable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, retrieveSQL service.RetrieveSQL[T], updateSQL service.UpdateSQL[T], versionSQL service.VersionSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
+	return PatchAndFinalize(ctx, request, retrieveSQL, updateSQL, versionSQL, idParam, func(t T) (T, error) { return t, nil }, func(id K, t T) error { return nil })
 }
 
-func DeleteAndFinalize[K any, T service.Identifiable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.DeleteSQL[T], idParam string, finalizer func(id K) error) events.APIGatewayV2HTTPResponse {
-	status, body := service.Delete(ctx, sql, request.PathParameters[idParam], finalizer)
+func PatchAndFinalize[K any, T service.Patchable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, retrieveSQL service.RetrieveSQL[T], updateSQL service.UpdateSQL[T], versionSQL service.VersionSQL[T], idParam string, transformer func(t T) (T, error), finalizer func(id K, t T) error) events.APIGatewayV2HTTPResponse {
+	status, body, etag := service.PatchConditional(ctx, retrieveSQL, updateSQL, versionSQL, request.PathParameters[idParam], []byte(request.Body), request.Headers["if-match"], transformer, finalizer)
+	return ETagResponse(status, body, etag)
+}
+
+func Delete[K any, T service.Identifiable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.DeleteSQL[T], versionSQL service.VersionSQL[T], idParam string) events.APIGatewayV2HTTPResponse {
+	return DeleteAndFinalize(ctx, request, sql, versionSQL, idParam, func(id K) error { return nil })
+}
+
+func DeleteAndFinalize[K any, T service.Identifiable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, sql service.DeleteSQL[T], versionSQL service.VersionSQL[T], idParam string, finalizer func(id K) error) events.APIGatewayV2HTTPResponse {
+	status, body := service.DeleteConditional(ctx, sql, versionSQL, request.PathParameters[idParam], request.Headers["if-match"], finalizer)
 	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
 }
 
+// ETagResponse is the response with the ETag of the entity, if any (see service.VersionSQL), that the browser lets the UI read.
+func ETagResponse(status int, body string, etag string) events.APIGatewayV2HTTPResponse {
+	if etag == "" {
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
+	}
+	headers := maps.Clone(StandardHeaders)
+	headers[service.ETagHeader] = etag
+	headers["Access-Control-Expose-Headers"] = service.ETagHeader
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: headers}
+}
+
 func List[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, listSQL service.ListSQL[T]) events.APIGatewayV2HTTPResponse {
 	return ListAndTransform(ctx, request, listSQL, func(t T) (T, error) { return t, nil })
 }
 
 func ListAndTransform[K any, T service.Retrievable[K]](ctx context.Context, request events.APIGatewayV2HTTPRequest, listSQL service.ListSQL[T], transformer func(t T) (T, error)) events.APIGatewayV2HTTPResponse {
-	params := request.QueryStringParameters
-	offset, err := parseQueryInt(params, "offset", 0)
-	if err != nil {
-		return badRequestResponse(err)
-	}
-	limit, err := parseQueryInt(params, "limit", math.MaxInt32)
-	if err != nil {
-		return badRequestResponse(err)
-	}
 	userID := service.ToUUID(request.RequestContext.Authorizer.JWT.Claims["sub"])
-	status, body := service.List(ctx, listSQL, userID, offset, limit, transformer)
+	status, body := service.List(ctx, listSQL, userID, request.QueryStringParameters, transformer)
 	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: StandardHeaders}
 }
 
-func parseQueryInt(params map[string]string, key string, defaultValue int) (int, error) {
-	valStr, ok := params[key]
-	if !ok || valStr == "" {
-		return defaultValue, nil
-	}
-	val, err := strconv.Atoi(valStr)
-	if err != nil {
-		return 0, fmt.Errorf("failed to invalid value for %q: %q is not an integer", key, valStr)
-	}
-	return val, nil
-}
-
-func badRequestResponse(err error) events.APIGatewayV2HTTPResponse {
-	slog.Warn("BadRequest:", "error", err)
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusBadRequest,
-		Body:       err.Error(),
+// AuthorizedUser returns the subject and the Cognito groups of the token verified by the JWT authorizer of the route.
+// HTTP APIs pass array claims as strings like "[admin users]".
+func AuthorizedUser(request events.APIGatewayV2HTTPRequest) (string, []string) {
+	authorizer := request.RequestContext.Authorizer
+	if authorizer == nil || authorizer.JWT == nil {
+		return "", nil
 	}
+	claims := authorizer.JWT.Claims
+	return claims["sub"], strings.Fields(strings.Trim(claims["cognito:groups"], "[]"))
 }
 
 func LambdaMain(handler interface{}) {
+	// short links, QR codes and previews are built from it; the localhost default only suits local runs
+	if os.Getenv("SHORT_URL_BASE") == "" {
+		slog.Error("SHORT_URL_BASE is not set")
+		os.Exit(1)
+	}
 	ctx := context.Background()
 	if err := db.InitFromEnvironment(ctx); err != nil {
 		slog.Error("Failed to connect to database", "error", err)
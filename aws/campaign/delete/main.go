@@ -10,7 +10,7 @@ import (
 )
 
 func deleteCampaign(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Delete(ctx, request, campaign.DeleteSQL, service.IdParam), nil
+	return adapter.Delete(ctx, request, campaign.DeleteSQL, campaign.VersionSQL, service.IdParam), nil
 }
 
 func main() {
@@ -10,7 +10,7 @@ import (
 )
 
 func retrieveCampaign(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
-	return adapter.Retrieve(ctx, request, campaign.RetrieveSQL, service.IdParam)
+	return adapter.Retrieve(ctx, request, campaign.RetrieveSQL, campaign.VersionSQL, service.IdParam)
 }
 
 func main() {
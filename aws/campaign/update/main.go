@@ -10,7 +10,7 @@ import (
 )
 
 func updateCampaign(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Update(ctx, request, campaign.UpdateSQL, service.IdParam), nil
+	return adapter.Update(ctx, request, campaign.UpdateSQL, campaign.VersionSQL, service.IdParam), nil
 }
 
 func main() {
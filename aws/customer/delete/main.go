@@ -10,7 +10,7 @@ import (
 )
 
 func deleteCustomer(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Delete(ctx, request, customer.DeleteSQL, service.IdParam), nil
+	return adapter.Delete(ctx, request, customer.DeleteSQL, customer.VersionSQL, service.IdParam), nil
 }
 
 func main() {
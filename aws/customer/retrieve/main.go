@@ -10,7 +10,7 @@ import (
 )
 
 func retrieveCustomer(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
-	return adapter.Retrieve(ctx, request, customer.RetrieveSQL, service.IdParam)
+	return adapter.Retrieve(ctx, request, customer.RetrieveSQL, customer.VersionSQL, service.IdParam)
 }
 
 func main() {
@@ -10,7 +10,7 @@ import (
 )
 
 func updateCustomer(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Update(ctx, request, customer.UpdateSQL, service.IdParam), nil
+	return adapter.Update(ctx, request, customer.UpdateSQL, customer.VersionSQL, service.IdParam), nil
 
 }
 
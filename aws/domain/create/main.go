@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+func createDomain(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	userID := service.ToUUID(request.RequestContext.Authorizer.JWT.Claims["sub"])
+	status, body := domain.Create(ctx, []byte(request.Body), userID)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	adapter.LambdaMain(createDomain)
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+func listDomains(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return adapter.List(ctx, request, domain.ListSQL), nil
+}
+
+func main() {
+	adapter.LambdaMain(listDomains)
+}
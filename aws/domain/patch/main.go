@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+func patchDomain(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	userID := service.ToUUID(request.RequestContext.Authorizer.JWT.Claims["sub"])
+	status, body, etag := domain.Patch(ctx, request.PathParameters[service.IdParam], []byte(request.Body), userID, request.Headers["if-match"])
+	return adapter.ETagResponse(status, body, etag), nil
+}
+
+func main() {
+	adapter.LambdaMain(patchDomain)
+}
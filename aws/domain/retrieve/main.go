@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+func retrieveDomain(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	return adapter.Retrieve(ctx, request, domain.RetrieveSQL, domain.VersionSQL, service.IdParam)
+}
+
+func main() {
+	adapter.LambdaMain(retrieveDomain)
+}
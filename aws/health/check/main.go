@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service/health"
+)
+
+var (
+	config  *health.Config
+	checker *health.Checker
+)
+
+// checkHealth is invoked on schedule and checks one batch of the links that are due.
+func checkHealth(ctx context.Context) error {
+	checked, err := health.CheckDue(ctx, config, checker)
+	if err != nil {
+		return err
+	}
+	slog.Info("Checked link health", "checked", checked)
+	return nil
+}
+
+func main() {
+	var err error
+	if config, err = health.ConfigFromEnvironment(); err != nil {
+		slog.Error("Failed to configure link health checks", "error", err)
+		os.Exit(1)
+	}
+	checker = health.NewChecker(config)
+	adapter.LambdaMain(checkHealth)
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func deleteLandingPage(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.DeleteAndFinalize(ctx, request, landingpage.DeleteSQL, service.IdParam, func(id uuid.UUID) error {
+	return adapter.DeleteAndFinalize(ctx, request, landingpage.DeleteSQL, landingpage.VersionSQL, service.IdParam, func(id uuid.UUID) error {
 		return landingpage.DeleteConfiguration(ctx, id)
 	}), nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gofrs/uuid"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/aws/s3client"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/landingpage"
+)
+
+func patchLandingPage(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return adapter.PatchAndFinalize(ctx, request, landingpage.RetrieveSQL, landingpage.UpdateSQL, landingpage.VersionSQL, service.IdParam,
+		func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
+			return landingpage.SetConfiguration(ctx, p)
+		},
+		func(id uuid.UUID, p *landingpage.LandingPage) error {
+			return landingpage.StroreConfiguration(ctx, p)
+		}), nil
+}
+
+func main() {
+	s3client.InitializeFromEnvironment(context.Background())
+	adapter.LambdaMain(patchLandingPage)
+}
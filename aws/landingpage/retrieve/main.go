@@ -11,7 +11,7 @@ import (
 )
 
 func retrieveLandingPage(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.RetrieveAndTransform(ctx, request, landingpage.RetrieveSQL, service.IdParam, func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
+	return adapter.RetrieveAndTransform(ctx, request, landingpage.RetrieveSQL, landingpage.VersionSQL, service.IdParam, func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
 		return landingpage.SetConfiguration(ctx, p)
 	}), nil
 }
@@ -12,7 +12,7 @@ import (
 )
 
 func updateOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.UpdateAndFinalize(ctx, request, landingpage.UpdateSQL, service.IdParam, func(id uuid.UUID, p *landingpage.LandingPage) error {
+	return adapter.UpdateAndFinalize(ctx, request, landingpage.UpdateSQL, landingpage.VersionSQL, service.IdParam, func(id uuid.UUID, p *landingpage.LandingPage) error {
 		_, err := landingpage.SetConfiguration(ctx, p)
 		return err
 	}), nil
@@ -10,7 +10,7 @@ import (
 )
 
 func deleteOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Delete(ctx, request, organization.DeleteSQL, service.IdParam), nil
+	return adapter.Delete(ctx, request, organization.DeleteSQL, organization.VersionSQL, service.IdParam), nil
 }
 
 func main() {
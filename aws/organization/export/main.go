@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/aws/s3client"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/archive"
+)
+
+func exportOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	userID := service.GetUUIDFromAuthorization(request.Headers["authorization"])
+	status, organizationID, err := archive.CanExport(ctx, userID, request.PathParameters[service.IdParam])
+	if err != nil {
+		status, body := service.Marshal(status, &organizationID, err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := archive.Export(ctx, organizationID, &buf); err != nil {
+		status, body := service.Marshal(http.StatusInternalServerError, &organizationID, err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+	}
+
+	headers := maps.Clone(adapter.StandardHeaders)
+	headers["Content-Type"] = archive.ContentType
+	headers["Content-Disposition"] = fmt.Sprintf(`attachment; filename="%s"`, archive.ArchiveName(organizationID, time.Now()))
+	return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Body: base64.StdEncoding.EncodeToString(buf.Bytes()), IsBase64Encoded: true, Headers: headers}, nil
+}
+
+func main() {
+	s3client.InitializeFromEnvironment(context.Background())
+	adapter.LambdaMain(exportOrganization)
+}
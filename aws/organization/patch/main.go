@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/organization"
+)
+
+func patchOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return adapter.Patch(ctx, request, organization.RetrieveSQL, organization.UpdateSQL, organization.VersionSQL, service.IdParam), nil
+}
+
+func main() {
+	adapter.LambdaMain(patchOrganization)
+}
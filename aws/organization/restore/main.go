@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/aws/s3client"
+	"github.com/lnk.by/shared/auth"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/archive"
+)
+
+func restoreOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	claims, err := auth.VerifyBearer(ctx, request.Headers["authorization"])
+	if err != nil {
+		status, body := service.Marshal(http.StatusUnauthorized, &archive.RestoreReport{}, fmt.Errorf("authentication is required to restore data: %w", err))
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+	}
+	sub, _ := claims["sub"].(string)
+
+	requestBody := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			status, body := service.Marshal(http.StatusBadRequest, &archive.RestoreReport{}, fmt.Errorf("failed to decode request body: %w", err))
+			return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+		}
+		requestBody = decoded
+	}
+
+	status, body := service.Marshal(archive.Restore(ctx, strings.NewReader(string(requestBody)), archive.CanRestore(sub, auth.Groups(claims))))
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	s3client.InitializeFromEnvironment(context.Background())
+	adapter.LambdaMain(restoreOrganization)
+}
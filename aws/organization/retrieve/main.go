@@ -10,7 +10,7 @@ import (
 )
 
 func retrieveOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
-	return adapter.Retrieve(ctx, request, organization.RetrieveSQL, service.IdParam)
+	return adapter.Retrieve(ctx, request, organization.RetrieveSQL, organization.VersionSQL, service.IdParam)
 }
 
 func main() {
@@ -10,7 +10,7 @@ import (
 )
 
 func updateOrganization(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Update(ctx, request, organization.UpdateSQL, service.IdParam), nil
+	return adapter.Update(ctx, request, organization.UpdateSQL, organization.VersionSQL, service.IdParam), nil
 }
 
 func main() {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"strconv"
 	"time"
 
@@ -32,17 +33,46 @@ func init() {
 }
 
 func redirect(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	key := req.PathParameters[service.IdParam]
-	slog.Info("Handling redirect", "RawPath", req.RawPath, "param[key]", key)
+	slog.Info("Handling redirect", "RawPath", req.RawPath, "param[key]", req.PathParameters[service.IdParam])
+	incoming, err := neturl.ParseQuery(req.RawQueryString)
+	if err != nil {
+		slog.Warn("Failed to parse query string", "query", req.RawQueryString, "error", err)
+	}
+
+	key, preview := shorturl.IsPreview(req.PathParameters[service.IdParam], incoming)
+	status, resolution, err := shorturl.Resolve(ctx, req.RequestContext.DomainName, key)
+	if err != nil {
+		status, body := service.Marshal(status, resolution, err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: map[string]string{"Content-Type": shorturl.ContentTypeJSON}}, nil
+	}
+	if resolution.Key == "" {
+		return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusFound, Headers: map[string]string{"Location": resolution.Fallback}}, nil
+	}
+	key = resolution.Key
 
-	now := time.Now()
-	day := fmt.Sprintf("day%03d", now.YearDay())
-	hour := fmt.Sprintf("hour%02d", now.Hour())
+	if preview {
+		status, contentType, body := shorturl.PreviewResponse(ctx, key, resolution.DomainID, incoming, req.Headers["accept"])
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: map[string]string{"Content-Type": contentType}}, nil
+	}
 
-	status, url, errStr := service.RetrieveValueAndMarshalError(ctx, shorturl.RetrieveValidSQL, key, day, hour)
+	status, url, errStr := shorturl.RetrieveValid(ctx, resolution, time.Now())
 	if errStr != "" {
 		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: errStr}, nil
 	}
+	if status, headers, body, suspended := url.WarningResponse(ctx); suspended {
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Headers: headers, Body: string(body)}, nil
+	}
+
+	target := url.RedirectTarget(incoming)
+	// crawlers that build link previews get the metadata of the link; they are neither limited nor counted as clicks
+	if url.OpenGraph != nil && shorturl.IsSocialCrawler(req.Headers["user-agent"]) {
+		page, err := url.OpenGraphPage(target)
+		if err == nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusOK, Headers: map[string]string{"Content-Type": shorturl.ContentTypeHTML}, Body: string(page)}, nil
+		}
+		slog.Warn("Failed to render metadata", "key", key, "error", err)
+	}
+
 	if limitExceeded, retryAfter := shorturl.GetLimitExceededMessage(url); limitExceeded != "" {
 		headers := map[string]string{"Content-Type": "application/json"}
 		if retryAfter > 0 {
@@ -56,17 +86,12 @@ func redirect(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.A
 		}, nil
 	}
 
-	if err := sendStatistics(ctx, key, req); err != nil {
+	if err := sendStatistics(ctx, url.Key, req); err != nil {
 		slog.Warn("Failed to send stats", "error", err)
 	}
 
-	return events.APIGatewayV2HTTPResponse{
-		StatusCode: http.StatusMovedPermanently, // TODO: in future we can return 302 if the URL TTL is short or 307 or  308 if we will support methods other then GET
-		Headers: map[string]string{
-			"Location":      url.Target,
-			"Cache-Control": "no-store, no-cache, must-revalidate, max-age=0",
-		},
-	}, nil
+	status, headers, body := url.RedirectResponse(target)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Headers: headers, Body: string(body)}, nil
 }
 
 func mustJSON(v any) []byte {
@@ -85,6 +110,7 @@ func sendStatistics(ctx context.Context, key string, req events.APIGatewayV2HTTP
 		Referer:   req.Headers["referer"],
 		Timestamp: time.Now().UTC(),
 		Language:  req.Headers["accept-language"],
+		Source:    req.QueryStringParameters[shorturl.SourceParam],
 	}
 
 	payload, err := json.Marshal(event)
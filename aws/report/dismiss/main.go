@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/moderation"
+)
+
+func dismissReport(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	status, moderatorID, err := moderation.Moderator(adapter.AuthorizedUser(request))
+	if err != nil {
+		status, body := service.Marshal(status, moderatorID, err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+	}
+	status, body := moderation.DismissReport(ctx, request.PathParameters[service.IdParam], []byte(request.Body), *moderatorID)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	adapter.LambdaMain(dismissReport)
+}
@@ -19,6 +19,8 @@ import (
 var s3Client *s3.Client
 var s3Bucket string
 
+var errNotInitialized = errors.New("S3 client is not initialized")
+
 func InitializeFromEnvironment(ctx context.Context) {
 	region := os.Getenv("AWS_REGION")
 	s3Bucket = os.Getenv("S3_BUCKET")
@@ -31,6 +33,9 @@ func InitializeFromEnvironment(ctx context.Context) {
 }
 
 func PutString(ctx context.Context, path string, content string) error {
+	if s3Client == nil {
+		return errNotInitialized
+	}
 	putInput := &s3.PutObjectInput{
 		Bucket: aws.String(s3Bucket),
 		Key:    aws.String(path),
@@ -46,6 +51,9 @@ func PutString(ctx context.Context, path string, content string) error {
 }
 
 func GetString(ctx context.Context, path string) (string, error) {
+	if s3Client == nil {
+		return "", errNotInitialized
+	}
 	output, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s3Bucket),
 		Key:    aws.String(path),
@@ -68,6 +76,9 @@ func GetString(ctx context.Context, path string) (string, error) {
 }
 
 func Delete(ctx context.Context, path string) error {
+	if s3Client == nil {
+		return errNotInitialized
+	}
 	_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s3Bucket),
 		Key:    aws.String(path),
@@ -76,6 +87,9 @@ func Delete(ctx context.Context, path string) error {
 }
 
 func List(ctx context.Context, prefix string, extension string) ([]string, error) {
+	if s3Client == nil {
+		return nil, errNotInitialized
+	}
 	var result []string
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(s3Bucket),
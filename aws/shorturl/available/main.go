@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+func shortURLKeyAvailability(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	userID := service.GetUUIDFromAuthorization(request.Headers["authorization"])
+	params := request.QueryStringParameters
+	status, body := shorturl.CheckAvailability(ctx, params["key"], service.ToUUID(params["domainId"]), userID)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	adapter.LambdaMain(shortURLKeyAvailability)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+func createShortURLs(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	requestBody := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			status, body := service.Marshal(http.StatusBadRequest, []*shorturl.BulkResult{}, fmt.Errorf("failed to decode request body: %w", err))
+			return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+		}
+		requestBody = decoded
+	}
+
+	atomic, _ := strconv.ParseBool(request.QueryStringParameters["atomic"])
+	userID := service.GetUUIDFromAuthorization(request.Headers["authorization"])
+	status, results, err := shorturl.CreateShortURLs(ctx, request.Headers["content-type"], requestBody, userID, atomic)
+	if err == nil {
+		var body string
+		if body, err = shorturl.BulkResultsCSV(results); err == nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: map[string]string{
+				"Content-Type":                shorturl.ContentTypeCSV,
+				"Content-Disposition":         `attachment; filename="shorturls.csv"`,
+				"Access-Control-Allow-Origin": "*",
+			}}, nil
+		}
+		status = http.StatusInternalServerError
+	}
+
+	status, body := service.Marshal(status, results, err)
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	adapter.LambdaMain(createShortURLs)
+}
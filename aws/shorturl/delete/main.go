@@ -10,7 +10,8 @@ import (
 )
 
 func deleteShortURL(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Delete(ctx, request, shorturl.DeleteSQL, service.IdParam), nil
+	status, body := shorturl.DeleteShortURL(ctx, request.PathParameters[service.IdParam], request.Headers["if-match"])
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
 }
 
 func main() {
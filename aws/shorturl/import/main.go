@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+func importShortURLs(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	requestBody := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			status, body := service.Marshal(http.StatusBadRequest, &shorturl.ImportReport{}, fmt.Errorf("failed to decode request body: %w", err))
+			return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+		}
+		requestBody = decoded
+	}
+
+	userID := service.GetUUIDFromAuthorization(request.Headers["authorization"])
+	campaignID := service.ToUUID(request.QueryStringParameters["campaignId"])
+	status, body := service.Marshal(shorturl.ImportShortURLs(ctx, request.Headers["content-type"], requestBody, userID, campaignID))
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+}
+
+func main() {
+	adapter.LambdaMain(importShortURLs)
+}
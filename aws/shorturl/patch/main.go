@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+func patchShortURL(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	status, body, etag := shorturl.PatchShortURL(ctx, request.PathParameters[service.IdParam], []byte(request.Body), request.Headers["if-match"])
+	return adapter.ETagResponse(status, body, etag), nil
+}
+
+func main() {
+	adapter.LambdaMain(patchShortURL)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"maps"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/lnk.by/aws/adapter"
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+func shortURLQRCode(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	key := request.PathParameters[service.IdParam]
+	status, opts, content, err := shorturl.GenerateQRCode(ctx, key, request.QueryStringParameters)
+	if err != nil {
+		status, body := service.Marshal(status, opts, err)
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: body, Headers: adapter.StandardHeaders}, nil
+	}
+
+	headers := maps.Clone(adapter.StandardHeaders)
+	headers["Content-Type"] = opts.ContentType()
+	headers["Content-Disposition"] = fmt.Sprintf(`inline; filename="%s.%s"`, key, opts.Format)
+	if opts.Format == shorturl.QRFormatSVG {
+		return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: string(content), Headers: headers}, nil
+	}
+	return events.APIGatewayV2HTTPResponse{StatusCode: status, Body: base64.StdEncoding.EncodeToString(content), IsBase64Encoded: true, Headers: headers}, nil
+}
+
+func main() {
+	adapter.LambdaMain(shortURLQRCode)
+}
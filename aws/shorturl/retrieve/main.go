@@ -10,7 +10,7 @@ import (
 )
 
 func retrieveShortURL(ctx context.Context, request events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
-	return adapter.Retrieve(ctx, request, shorturl.RetrieveSQL, service.IdParam)
+	return adapter.Retrieve(ctx, request, shorturl.RetrieveSQL, shorturl.VersionSQL, service.IdParam)
 }
 
 func main() {
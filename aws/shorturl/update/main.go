@@ -10,7 +10,8 @@ import (
 )
 
 func updateShortURL(ctx context.Context, request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	return adapter.Update(ctx, request, shorturl.UpdateSQL, service.IdParam), nil
+	status, body, etag := shorturl.UpdateShortURL(ctx, request.PathParameters[service.IdParam], []byte(request.Body), request.Headers["if-match"])
+	return adapter.ETagResponse(status, body, etag), nil
 }
 
 func main() {
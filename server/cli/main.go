@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/joho/godotenv"
+	"github.com/lnk.by/aws/s3client"
+	"github.com/lnk.by/shared/db"
+	"github.com/lnk.by/shared/service/archive"
+	"github.com/lnk.by/shared/service/health"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+// commands maps sub-command names to their implementations; every command parses its own flags.
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"import":  importLinks,
+	"export":  exportOrganization,
+	"restore": restoreOrganization,
+	"health":  checkHealth,
+	"stub":    runStub,
+}
+
+func initDbConnection(ctx context.Context) error {
+	if err := godotenv.Load(); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to load .env: %w", err)
+		}
+	}
+
+	if err := db.InitFromEnvironment(ctx); err != nil {
+		return fmt.Errorf("failed to init DB: %w", err)
+	}
+
+	// landing page configurations are kept in S3; without a bucket they are reported as missing
+	if os.Getenv("S3_BUCKET") != "" {
+		s3client.InitializeFromEnvironment(ctx)
+	}
+
+	return nil
+}
+
+// importLinks imports links exported by another shortener from a CSV or JSON file.
+func importLinks(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	customer := flags.String("customer", "", "ID of the customer that owns the imported links")
+	campaign := flags.String("campaign", "", "ID of the campaign of the imported links")
+	format := flags.String("format", "", "format of the file: csv or json (by default it is taken from the file extension)")
+	verbose := flags.Bool("v", false, "print the result of every link, not only of the failed ones")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: cli import [-customer ID] [-campaign ID] [-format csv|json] [-v] FILE")
+	}
+
+	path := flags.Arg(0)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %q: %w", path, err)
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	contentType := shorturl.ContentTypeCSV
+	if *format == "json" {
+		contentType = shorturl.ContentTypeJSON
+	}
+
+	customerID, err := parseOptionalUUID("customer", *customer)
+	if err != nil {
+		return err
+	}
+	campaignID, err := parseOptionalUUID("campaign", *campaign)
+	if err != nil {
+		return err
+	}
+
+	if err := initDbConnection(ctx); err != nil {
+		return err
+	}
+
+	_, report, err := shorturl.ImportShortURLs(ctx, contentType, content, customerID, campaignID)
+	if err != nil {
+		return fmt.Errorf("failed to import %q: %w", path, err)
+	}
+
+	for _, result := range report.Results {
+		if *verbose || result.Status != shorturl.ImportStatusImported {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", result.Row, result.Status, result.Key, result.Target, result.Error)
+		}
+	}
+	summary, _ := json.Marshal(map[string]int{"imported": report.Imported, "conflicts": report.Conflicts, "invalid": report.Invalid, "failed": report.Failed})
+	fmt.Println(string(summary))
+
+	return nil
+}
+
+// exportOrganization writes everything the organization owns into an archive that can be restored later.
+func exportOrganization(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	organization := flags.String("organization", "", "ID of the organization to export")
+	output := flags.String("o", "", "file to write the archive to (by default it is named after the organization and the date)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	organizationID, err := parseOptionalUUID("organization", *organization)
+	if err != nil {
+		return err
+	}
+	if organizationID == nil || flags.NArg() != 0 {
+		return errors.New("usage: cli export -organization ID [-o FILE]")
+	}
+	if *output == "" {
+		*output = archive.ArchiveName(*organizationID, time.Now())
+	}
+
+	if err := initDbConnection(ctx); err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", *output, err)
+	}
+	defer file.Close()
+
+	manifest, err := archive.Export(ctx, *organizationID, file)
+	if err != nil {
+		return fmt.Errorf("failed to export organization %v: %w", *organizationID, err)
+	}
+
+	for _, id := range manifest.MissingConfigurations {
+		fmt.Printf("missing configuration of landing page %s\n", id)
+	}
+	summary, _ := json.Marshal(manifest.Counts)
+	fmt.Printf("%s\t%s\n", *output, summary)
+
+	return file.Close()
+}
+
+// restoreOrganization loads an archive produced by the export command.
+func restoreOrganization(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: cli restore FILE")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %q: %w", args[0], err)
+	}
+	defer file.Close()
+
+	if err := initDbConnection(ctx); err != nil {
+		return err
+	}
+
+	_, report, err := archive.Restore(ctx, file, archive.Anyone)
+	if err != nil {
+		return fmt.Errorf("failed to restore %q: %w", args[0], err)
+	}
+
+	summary, _ := json.Marshal(report)
+	fmt.Println(string(summary))
+
+	return nil
+}
+
+func parseOptionalUUID(name string, value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.FromString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s ID %q: %w", name, value, err)
+	}
+	return &id, nil
+}
+
+// checkHealth checks the targets of the links that are due once, e.g. from cron instead of the server.
+func checkHealth(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("health", flag.ExitOnError)
+	all := flags.Bool("all", false, "check batches until no link is due")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := health.ConfigFromEnvironment()
+	if err != nil {
+		return err
+	}
+	if err := initDbConnection(ctx); err != nil {
+		return err
+	}
+
+	checker := health.NewChecker(config)
+	total := 0
+	for {
+		checked, err := health.CheckDue(ctx, config, checker)
+		if err != nil {
+			return err
+		}
+		total += checked
+		if !*all || checked < config.Batch {
+			break
+		}
+	}
+	fmt.Printf("checked %d links\n", total)
+	return nil
+}
+
+// runStub serves health.Stub, a local target for trying the link health checks out with HEALTH_CHECK_ALLOW_PRIVATE=true.
+func runStub(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("stub", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8081", "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	slog.Info("Serving link health stub", "addr", *addr)
+	return http.ListenAndServe(*addr, health.Stub())
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "usage: cli <%s> [flags] [args]\n", strings.Join(names, "|"))
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := command(context.Background(), os.Args[2:]); err != nil {
+		slog.Error("Command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
@@ -1,13 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
-	"math"
 	"net/http"
 	"os"
 	"strconv"
@@ -17,11 +17,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gofrs/uuid"
 	"github.com/joho/godotenv"
+	"github.com/lnk.by/shared/auth"
 	"github.com/lnk.by/shared/db"
 	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/archive"
 	"github.com/lnk.by/shared/service/campaign"
 	"github.com/lnk.by/shared/service/customer"
+	"github.com/lnk.by/shared/service/domain"
+	"github.com/lnk.by/shared/service/health"
 	"github.com/lnk.by/shared/service/landingpage"
+	"github.com/lnk.by/shared/service/moderation"
 	"github.com/lnk.by/shared/service/organization"
 	"github.com/lnk.by/shared/service/shorturl"
 	"github.com/lnk.by/shared/service/stats"
@@ -29,15 +34,17 @@ import (
 )
 
 const (
-	accessControlAllowOriginHeader  = "Access-Control-Allow-Origin"
-	accessControlAllowMethodsHeader = "Access-Control-Allow-Methods"
-	accessControlAllowHeadersHeader = "Access-Control-Allow-Headers"
-	authorizationHeader             = "Authorization"
-	contentTypeHeader               = "Content-Type"
-	retryAfterHeader                = "Retry-After"
+	accessControlAllowOriginHeader   = "Access-Control-Allow-Origin"
+	accessControlAllowMethodsHeader  = "Access-Control-Allow-Methods"
+	accessControlAllowHeadersHeader  = "Access-Control-Allow-Headers"
+	accessControlExposeHeadersHeader = "Access-Control-Expose-Headers"
+	authorizationHeader              = "Authorization"
+	contentTypeHeader                = "Content-Type"
+	retryAfterHeader                 = "Retry-After"
 )
 
 const contentTypeJSON = "application/json"
+const contentDispositionHeader = "Content-Disposition"
 const allowAnyOrigin = "*"
 
 func initDbConnection() error {
@@ -70,41 +77,26 @@ func list[K any, T service.Retrievable[K]](c *gin.Context, sql service.ListSQL[T
 
 func listAndTransform[K any, T service.Retrievable[K]](c *gin.Context, sql service.ListSQL[T], transformer func(t T) (T, error)) {
 	userID := service.GetUUIDFromAuthorization(c.GetHeader("Authorization"))
-	offset, err := parseQueryInt(c, "offset", 0)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offest"})
-		return
-	}
-	limit, err := parseQueryInt(c, "limit", math.MaxInt32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
-		return
-	}
-	status, body := service.List(c.Request.Context(), sql, userID, offset, limit, transformer)
+	status, body := service.List(c.Request.Context(), sql, userID, queryParams(c), transformer)
 	respondWithJSON(c, status, body)
 }
 
-func parseQueryInt(c *gin.Context, key string, defaultValue int) (int, error) {
-	valStr := c.Query(key)
-	if valStr == "" {
-		return defaultValue, nil
+// queryParams returns the first values of the query parameters, like API Gateway passes them to lambdas.
+func queryParams(c *gin.Context) map[string]string {
+	params := map[string]string{}
+	for name, values := range c.Request.URL.Query() {
+		params[name] = values[0]
 	}
-
-	val, err := strconv.Atoi(valStr)
-	if err != nil {
-		return 0, fmt.Errorf("faild to parse value %q: must be an integer", key)
-	}
-
-	return val, nil
+	return params
 }
 
-func retrieve[K any, T service.Retrievable[K]](c *gin.Context, sql service.RetrieveSQL[T]) {
-	retrieveAndTransform(c, sql, func(t T) (T, error) { return t, nil })
+func retrieve[K any, T service.Retrievable[K]](c *gin.Context, sql service.RetrieveSQL[T], versionSQL service.VersionSQL[T]) {
+	retrieveAndTransform(c, sql, versionSQL, func(t T) (T, error) { return t, nil })
 }
 
-func retrieveAndTransform[K any, T service.Retrievable[K]](c *gin.Context, sql service.RetrieveSQL[T], transformer func(t T) (T, error)) {
-	status, body := service.Retrieve(c.Request.Context(), sql, c.Param("id"), transformer)
-	respondWithJSON(c, status, body)
+func retrieveAndTransform[K any, T service.Retrievable[K]](c *gin.Context, sql service.RetrieveSQL[T], versionSQL service.VersionSQL[T], transformer func(t T) (T, error)) {
+	status, body, etag := service.RetrieveConditional(c.Request.Context(), sql, versionSQL, c.Param("id"), c.GetHeader(service.IfNoneMatchHeader), transformer)
+	respondWithETag(c, status, body, etag)
 }
 
 func create[T service.Creatable](c *gin.Context, sql service.CreateSQL[T]) {
@@ -112,23 +104,57 @@ func create[T service.Creatable](c *gin.Context, sql service.CreateSQL[T]) {
 	respondWithJSON(c, status, body)
 }
 
-func update[K any, T service.Updatable[K]](c *gin.Context, sql service.UpdateSQL[T]) {
-	updateAndFinalize(c, sql, func(id K, t T) error { return nil })
+func update[K any, T service.Updatable[K]](c *gin.Context, sql service.UpdateSQL[T], versionSQL service.VersionSQL[T]) {
+	updateAndFinalize(c, sql, versionSQL, func(id K, t T) error { return nil })
 }
 
-func updateAndFinalize[K any, T service.Updatable[K]](c *gin.Context, sql service.UpdateSQL[T], finalizer func(id K, t T) error) {
-	status, body := service.UpdateFromReqBody(c.Request.Context(), sql, c.Param("id"), c.Request.Body, finalizer)
-	respondWithJSON(c, status, body)
+func updateAndFinalize[K any, T service.Updatable[K]](c *gin.Context, sql service.UpdateSQL[T], versionSQL service.VersionSQL[T], finalizer func(id K, t T) error) {
+	content, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body, etag := service.UpdateConditional(c.Request.Context(), sql, versionSQL, c.Param("id"), content, c.GetHeader(service.IfMatchHeader), finalizer)
+	respondWithETag(c, status, body, etag)
+}
+
+func patch[K any, T service.Patchable[K]](c *gin.Context, retrieveSQL service.RetrieveSQL[T], updateSQL service.UpdateSQL[T], versionSQL service.VersionSQL[T]) {
+	patchAndFinalize(c, retrieveSQL, updateSQL, versionSQL, func(t T) (T, error) { return t, nil }, func(id K, t T) error { return nil })
+}
+
+func patchAndFinalize[K any, T service.Patchable[K]](c *gin.Context, retrieveSQL service.RetrieveSQL[T], updateSQL service.UpdateSQL[T], versionSQL service.VersionSQL[T], transformer func(t T) (T, error), finalizer func(id K, t T) error) {
+	content, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body, etag := service.PatchConditional(c.Request.Context(), retrieveSQL, updateSQL, versionSQL, c.Param("id"), content, c.GetHeader(service.IfMatchHeader), transformer, finalizer)
+	respondWithETag(c, status, body, etag)
 }
-func deleteEntity[K any, T service.Retrievable[K]](c *gin.Context, sql service.DeleteSQL[T]) {
-	deleteEntityAndFinalize(c, sql, func(id K) error { return nil })
+
+func deleteEntity[K any, T service.Retrievable[K]](c *gin.Context, sql service.DeleteSQL[T], versionSQL service.VersionSQL[T]) {
+	deleteEntityAndFinalize(c, sql, versionSQL, func(id K) error { return nil })
 }
 
-func deleteEntityAndFinalize[K any, T service.Retrievable[K]](c *gin.Context, sql service.DeleteSQL[T], finalizer func(id K) error) {
-	status, body := service.Delete(c.Request.Context(), sql, c.Param("id"), finalizer)
+func deleteEntityAndFinalize[K any, T service.Retrievable[K]](c *gin.Context, sql service.DeleteSQL[T], versionSQL service.VersionSQL[T], finalizer func(id K) error) {
+	status, body := service.DeleteConditional(c.Request.Context(), sql, versionSQL, c.Param("id"), c.GetHeader(service.IfMatchHeader), finalizer)
 	respondWithJSON(c, status, body)
 }
 
+// respondWithETag responds with the ETag of the entity, if any; 304 has no body.
+func respondWithETag(c *gin.Context, statusCode int, jsonStr string, etag string) {
+	if etag != "" {
+		c.Header(service.ETagHeader, etag)
+		c.Header(accessControlExposeHeadersHeader, service.ETagHeader)
+	}
+	if statusCode == http.StatusNotModified {
+		c.Header(accessControlAllowOriginHeader, allowAnyOrigin)
+		c.Status(statusCode)
+		return
+	}
+	respondWithJSON(c, statusCode, jsonStr)
+}
+
 func respondWithJSON(c *gin.Context, statusCode int, jsonStr string) {
 	c.Header(contentTypeHeader, contentTypeJSON)
 	c.Header(accessControlAllowOriginHeader, allowAnyOrigin)
@@ -156,9 +182,135 @@ func createShortURL(c *gin.Context) {
 	respondWithJSON(c, status, responseBody)
 }
 
+func createShortURLs(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	atomic, _ := strconv.ParseBool(c.Query("atomic"))
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, results, err := shorturl.CreateShortURLs(c.Request.Context(), c.GetHeader(contentTypeHeader), requestBody, userID, atomic)
+	if err != nil {
+		status, body := service.Marshal(status, results, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	body, err := shorturl.BulkResultsCSV(results)
+	if err != nil {
+		status, body := service.Marshal(http.StatusInternalServerError, results, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	c.Header(contentDispositionHeader, `attachment; filename="shorturls.csv"`)
+	c.Header(accessControlAllowOriginHeader, allowAnyOrigin)
+	c.Data(status, shorturl.ContentTypeCSV, []byte(body))
+}
+
+func updateShortURL(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body, etag := shorturl.UpdateShortURL(c.Request.Context(), c.Param("id"), requestBody, c.GetHeader(service.IfMatchHeader))
+	respondWithETag(c, status, body, etag)
+}
+
+func patchShortURL(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body, etag := shorturl.PatchShortURL(c.Request.Context(), c.Param("id"), requestBody, c.GetHeader(service.IfMatchHeader))
+	respondWithETag(c, status, body, etag)
+}
+
+func updateShortURLs(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := shorturl.UpdateShortURLs(c.Request.Context(), requestBody, userID)
+	respondWithJSON(c, status, body)
+}
+
+func deleteShortURLs(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := shorturl.DeleteShortURLs(c.Request.Context(), requestBody, userID)
+	respondWithJSON(c, status, body)
+}
+
+func importShortURLs(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	campaignID := service.ToUUID(c.Query("campaignId"))
+	status, body := service.Marshal(shorturl.ImportShortURLs(c.Request.Context(), c.GetHeader(contentTypeHeader), requestBody, userID, campaignID))
+	respondWithJSON(c, status, body)
+}
+
+func exportOrganization(c *gin.Context) {
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, organizationID, err := archive.CanExport(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		status, body := service.Marshal(status, &organizationID, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+
+	var buf bytes.Buffer
+	if _, err := archive.Export(c.Request.Context(), organizationID, &buf); err != nil {
+		status, body := service.Marshal(http.StatusInternalServerError, &organizationID, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	c.Header(contentDispositionHeader, fmt.Sprintf(`attachment; filename="%s"`, archive.ArchiveName(organizationID, time.Now())))
+	c.Header(accessControlAllowOriginHeader, allowAnyOrigin)
+	c.Data(http.StatusOK, archive.ContentType, buf.Bytes())
+}
+
+func restoreOrganization(c *gin.Context) {
+	sub, groups := verifiedUser(c)
+	if sub == "" {
+		respondWithJSON(c, http.StatusUnauthorized, `{"error": "authentication is required to restore data"}`)
+		return
+	}
+	status, body := service.Marshal(archive.Restore(c.Request.Context(), c.Request.Body, archive.CanRestore(sub, groups)))
+	respondWithJSON(c, status, body)
+}
+
+func shortURLQRCode(c *gin.Context) {
+	status, opts, content, err := shorturl.GenerateQRCode(c.Request.Context(), c.Param("id"), queryParams(c))
+	if err != nil {
+		status, body := service.Marshal(status, opts, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	c.Header(contentDispositionHeader, fmt.Sprintf(`inline; filename="%s.%s"`, c.Param("id"), opts.Format))
+	c.Header(accessControlAllowOriginHeader, allowAnyOrigin)
+	c.Data(status, opts.ContentType(), content)
+}
+
+func deleteShortURL(c *gin.Context) {
+	status, body := shorturl.DeleteShortURL(c.Request.Context(), c.Param("id"), c.GetHeader(service.IfMatchHeader))
+	respondWithJSON(c, status, body)
+}
+
 var (
 	allowedMethods = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}, ",")
-	allowedHeaders = strings.Join([]string{authorizationHeader, contentTypeHeader}, ",")
+	allowedHeaders = strings.Join([]string{authorizationHeader, contentTypeHeader, service.IfMatchHeader, service.IfNoneMatchHeader}, ",")
 )
 
 func corsMiddleware(c *gin.Context) {
@@ -192,15 +344,48 @@ func jsonErrorHandler(c *gin.Context) {
 }
 
 func redirect(c *gin.Context) {
-	key := c.Param("id")
-	now := time.Now()
-	day := fmt.Sprintf("day%03d", now.YearDay())
-	hour := fmt.Sprintf("hour%02d", now.Hour())
-	status, url, errStr := service.RetrieveValueAndMarshalError(c.Request.Context(), shorturl.RetrieveValidSQL, key, day, hour)
+	key, preview := shorturl.IsPreview(c.Param("id"), c.Request.URL.Query())
+	status, resolution, err := shorturl.Resolve(c.Request.Context(), c.Request.Host, key)
+	if err != nil {
+		status, body := service.Marshal(status, resolution, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	if resolution.Key == "" {
+		c.Redirect(http.StatusFound, resolution.Fallback)
+		return
+	}
+	key = resolution.Key
+
+	if preview {
+		status, contentType, body := shorturl.PreviewResponse(c.Request.Context(), key, resolution.DomainID, c.Request.URL.Query(), c.GetHeader("Accept"))
+		c.Data(status, contentType, []byte(body))
+		return
+	}
+
+	status, url, errStr := shorturl.RetrieveValid(c.Request.Context(), resolution, time.Now())
 	if errStr != "" {
 		respondWithJSON(c, status, errStr)
 		return
 	}
+	if status, headers, body, suspended := url.WarningResponse(c.Request.Context()); suspended {
+		for name, value := range headers {
+			c.Header(name, value)
+		}
+		c.Data(status, headers["Content-Type"], body)
+		return
+	}
+
+	target := url.RedirectTarget(c.Request.URL.Query())
+	// crawlers that build link previews get the metadata of the link; they are neither limited nor counted as clicks
+	if url.OpenGraph != nil && shorturl.IsSocialCrawler(c.GetHeader("User-Agent")) {
+		page, err := url.OpenGraphPage(target)
+		if err == nil {
+			c.Data(http.StatusOK, shorturl.ContentTypeHTML, page)
+			return
+		}
+		slog.Warn("Failed to render metadata", "key", key, "error", err)
+	}
 
 	if limitExceeded, retryAfter := shorturl.GetLimitExceededMessage(url); limitExceeded != "" {
 		c.Header(retryAfterHeader, strconv.Itoa(retryAfter))
@@ -209,11 +394,126 @@ func redirect(c *gin.Context) {
 		return
 	}
 
-	if err := sendStatistics(c, key); err != nil {
+	if err := sendStatistics(c, url.Key); err != nil {
 		slog.Warn("Failed to send stats", "error", err)
 	}
 
-	c.Redirect(http.StatusFound, url.Target)
+	status, headers, body := url.RedirectResponse(target)
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+	c.Status(status)
+	c.Writer.WriteHeaderNow()
+	if _, err := c.Writer.Write(body); err != nil {
+		slog.Warn("Failed to write redirect", "key", key, "error", err)
+	}
+}
+
+func shortURLsHealth(c *gin.Context) {
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := health.List(c.Request.Context(), userID, queryParams(c))
+	respondWithJSON(c, status, body)
+}
+
+func shortURLKeyAvailability(c *gin.Context) {
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := shorturl.CheckAvailability(c.Request.Context(), c.Query("key"), service.ToUUID(c.Query("domainId")), userID)
+	respondWithJSON(c, status, body)
+}
+
+func createDomain(c *gin.Context) {
+	content, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := domain.Create(c.Request.Context(), content, userID)
+	respondWithJSON(c, status, body)
+}
+
+func updateDomain(c *gin.Context) {
+	content, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body, etag := domain.Update(c.Request.Context(), c.Param("id"), content, userID, c.GetHeader(service.IfMatchHeader))
+	respondWithETag(c, status, body, etag)
+}
+
+func patchDomain(c *gin.Context) {
+	content, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body, etag := domain.Patch(c.Request.Context(), c.Param("id"), content, userID, c.GetHeader(service.IfMatchHeader))
+	respondWithETag(c, status, body, etag)
+}
+
+func deleteDomain(c *gin.Context) {
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := domain.Delete(c.Request.Context(), c.Param("id"), userID, c.GetHeader(service.IfMatchHeader))
+	respondWithJSON(c, status, body)
+}
+
+func verifyDomain(c *gin.Context) {
+	userID := service.GetUUIDFromAuthorization(c.GetHeader(authorizationHeader))
+	status, body := domain.Verify(c.Request.Context(), c.Param("id"), userID)
+	respondWithJSON(c, status, body)
+}
+
+func reportShortURL(c *gin.Context) {
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body := moderation.CreateReport(c.Request.Context(), c.Param("id"), requestBody)
+	respondWithJSON(c, status, body)
+}
+
+// verifiedUser returns the subject and the groups of the bearer token once its signature is verified, see auth.VerifyBearer;
+// nothing if it is not, so moderation is refused.
+func verifiedUser(c *gin.Context) (string, []string) {
+	claims, err := auth.VerifyBearer(c.Request.Context(), c.GetHeader(authorizationHeader))
+	if err != nil {
+		slog.Warn("Unverified token", "error", err)
+		return "", nil
+	}
+	sub, _ := claims["sub"].(string)
+	return sub, auth.Groups(claims)
+}
+
+// moderate runs the moderation action on the entity of the path if the user is a moderator.
+func moderate(c *gin.Context, action func(ctx context.Context, id string, requestBody []byte, moderatorID uuid.UUID) (int, string)) {
+	status, moderatorID, err := moderation.Moderator(verifiedUser(c))
+	if err != nil {
+		status, body := service.Marshal(status, moderatorID, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	requestBody, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondWithJSON(c, http.StatusInternalServerError, fmt.Sprintf("{\"error\": %s}", fmt.Errorf("failed to read request body: %w", err)))
+		return
+	}
+	status, body := action(c.Request.Context(), c.Param("id"), requestBody, *moderatorID)
+	respondWithJSON(c, status, body)
+}
+
+func listModeration(c *gin.Context, list func(ctx context.Context, params map[string]string) (int, string)) {
+	status, moderatorID, err := moderation.Moderator(verifiedUser(c))
+	if err != nil {
+		status, body := service.Marshal(status, moderatorID, err)
+		respondWithJSON(c, status, body)
+		return
+	}
+	status, body := list(c.Request.Context(), queryParams(c))
+	respondWithJSON(c, status, body)
 }
 
 func sendStatistics(c *gin.Context, key string) error {
@@ -225,6 +525,7 @@ func sendStatistics(c *gin.Context, key string) error {
 		Referer:   header.Get("referer"),
 		Timestamp: time.Now().UTC(),
 		Language:  header.Get("accept-language"),
+		Source:    c.Query(shorturl.SourceParam),
 	}
 	return stats.Process(c.Request.Context(), event)
 }
@@ -235,36 +536,81 @@ func run() error {
 	router.RemoveExtraSlash = true
 
 	router.POST("/customers", func(c *gin.Context) { create(c, customer.CreateSQL) })
-	router.PUT("/customers/:id", func(c *gin.Context) { update(c, customer.UpdateSQL) })
+	router.PUT("/customers/:id", func(c *gin.Context) { update(c, customer.UpdateSQL, customer.VersionSQL) })
+	router.PATCH("/customers/:id", func(c *gin.Context) { patch(c, customer.RetrieveSQL, customer.UpdateSQL, customer.VersionSQL) })
 	router.GET("/customers", func(c *gin.Context) { list(c, customer.ListSQL) })
-	router.GET("/customers/:id", func(c *gin.Context) { retrieve(c, customer.RetrieveSQL) })
-	router.DELETE("/customers/:id", func(c *gin.Context) { deleteEntity(c, customer.DeleteSQL) })
+	router.GET("/customers/:id", func(c *gin.Context) { retrieve(c, customer.RetrieveSQL, customer.VersionSQL) })
+	router.DELETE("/customers/:id", func(c *gin.Context) { deleteEntity(c, customer.DeleteSQL, customer.VersionSQL) })
+	router.POST("/customers/:id/ban", func(c *gin.Context) { moderate(c, moderation.BanCustomer) })
 
 	router.POST("/organizations", func(c *gin.Context) { create(c, organization.CreateSQL) })
-	router.PUT("/organizations/:id", func(c *gin.Context) { update(c, organization.UpdateSQL) })
+	router.PUT("/organizations/:id", func(c *gin.Context) { update(c, organization.UpdateSQL, organization.VersionSQL) })
+	router.PATCH("/organizations/:id", func(c *gin.Context) {
+		patch(c, organization.RetrieveSQL, organization.UpdateSQL, organization.VersionSQL)
+	})
 	router.GET("/organizations", func(c *gin.Context) { list(c, organization.ListSQL) })
-	router.GET("/organizations/:id", func(c *gin.Context) { retrieve(c, organization.RetrieveSQL) })
-	router.DELETE("/organizations/:id", func(c *gin.Context) { deleteEntity(c, organization.DeleteSQL) })
+	router.GET("/organizations/:id", func(c *gin.Context) { retrieve(c, organization.RetrieveSQL, organization.VersionSQL) })
+	router.DELETE("/organizations/:id", func(c *gin.Context) { deleteEntity(c, organization.DeleteSQL, organization.VersionSQL) })
+	router.GET("/organizations/:id/export", func(c *gin.Context) { exportOrganization(c) })
+	router.POST("/organizations/restore", func(c *gin.Context) { restoreOrganization(c) })
 
 	router.POST("/campaigns", func(c *gin.Context) { create(c, campaign.CreateSQL) })
-	router.PUT("/campaigns/:id", func(c *gin.Context) { update(c, campaign.UpdateSQL) })
+	router.PUT("/campaigns/:id", func(c *gin.Context) { update(c, campaign.UpdateSQL, campaign.VersionSQL) })
+	router.PATCH("/campaigns/:id", func(c *gin.Context) { patch(c, campaign.RetrieveSQL, campaign.UpdateSQL, campaign.VersionSQL) })
 	router.GET("/campaigns", func(c *gin.Context) { list(c, campaign.ListSQL) })
-	router.GET("/campaigns/:id", func(c *gin.Context) { retrieve(c, campaign.RetrieveSQL) })
-	router.DELETE("/campaigns/:id", func(c *gin.Context) { deleteEntity(c, campaign.DeleteSQL) })
+	router.GET("/campaigns/:id", func(c *gin.Context) { retrieve(c, campaign.RetrieveSQL, campaign.VersionSQL) })
+	router.DELETE("/campaigns/:id", func(c *gin.Context) { deleteEntity(c, campaign.DeleteSQL, campaign.VersionSQL) })
+
+	router.POST("/domains", func(c *gin.Context) { createDomain(c) })
+	router.PUT("/domains/:id", func(c *gin.Context) { updateDomain(c) })
+	router.PATCH("/domains/:id", func(c *gin.Context) { patchDomain(c) })
+	router.GET("/domains", func(c *gin.Context) { list(c, domain.ListSQL) })
+	router.GET("/domains/:id", func(c *gin.Context) { retrieve(c, domain.RetrieveSQL, domain.VersionSQL) })
+	router.DELETE("/domains/:id", func(c *gin.Context) { deleteDomain(c) })
+	router.POST("/domains/:id/verify", func(c *gin.Context) { verifyDomain(c) })
 
 	router.POST("/shorturls", func(c *gin.Context) { createShortURL(c) })
-	router.PUT("/shorturls/:id", func(c *gin.Context) { update(c, shorturl.UpdateSQL) })
+	router.POST("/shorturls/bulk", func(c *gin.Context) { createShortURLs(c) })
+	router.POST("/shorturls/bulk/update", func(c *gin.Context) { updateShortURLs(c) })
+	router.POST("/shorturls/bulk/delete", func(c *gin.Context) { deleteShortURLs(c) })
+	router.POST("/shorturls/import", func(c *gin.Context) { importShortURLs(c) })
+	router.PUT("/shorturls/:id", updateShortURL)
+	router.PATCH("/shorturls/:id", patchShortURL)
 	router.GET("/shorturls", func(c *gin.Context) { list(c, shorturl.ListSQL) })
-	router.GET("/shorturls/:id", func(c *gin.Context) { retrieve(c, shorturl.RetrieveSQL) })
-	router.DELETE("/shorturls/:id", func(c *gin.Context) { deleteEntity(c, shorturl.DeleteSQL) })
+	router.GET("/shorturls/:id", func(c *gin.Context) { retrieve(c, shorturl.RetrieveSQL, shorturl.VersionSQL) })
+	router.GET("/shorturls/:id/qr", func(c *gin.Context) { shortURLQRCode(c) })
+	router.GET("/shorturls/available", func(c *gin.Context) { shortURLKeyAvailability(c) })
+	router.GET("/shorturls/health", shortURLsHealth)
+	router.GET("/shorturls/:id/health", func(c *gin.Context) {
+		status, body := health.Retrieve(c.Request.Context(), c.Param("id"))
+		respondWithJSON(c, status, body)
+	})
+	router.DELETE("/shorturls/:id", func(c *gin.Context) { deleteShortURL(c) })
+	router.POST("/shorturls/:id/report", reportShortURL)
+	router.POST("/shorturls/:id/suspend", func(c *gin.Context) { moderate(c, moderation.SuspendShortURL) })
+	router.POST("/shorturls/:id/restore", func(c *gin.Context) { moderate(c, moderation.RestoreShortURL) })
+
+	router.GET("/reports", func(c *gin.Context) { listModeration(c, moderation.ListReports) })
+	router.POST("/reports/:id/dismiss", func(c *gin.Context) { moderate(c, moderation.DismissReport) })
+	router.GET("/moderations", func(c *gin.Context) { listModeration(c, moderation.ListActions) })
 
 	router.POST("/landingpages", func(c *gin.Context) { createLandingPage(c) })
 	router.PUT("/landingpages/:id", func(c *gin.Context) {
-		updateAndFinalize(c, landingpage.UpdateSQL, func(id uuid.UUID, p *landingpage.LandingPage) error {
+		updateAndFinalize(c, landingpage.UpdateSQL, landingpage.VersionSQL, func(id uuid.UUID, p *landingpage.LandingPage) error {
 			_, err := landingpage.SetConfiguration(c.Request.Context(), p)
 			return err
 		})
 	})
+	router.PATCH("/landingpages/:id", func(c *gin.Context) {
+		// the configuration is patched too, so the current one is read before and the merged one stored after
+		patchAndFinalize(c, landingpage.RetrieveSQL, landingpage.UpdateSQL, landingpage.VersionSQL,
+			func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
+				return landingpage.SetConfiguration(c.Request.Context(), p)
+			},
+			func(id uuid.UUID, p *landingpage.LandingPage) error {
+				return landingpage.StroreConfiguration(c.Request.Context(), p)
+			})
+	})
 	router.GET("/landingpages", func(c *gin.Context) {
 		listAndTransform(c, landingpage.ListSQL,
 			func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
@@ -272,15 +618,17 @@ func run() error {
 			})
 	})
 	router.GET("/landingpages/:id", func(c *gin.Context) {
-		retrieveAndTransform(c, landingpage.RetrieveSQL, func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
+		retrieveAndTransform(c, landingpage.RetrieveSQL, landingpage.VersionSQL, func(p *landingpage.LandingPage) (*landingpage.LandingPage, error) {
 			return landingpage.SetConfiguration(c.Request.Context(), p)
 		})
 	})
 	router.DELETE("/landingpages/:id", func(c *gin.Context) {
-		deleteEntityAndFinalize(c, landingpage.DeleteSQL, func(id uuid.UUID) error { return landingpage.DeleteConfiguration(c.Request.Context(), id) })
+		deleteEntityAndFinalize(c, landingpage.DeleteSQL, landingpage.VersionSQL, func(id uuid.UUID) error { return landingpage.DeleteConfiguration(c.Request.Context(), id) })
 	})
 
 	router.GET("/go/:id", redirect)
+	// static routes take precedence over the root one, so only the first path segments of the API cannot be keys, see shorturl.ReservedKeys
+	router.GET("/:id", redirect)
 
 	router.Static("/ui", "../ui")
 	router.Static("/landingpages/templates", "../landingpages/templates")
@@ -289,6 +637,14 @@ func run() error {
 	if err := initDbConnection(); err != nil {
 		return fmt.Errorf("failed to init DB connnection: %w", err)
 	}
+	if err := shorturl.StartGenerator(context.Background()); err != nil {
+		return fmt.Errorf("failed to start key generator: %w", err)
+	}
+	healthConfig, err := health.ConfigFromEnvironment()
+	if err != nil {
+		return fmt.Errorf("failed to configure link health checks: %w", err)
+	}
+	health.Start(context.Background(), healthConfig)
 	if err := maxmind.Init(); err != nil {
 		slog.Error("Failed to intialize mixmind", "error", err)
 	}
@@ -44,6 +44,146 @@ curl -X POST -H 'Content-Type: application/json' -d '{"target":"http://www.googl
 
 curl -X POST -H 'Content-Type: application/json' -d '{"target":"http://www.youtube.com", "key": "ubt", "custom": true}' http://localhost:8080/shorturl
 
+# bulk creation: JSON array or CSV (target is the only mandatory column); returns CSV with keys and links
+curl -X POST -H 'Content-Type: application/json' -d '[{"target":"http://www.google.com"}, {"target":"http://www.youtube.com", "key": "yt"}]' http://localhost:8080/shorturls/bulk
+curl -X POST -H 'Content-Type: text/csv' --data-binary $'target,key,totalLimit\nhttp://www.google.com,,100\nhttp://www.cnn.com,news,\n' 'http://localhost:8080/shorturls/bulk?atomic=true'
+curl -X POST -F 'file=@links.csv' http://localhost:8080/shorturls/bulk
+
+# bulk update and delete of the links of the current customer selected by keys, campaign, tag and/or created range
+curl -X POST -H 'Content-Type: application/json' -d '{"filter": {"campaignId": "735aef8a-4d24-11f0-9888-002b67d6b1c3"}, "patch": {"status": "cancelled"}}' http://localhost:8080/shorturls/bulk/update
+curl -X POST -H 'Content-Type: application/json' -d '{"filter": {"tag": "summer"}, "patch": {"validUntil": "2025-09-01T00:00:00Z"}}' http://localhost:8080/shorturls/bulk/update
+curl -X POST -H 'Content-Type: application/json' -d '{"filter": {"keys": ["cnn", "ubt"]}}' http://localhost:8080/shorturls/bulk/delete
+
+# import of links exported by another shortener (CSV with key/target/created/clicks-like columns or JSON); existing keys are reported as conflicts
+curl -X POST -H 'Content-Type: text/csv' --data-binary @export.csv 'http://localhost:8080/shorturls/import?campaignId=735aef8a-4d24-11f0-9888-002b67d6b1c3'
+# the same from the command line
+go run ./server/cli import -customer 02695f62-4d25-11f0-9888-002b67d6b1c3 export.csv
+
+# UTM defaults of a campaign and of a link (the link wins, parameters already in the target win over both) and forwarding of the visitor's query string
+curl -X POST -H 'Content-Type: application/json' -d '{"name": "Spring", "utm": {"source": "newsletter", "medium": "email", "campaign": "spring"}}' http://localhost:8080/campaigns
+curl -X POST -H 'Content-Type: application/json' -d '{"target": "https://example.com/?ref=lnk", "key": "spring", "campaignId": "735aef8a-4d24-11f0-9888-002b67d6b1c3", "utm": {"content": "banner"}, "passthrough": "append"}' http://localhost:8080/shorturls
+# redirects to https://example.com/?gclid=abc&ref=lnk&utm_campaign=spring&utm_content=banner&utm_medium=email&utm_source=newsletter
+curl -i 'http://localhost:8080/go/spring?gclid=abc&ref=other'
+
+# preview of a short link (destination, page title, owner, creation date) that is not counted as a click
+curl 'http://localhost:8080/go/spring+'
+curl -H 'Accept: application/json' 'http://localhost:8080/go/spring?preview=1'
+# opt-in interstitial that shows the destination for 3 seconds before redirecting
+curl -X PUT -H 'Content-Type: application/json' -d '{"target": "https://example.com/", "interstitialDelay": 3000}' http://localhost:8080/shorturls/spring
+
+# custom OpenGraph/Twitter card metadata served to social crawlers instead of the redirect
+curl -X PUT -H 'Content-Type: application/json' -d '{"target": "https://example.com/", "openGraph": {"title": "Spring sale", "description": "Up to 50% off", "image": "https://example.com/spring.png"}}' http://localhost:8080/shorturls/spring
+curl -A 'facebookexternalhit/1.1' http://localhost:8080/go/spring
+
+# redirect type per link: 301, 302 (default), 307, 308, meta (meta refresh page) or js (JavaScript page);
+# only permanent redirects of links without limits may be cached, at most for a day and not beyond validUntil
+curl -X PUT -H 'Content-Type: application/json' -d '{"target": "https://example.com/", "redirectType": "308"}' http://localhost:8080/shorturls/spring
+curl -i http://localhost:8080/go/spring
+
+# custom domain of an organization: publish the returned TXT record (_lnkby.<name> = lnkby-verification=<token>) and verify it;
+# only members of the organization can create, change, delete and verify its domains
+curl -X POST -H 'Authorization: Bearer ...' -H 'Content-Type: application/json' -d '{"name":"go.acme.com", "organizationId": "735aef8a-4d24-11f0-9888-002b67d6b1c3", "fallbackUrl": "https://acme.com"}' http://localhost:8080/domains
+curl -X POST -H 'Authorization: Bearer ...' http://localhost:8080/domains/f81d4fae-7dec-11d0-a765-00a0c91e6bf6/verify
+curl -X PATCH -H 'Authorization: Bearer ...' -H 'Content-Type: application/merge-patch+json' -d '{"fallbackUrl": "https://acme.com/404"}' http://localhost:8080/domains/f81d4fae-7dec-11d0-a765-00a0c91e6bf6
+# the key of a link of a custom domain is its slug there, so the same slug can be used by other domains;
+# links are only created on the verified domains of the organization of the customer and only served there,
+# not by their generated keys on the default domain
+curl -X POST -H 'Authorization: Bearer ...' -H 'Content-Type: application/json' -d '{"target":"https://acme.com/summer", "key": "summer", "domainId": "f81d4fae-7dec-11d0-a765-00a0c91e6bf6"}' http://localhost:8080/shorturls
+curl -i -H 'Host: go.acme.com' http://localhost:8080/go/summer
+# unknown slugs of the domain are redirected to its fallback
+curl -i -H 'Host: go.acme.com' http://localhost:8080/go/winter
+
+# links are served from the root path as well; reserved words (api, ui, shorturls, ...) cannot be custom keys
+curl -i http://localhost:8080/spring
+curl -X POST -H 'Content-Type: application/json' -d '{"target":"http://www.google.com", "key": "ui"}' http://localhost:8080/shorturls
+
+# custom keys follow the key policy (KEY_CHARSET, KEY_MIN_LENGTH, KEY_MAX_LENGTH, KEY_CASE_SENSITIVE, KEY_RESERVED, KEY_BLOCKLIST_FILE)
+# and start with the keyPrefix of the organization of the customer, if it has one
+curl -X PUT -H 'Content-Type: application/json' -d '{"name":"Tsofim", "status": "active", "keyPrefix": "ts-"}' http://localhost:8080/organizations/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl 'http://localhost:8080/shorturls/available?key=ts-summer'
+curl 'http://localhost:8080/shorturls/available?key=summer&domainId=f81d4fae-7dec-11d0-a765-00a0c91e6bf6'
+
+# generated keys are sequential by default; KEY_STRATEGY=random (KEY_RANDOM_LENGTH) or permuted (KEY_PERMUTATION_SECRET) makes them
+# non-guessable for the whole deployment, keyStrategy of an organization does it for its customers only
+curl -X PUT -H 'Content-Type: application/json' -d '{"name":"Tsofim", "status": "active", "keyStrategy": "random"}' http://localhost:8080/organizations/735aef8a-4d24-11f0-9888-002b67d6b1c3
+
+# KEY_ALPHABET=crockford (or lowercase, unambiguous, words) makes generated keys easy to read aloud and case-insensitive
+curl -X PUT -H 'Content-Type: application/json' -d '{"name":"Tsofim", "status": "active", "keyAlphabet": "words"}' http://localhost:8080/organizations/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -v http://localhost:8080/Lusab-Babad
+
+# targets must be absolute http(s) URLs (TARGET_SCHEMES) outside of the short link domains; an organization can restrict them further
+curl -X PUT -H 'Content-Type: application/json' -d '{"name":"Tsofim", "status": "active", "targetAllowlist": ["tsofim.org.il"], "targetDenylist": ["admin.tsofim.org.il"]}' http://localhost:8080/organizations/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -X POST -H 'Content-Type: application/json' -d '{"target":"javascript:alert(1)"}' http://localhost:8080/shorturls
+
+# targets listed in SCREENING_DOMAINS_FILE, SCREENING_HASH_PREFIXES_FILE or SCREENING_RULES_FILE get the suspended status and a warning page
+# instead of the redirect; SCREEN_ON_REDIRECT=true screens active links on every click as well
+curl -X POST -H 'Content-Type: application/json' -d '{"key":"phish", "target":"https://login.phish.example/"}' http://localhost:8080/shorturls
+curl -v http://localhost:8080/phish
+
+# anyone can report a link; moderators (the ADMIN_GROUP Cognito group or ADMIN_USERS) review the queue, suspend or restore links,
+# dismiss reports and ban customers, and every action is audited. The server verifies the tokens of moderators with the keys of
+# JWKS_URL (https://cognito-idp.<region>.amazonaws.com/<user pool ID>/.well-known/jwks.json), the lambdas rely on the JWT authorizer
+curl -X POST -H 'Content-Type: application/json' -d '{"reason":"phishing", "details":"asks for my bank password", "contact":"me@example.com"}' http://localhost:8080/shorturls/spring/report
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/reports?status=open'
+curl -X POST -H 'Authorization: Bearer ...' -d '{"note":"confirmed phishing"}' http://localhost:8080/shorturls/spring/suspend
+curl -X POST -H 'Authorization: Bearer ...' http://localhost:8080/shorturls/spring/restore
+curl -X POST -H 'Authorization: Bearer ...' -d '{"note":"not abusive"}' http://localhost:8080/reports/2f1c1e2a-4d24-11f0-9888-002b67d6b1c3/dismiss
+curl -X POST -H 'Authorization: Bearer ...' -d '{"note":"repeated spam"}' http://localhost:8080/customers/ff1c1e2a-4d24-11f0-9888-002b67d6b1c3/ban
+curl -H 'Authorization: Bearer ...' http://localhost:8080/moderations
+
+# targets of active links are checked every HEALTH_CHECK_INTERVAL (24h): status code, latency and the URL reached after redirects;
+# links failing HEALTH_BROKEN_AFTER checks in a row are flagged as broken. Try it out against the local stub:
+#   go run ./server/cli stub &   (targets use 127.0.0.1: localhost is the short link host, so it would be rejected as a loop)
+#   HEALTH_CHECK_INTERVAL=1m HEALTH_BROKEN_AFTER=1 HEALTH_CHECK_ALLOW_PRIVATE=true go run ./server
+curl -X POST -H 'Content-Type: application/json' -d '{"key":"gone", "target":"http://127.0.0.1:8081/status/404"}' http://localhost:8080/shorturls
+curl -X POST -H 'Content-Type: application/json' -d '{"key":"moved", "target":"http://127.0.0.1:8081/redirect/3"}' http://localhost:8080/shorturls
+curl http://localhost:8080/shorturls/gone/health
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/shorturls/health?broken=true'
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/shorturls/health?broken=true&sort=-failures&limit=20'
+
+# "reuse": true returns the existing plain link of the same owner to the same target (with "reused": true) instead of creating another one
+curl -X POST -H 'Content-Type: application/json' -d '{"target":"https://www.wikipedia.org/", "reuse": true}' http://localhost:8080/shorturls
+curl -X POST -H 'Content-Type: application/json' -d '{"target":"https://www.wikipedia.org/", "reuse": true}' http://localhost:8080/shorturls
+
+# tags of links and campaigns; the list of short URLs is filtered by tag (of the link or its campaign), campaignId, status (active by default),
+# domain of the target (subdomains included), createdFrom/createdUntil (RFC 3339) and q (searched in the key, the target and the Open Graph title)
+curl -X POST -H 'Content-Type: application/json' -d '{"target":"https://blog.example.com/summer", "tags": ["Summer", "sale"]}' http://localhost:8080/shorturls
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/shorturls?tag=summer&domain=example.com&q=summer&createdFrom=2025-06-01T00:00:00Z'
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/shorturls?status=cancelled&campaignId=735aef8a-4d24-11f0-9888-002b67d6b1c3&offset=0&limit=20'
+
+# lists asked for with sort, cursor, offset or limit return {"items": [...], "next": "...", "total": N}: pages of 100 items by default
+# (limit is at most 1000), the next one is asked for with cursor=<next>; sort by one of the fields of the entity, prefixed with - for
+# descending order. Without these parameters lists return a plain array of the first 1000 items (they used to return all of them).
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/campaigns?sort=-createdAt&limit=20&tag=summer'
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/campaigns?sort=-createdAt&limit=20&tag=summer&cursor=eyJzIjoiLWNyZWF0ZWRBdCIsInYiOiIuLi4iLCJpIjoiLi4uIn0'
+curl -H 'Authorization: Bearer ...' 'http://localhost:8080/domains?verified=true&sort=name'
+
+# PATCH updates only the given fields (JSON Merge Patch, RFC 7386: null removes a field) and validates the result like PUT
+curl -X PATCH -H 'Content-Type: application/merge-patch+json' -d '{"name":"Spring sale"}' http://localhost:8080/campaigns/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -X PATCH -H 'Content-Type: application/merge-patch+json' -H 'Authorization: Bearer ...' -d '{"tags": ["spring"], "openGraph": null}' http://localhost:8080/shorturls/spring
+# removed limits and validity are reset: the link becomes unlimited and valid until 2050
+curl -X PATCH -H 'Content-Type: application/merge-patch+json' -H 'Authorization: Bearer ...' -d '{"totalLimit": null, "validUntil": null}' http://localhost:8080/shorturls/spring
+curl -X PATCH -H 'Content-Type: application/merge-patch+json' -d '{"configuration": {"title": "Spring"}}' http://localhost:8080/landingpages/735aef8a-4d24-11f0-9888-002b67d6b1c3
+
+# retrieve returns the ETag of the entity: GET with If-None-Match returns 304 while it is unchanged, and PUT, PATCH or DELETE
+# with If-Match fail with 412 if someone else has changed it in the meantime (then retrieve it again)
+curl -i http://localhost:8080/campaigns/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -i -H 'If-None-Match: "sxq1yb2ogw"' http://localhost:8080/campaigns/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -i -X PATCH -H 'Content-Type: application/merge-patch+json' -H 'If-Match: "sxq1yb2ogw"' -d '{"name":"Spring sale"}' http://localhost:8080/campaigns/735aef8a-4d24-11f0-9888-002b67d6b1c3
+curl -i -X DELETE -H 'If-Match: "sxq1yb2ogw"' http://localhost:8080/campaigns/735aef8a-4d24-11f0-9888-002b67d6b1c3
+
+# QR code of a short link (PNG by default); scans are counted separately as the encoded link carries ?src=qr
+curl -o ubt.png 'http://localhost:8080/shorturls/ubt/qr?size=512&margin=2&level=Q&fg=1a237e&bg=ffffff'
+curl -o ubt.svg 'http://localhost:8080/shorturls/ubt/qr?format=svg&logo=https://lnkby.s3.amazonaws.com/ui/logo.png'
+
+# export of everything the organization owns (tar.gz with JSON lines per table and landing page configurations) and its restore;
+# members restore the archives of their organizations, administrators any archive; short URLs are checked like created ones
+curl -H 'Authorization: Bearer ...' -OJ http://localhost:8080/organizations/e8a6ba4a-4d24-11f0-9888-002b67d6b1c3/export
+curl -X POST -H 'Authorization: Bearer ...' -H 'Content-Type: application/gzip' --data-binary @lnkby-e8a6ba4a-4d24-11f0-9888-002b67d6b1c3-20250101.tar.gz http://localhost:8080/organizations/restore
+# the same from the command line
+go run ./server/cli export -organization e8a6ba4a-4d24-11f0-9888-002b67d6b1c3
+go run ./server/cli restore lnkby-e8a6ba4a-4d24-11f0-9888-002b67d6b1c3-20250101.tar.gz
+
 
 
 
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSURLEnv names the key set the tokens are signed with, e.g. https://cognito-idp.<region>.amazonaws.com/<user pool ID>/.well-known/jwks.json.
+// The tokens must be issued by the same URL without the /.well-known/jwks.json suffix, like the tokens of Cognito user pools.
+const JWKSURLEnv = "JWKS_URL"
+
+const jwksSuffix = "/.well-known/jwks.json"
+
+var ErrJWKSNotConfigured = errors.New(JWKSURLEnv + " is not set, tokens cannot be verified")
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// keySet caches the public keys of the JWKS by their key ID; unknown key IDs reload it, as the keys are rotated.
+var keySet = struct {
+	sync.Mutex
+	url  string
+	keys map[string]*rsa.PublicKey
+}{}
+
+type jwks struct {
+	Keys []struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// VerifyBearer verifies the signature, the issuer and the expiry of the bearer token of the Authorization header
+// and returns its claims. Unlike service.GetUUIDFromAuthorization, it can be trusted for authorization.
+func VerifyBearer(ctx context.Context, authHeader string) (jwt.MapClaims, error) {
+	jwksURL := os.Getenv(JWKSURLEnv)
+	if jwksURL == "" {
+		return nil, ErrJWKSNotConfigured
+	}
+	tokenString, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok {
+		return nil, errors.New("bearer token is required")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return publicKey(ctx, jwksURL, kid)
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(strings.TrimSuffix(jwksURL, jwksSuffix)), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %w", err)
+	}
+	return claims, nil
+}
+
+func publicKey(ctx context.Context, jwksURL string, kid string) (*rsa.PublicKey, error) {
+	keySet.Lock()
+	defer keySet.Unlock()
+
+	if keySet.url == jwksURL {
+		if key, ok := keySet.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	keys, err := loadKeys(ctx, jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	keySet.url, keySet.keys = jwksURL, keys
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func loadKeys(ctx context.Context, jwksURL string) (map[string]*rsa.PublicKey, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request %s: %w", jwksURL, err)
+	}
+	response, err := jwksClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", jwksURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to load %s: status %d", jwksURL, response.StatusCode)
+	}
+
+	var set jwks
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", jwksURL, err)
+	}
+	return parseKeys(set)
+}
+
+func parseKeys(set jwks) (map[string]*rsa.PublicKey, error) {
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// Groups returns the cognito:groups claim of verified claims.
+func Groups(claims jwt.MapClaims) []string {
+	values, _ := claims["cognito:groups"].([]interface{})
+	groups := make([]string, 0, len(values))
+	for _, value := range values {
+		if group, ok := value.(string); ok {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
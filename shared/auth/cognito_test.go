@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyBearer(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer server.Close()
+
+	sign := func(claims jwt.MapClaims, kid string, key *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err)
+		return "Bearer " + signed
+	}
+	valid := jwt.MapClaims{"sub": "u1", "iss": server.URL, "exp": time.Now().Add(time.Hour).Unix(), "cognito:groups": []string{"admin"}}
+
+	t.Setenv(JWKSURLEnv, "")
+	_, err = VerifyBearer(context.Background(), sign(valid, "k1", key))
+	assert.ErrorIs(t, err, ErrJWKSNotConfigured)
+
+	t.Setenv(JWKSURLEnv, server.URL+jwksSuffix)
+	claims, err := VerifyBearer(context.Background(), sign(valid, "k1", key))
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", claims["sub"])
+	assert.Equal(t, []string{"admin"}, Groups(claims))
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, err = VerifyBearer(context.Background(), sign(valid, "k1", other))
+	assert.Error(t, err)
+	_, err = VerifyBearer(context.Background(), sign(valid, "k2", key))
+	assert.Error(t, err)
+	_, err = VerifyBearer(context.Background(), sign(jwt.MapClaims{"sub": "u1", "iss": "https://elsewhere", "exp": time.Now().Add(time.Hour).Unix()}, "k1", key))
+	assert.Error(t, err)
+	_, err = VerifyBearer(context.Background(), sign(jwt.MapClaims{"sub": "u1", "iss": server.URL, "exp": time.Now().Add(-time.Hour).Unix()}, "k1", key))
+	assert.Error(t, err)
+	_, err = VerifyBearer(context.Background(), "header.payload.signature")
+	assert.Error(t, err)
+}
@@ -2,6 +2,23 @@ CREATE TABLE IF NOT EXISTS organization (
 	id UUID PRIMARY KEY,
 	name VARCHAR(255) NOT NULL,
 	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted')),
+	key_prefix VARCHAR(16) NOT NULL DEFAULT '',
+	key_strategy VARCHAR(16) NOT NULL DEFAULT '' CHECK (key_strategy IN ('', 'sequential', 'random', 'permuted')),
+	key_alphabet VARCHAR(16) NOT NULL DEFAULT '' CHECK (key_alphabet IN ('', 'base62', 'crockford', 'lowercase', 'unambiguous', 'words')),
+	target_allowlist TEXT[],
+	target_denylist TEXT[],
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS domain (
+	id UUID PRIMARY KEY,
+	name VARCHAR(253) NOT NULL,
+	organization_id UUID NOT NULL REFERENCES organization(id),
+	verification_token VARCHAR(64) NOT NULL,
+	verified_at TIMESTAMPTZ,
+	fallback_url VARCHAR(2048) NOT NULL DEFAULT '',
+	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted')),
 	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
@@ -11,7 +28,7 @@ CREATE TABLE IF NOT EXISTS customer (
 	email VARCHAR(255) NOT NULL,
 	name VARCHAR(255) NOT NULL,
     organization_id UUID REFERENCES organization(id),
-	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted')),
+	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted', 'banned')),
 	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
@@ -24,6 +41,8 @@ CREATE TABLE IF NOT EXISTS campaign (
 	organization_id UUID REFERENCES organization(id),
 	customer_id UUID REFERENCES customer(id),
 	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted')),
+	utm JSONB,
+	tags TEXT[] NOT NULL DEFAULT '{}',
 	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
@@ -36,10 +55,19 @@ CREATE TABLE IF NOT EXISTS shorturl (
     valid_until TIMESTAMPTZ NOT NULL DEFAULT '2050-01-01 00:00:00+00',
 	campaign_id UUID REFERENCES campaign(id),
 	customer_id UUID REFERENCES customer(id),
-	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted')),
+	status VARCHAR(16) CHECK (status IN ('active', 'cancelled', 'deleted', 'suspended')),
 	total_limit int NOT NULL DEFAULT 2147483647,
 	daily_limit int NOT NULL DEFAULT 2147483647,
 	hourly_limit int NOT NULL DEFAULT 2147483647,
+	utm JSONB,
+	passthrough VARCHAR(16) NOT NULL DEFAULT 'none' CHECK (passthrough IN ('none', 'append', 'override')),
+	interstitial_delay INT NOT NULL DEFAULT 0,
+	open_graph JSONB,
+	redirect_type VARCHAR(8) NOT NULL DEFAULT '302' CHECK (redirect_type IN ('301', '302', '307', '308', 'meta', 'js')),
+	domain_id UUID REFERENCES domain(id),
+	slug VARCHAR(32),
+	tags TEXT[] NOT NULL DEFAULT '{}',
+	case_insensitive BOOLEAN NOT NULL DEFAULT FALSE,
 	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
@@ -58,6 +86,94 @@ CREATE TABLE IF NOT EXISTS landingpage (
 	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
 );
 
+-- snowflake machine IDs of the replicas started with MACHINE_ID=lease
+CREATE TABLE IF NOT EXISTS machine_lease (
+	machine_id INT PRIMARY KEY CHECK (machine_id BETWEEN 0 AND 1023),
+	owner VARCHAR(255) NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- latest check of the target of every active link; claimed_at schedules the checks, checked_at is set once a check is done
+CREATE TABLE IF NOT EXISTS link_health (
+	key VARCHAR(32) PRIMARY KEY REFERENCES shorturl(key) ON DELETE CASCADE,
+	claimed_at TIMESTAMPTZ NOT NULL,
+	checked_at TIMESTAMPTZ,
+	status_code INT NOT NULL DEFAULT 0,
+	latency_ms INT NOT NULL DEFAULT 0,
+	final_url VARCHAR(2048) NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	failures INT NOT NULL DEFAULT 0,
+	broken BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- titles of the pages of targets shown by previews, fetched once per target; empty if the page has none or cannot be fetched
+CREATE TABLE IF NOT EXISTS target_title (
+	target VARCHAR(2048) PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT '',
+	fetched_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- reports of short URLs by the public, reviewed by moderators
+CREATE TABLE IF NOT EXISTS abuse_report (
+	id UUID PRIMARY KEY,
+	key VARCHAR(32) NOT NULL,
+	reason VARCHAR(16) NOT NULL CHECK (reason IN ('phishing', 'malware', 'spam', 'illegal', 'other')),
+	details TEXT NOT NULL DEFAULT '',
+	contact VARCHAR(255) NOT NULL DEFAULT '',
+	status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	resolved_at TIMESTAMPTZ
+);
+
+-- audit of the actions of moderators
+CREATE TABLE IF NOT EXISTS moderation_action (
+	id UUID PRIMARY KEY,
+	action VARCHAR(16) NOT NULL CHECK (action IN ('suspend', 'restore', 'ban', 'dismiss')),
+	key VARCHAR(32),
+	customer_id UUID,
+	report_id UUID,
+	moderator_id UUID NOT NULL,
+	note TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- columns added after the tables were created
+ALTER TABLE organization ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE organization ADD COLUMN IF NOT EXISTS key_strategy VARCHAR(16) NOT NULL DEFAULT '' CHECK (key_strategy IN ('', 'sequential', 'random', 'permuted'));
+ALTER TABLE organization ADD COLUMN IF NOT EXISTS key_alphabet VARCHAR(16) NOT NULL DEFAULT '' CHECK (key_alphabet IN ('', 'base62', 'crockford', 'lowercase', 'unambiguous', 'words'));
+ALTER TABLE organization ADD COLUMN IF NOT EXISTS target_allowlist TEXT[];
+ALTER TABLE organization ADD COLUMN IF NOT EXISTS target_denylist TEXT[];
+ALTER TABLE campaign ADD COLUMN IF NOT EXISTS utm JSONB;
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS utm JSONB;
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS passthrough VARCHAR(16) NOT NULL DEFAULT 'none' CHECK (passthrough IN ('none', 'append', 'override'));
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS interstitial_delay INT NOT NULL DEFAULT 0;
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS open_graph JSONB;
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS redirect_type VARCHAR(8) NOT NULL DEFAULT '302' CHECK (redirect_type IN ('301', '302', '307', '308', 'meta', 'js'));
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS domain_id UUID REFERENCES domain(id);
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS slug VARCHAR(32);
+UPDATE shorturl SET slug = key WHERE slug IS NULL;
+ALTER TABLE shorturl DROP CONSTRAINT IF EXISTS shorturl_status_check;
+ALTER TABLE shorturl ADD CONSTRAINT shorturl_status_check CHECK (status IN ('active', 'cancelled', 'deleted', 'suspended'));
+ALTER TABLE customer DROP CONSTRAINT IF EXISTS customer_status_check;
+ALTER TABLE customer ADD CONSTRAINT customer_status_check CHECK (status IN ('active', 'cancelled', 'deleted', 'banned'));
+ALTER TABLE campaign ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE shorturl ADD COLUMN IF NOT EXISTS case_insensitive BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- search of short URLs, see shorturl.ListSQL
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- the host of the target reversed and followed by a dot, so a LIKE prefix matches the domain and its subdomains
+CREATE OR REPLACE FUNCTION reversed_target_host(target TEXT)
+RETURNS TEXT AS $$
+  SELECT reverse(lower(substring(target from '^[a-z][a-z0-9+.-]*://([^/:?#]+)'))) || '.';
+$$ LANGUAGE sql IMMUTABLE;
+
+-- the text searched by the q parameter of the list of short URLs
+CREATE OR REPLACE FUNCTION shorturl_search_text(key TEXT, target TEXT, open_graph JSONB)
+RETURNS TEXT AS $$
+  SELECT lower(key || ' ' || target || ' ' || COALESCE(open_graph->>'title', ''));
+$$ LANGUAGE sql IMMUTABLE;
 
 CREATE INDEX IF NOT EXISTS idx_customer_by_organization ON customer(organization_id);
 
@@ -69,10 +185,38 @@ CREATE INDEX IF NOT EXISTS idx_shorturl_customer ON shorturl(customer_id);
 
 CREATE INDEX IF NOT EXISTS idx_shorturl_campaign ON shorturl(campaign_id);
 
+-- links to reuse for the same target, see shorturl.ReuseSQL
+CREATE INDEX IF NOT EXISTS idx_shorturl_reusable ON shorturl(target) WHERE status = 'active' AND NOT is_custom;
+
+CREATE INDEX IF NOT EXISTS idx_shorturl_tags ON shorturl USING GIN (tags);
+
+CREATE INDEX IF NOT EXISTS idx_campaign_tags ON campaign USING GIN (tags);
+
+CREATE INDEX IF NOT EXISTS idx_shorturl_target_host ON shorturl(reversed_target_host(target) text_pattern_ops);
+
+CREATE INDEX IF NOT EXISTS idx_shorturl_search ON shorturl USING GIN (shorturl_search_text(key, target, open_graph) gin_trgm_ops);
+
+CREATE INDEX IF NOT EXISTS idx_shorturl_created ON shorturl(customer_id, created_at);
+
+-- keys are unique globally, slugs only within their domain
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shorturl_domain_slug ON shorturl(domain_id, slug) WHERE domain_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_domain_org ON domain(organization_id);
+
+-- any organization may claim a name, but only one can verify it
+ALTER TABLE domain DROP CONSTRAINT IF EXISTS domain_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_verified_name ON domain(name) WHERE verified_at IS NOT NULL;
+
 CREATE INDEX IF NOT EXISTS idx_landingpage_customer ON landingpage(customer_id);
 
 CREATE INDEX IF NOT EXISTS idx_landingpage_org ON landingpage(organization_id);
 
+CREATE INDEX IF NOT EXISTS idx_link_health_claimed ON link_health(claimed_at);
+
+CREATE INDEX IF NOT EXISTS idx_abuse_report_queue ON abuse_report(status, created_at);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_action_created ON moderation_action(created_at);
+
 
 CREATE OR REPLACE FUNCTION set_updated_at()
 RETURNS TRIGGER AS $$
@@ -98,12 +242,31 @@ CREATE TRIGGER set_updated_at_shorturl_trigger BEFORE UPDATE ON shorturl FOR EAC
 DROP TRIGGER IF EXISTS set_updated_at_landingpage_trigger ON landingpage;
 CREATE TRIGGER set_updated_at_landingpage_trigger BEFORE UPDATE ON landingpage FOR EACH ROW EXECUTE FUNCTION set_updated_at();
 
+DROP TRIGGER IF EXISTS set_updated_at_domain_trigger ON domain;
+CREATE TRIGGER set_updated_at_domain_trigger BEFORE UPDATE ON domain FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- links inserted without a slug (e.g. restored from archives made before custom domains) are reachable by their keys
+CREATE OR REPLACE FUNCTION set_shorturl_slug()
+RETURNS TRIGGER AS $$
+BEGIN
+  NEW.slug = COALESCE(NEW.slug, NEW.key);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS set_shorturl_slug_trigger ON shorturl;
+CREATE TRIGGER set_shorturl_slug_trigger BEFORE INSERT ON shorturl FOR EACH ROW EXECUTE FUNCTION set_shorturl_slug();
+
 -- statistics
 CREATE TABLE IF NOT EXISTS total_count (
 	key VARCHAR(32) PRIMARY KEY,
-	total INT NOT NULL DEFAULT 0
+	total INT NOT NULL DEFAULT 0,
+	qr INT NOT NULL DEFAULT 0
 );
 
+-- scans of QR codes, counted since the column was added
+ALTER TABLE total_count ADD COLUMN IF NOT EXISTS qr INT NOT NULL DEFAULT 0;
+
 CREATE TABLE IF NOT EXISTS daily_count (
     key VARCHAR(32) PRIMARY KEY,
     day001 INT NOT NULL DEFAULT 0,
@@ -6,10 +6,38 @@ DROP INDEX IF EXISTS idx_campaign_org;
 
 DROP INDEX IF EXISTS idx_shorturl_campaign;
 
+DROP INDEX IF EXISTS idx_shorturl_reusable;
+
+DROP INDEX IF EXISTS idx_shorturl_tags;
+
+DROP INDEX IF EXISTS idx_campaign_tags;
+
+DROP INDEX IF EXISTS idx_shorturl_target_host;
+
+DROP INDEX IF EXISTS idx_shorturl_search;
+
+DROP INDEX IF EXISTS idx_shorturl_created;
+
+DROP INDEX IF EXISTS idx_shorturl_domain_slug;
+
+DROP INDEX IF EXISTS idx_domain_org;
+
+DROP INDEX IF EXISTS idx_domain_verified_name;
+
+DROP INDEX IF EXISTS idx_link_health_claimed;
+
+DROP INDEX IF EXISTS idx_abuse_report_queue;
+
+DROP INDEX IF EXISTS idx_moderation_action_created;
+
 DROP TABLE IF EXISTS idx_landingpage_org;
 
 DROP TABLE IF EXISTS idx_landingpage_customer;
 
+DROP TABLE IF EXISTS link_health;
+
+DROP TABLE IF EXISTS target_title;
+
 DROP TABLE IF EXISTS shorturl;
 
 DROP TABLE IF EXISTS landingpage;
@@ -18,8 +46,16 @@ DROP TABLE IF EXISTS campaign;
 
 DROP TABLE IF EXISTS customer;
 
+DROP TABLE IF EXISTS domain;
+
 DROP TABLE IF EXISTS organization;
 
+DROP TABLE IF EXISTS machine_lease;
+
+DROP TABLE IF EXISTS abuse_report;
+
+DROP TABLE IF EXISTS moderation_action;
+
 DROP TABLE IF EXISTS total_count;
 
 DROP TABLE IF EXISTS daily_count;
@@ -29,3 +65,7 @@ DROP TABLE IF EXISTS hourly_count;
 DROP TABLE IF EXISTS useragent_count;
 
 DROP TABLE IF EXISTS country_count;
+
+DROP FUNCTION IF EXISTS reversed_target_host;
+
+DROP FUNCTION IF EXISTS shorturl_search_text;
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -74,6 +75,15 @@ func Get(ctx context.Context) (*pgxpool.Conn, error) {
 	return conn, nil
 }
 
+func Begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return tx, nil
+}
+
 func RunScript(ctx context.Context, path string) error {
 	content, err := os.ReadFile(path)
 	if err != nil {
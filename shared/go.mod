@@ -10,7 +10,9 @@ require (
 	github.com/jackc/pgx/v5 v5.7.5
 	github.com/mileusna/useragent v1.3.5
 	github.com/oschwald/geoip2-golang v1.13.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/net v0.41.0
 )
 
 require (
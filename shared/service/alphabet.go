@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"slices"
+	"strings"
+)
+
+// Alphabets of generated keys: base62 is the shortest, the others are easier to read aloud or to type.
+const (
+	AlphabetBase62      = "base62"
+	AlphabetCrockford   = "crockford"   // Crockford's base32 in lower case, without i, l, o and u
+	AlphabetLowercase   = "lowercase"   // digits and lower-case letters
+	AlphabetUnambiguous = "unambiguous" // lower-case without look-alikes: 0, 1, i, l, o
+	AlphabetWords       = "words"       // pronounceable proquints like "lusab-babad"
+)
+
+// Alphabet encodes numbers and random values as keys.
+type Alphabet interface {
+	Encode(n uint64) string
+	Random(length int) string
+	// Normalize maps a key typed by a human to the key as it was generated; case-sensitive alphabets return it as is.
+	Normalize(key string) string
+	CaseInsensitive() bool
+}
+
+var Alphabets = map[string]Alphabet{
+	AlphabetBase62:      charset{chars: base62Chars},
+	AlphabetCrockford:   charset{chars: "0123456789abcdefghjkmnpqrstvwxyz", caseInsensitive: true, lookAlikes: strings.NewReplacer("i", "1", "l", "1", "o", "0")},
+	AlphabetLowercase:   charset{chars: "0123456789abcdefghijklmnopqrstuvwxyz", caseInsensitive: true},
+	AlphabetUnambiguous: charset{chars: "23456789abcdefghjkmnpqrstuvwxyz", caseInsensitive: true},
+	AlphabetWords:       proquint{},
+}
+
+func IsAlphabet(alphabet string) bool {
+	_, ok := Alphabets[alphabet]
+	return ok
+}
+
+// AlphabetNames returns the names of the alphabets in a stable order.
+func AlphabetNames() []string {
+	names := make([]string, 0, len(Alphabets))
+	for name := range Alphabets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+type charset struct {
+	chars           string
+	caseInsensitive bool
+	lookAlikes      *strings.Replacer // replaces characters that are not in the alphabet by the ones they are mistaken for
+}
+
+func (c charset) Encode(n uint64) string {
+	if n == 0 {
+		return c.chars[:1]
+	}
+	base := uint64(len(c.chars))
+	result := make([]byte, 0)
+	for n > 0 {
+		result = append([]byte{c.chars[n%base]}, result...)
+		n /= base
+	}
+	return string(result)
+}
+
+func (c charset) Random(length int) string {
+	// the largest multiple of the size of the alphabet not exceeding 256, so the remainders are uniform
+	limit := 256 - 256%len(c.chars)
+	key := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(key) < length {
+		_, _ = rand.Read(buf) // never returns an error
+		for _, b := range buf {
+			if int(b) < limit && len(key) < length {
+				key = append(key, c.chars[int(b)%len(c.chars)])
+			}
+		}
+	}
+	return string(key)
+}
+
+func (c charset) CaseInsensitive() bool {
+	return c.caseInsensitive
+}
+
+func (c charset) Normalize(key string) string {
+	if !c.caseInsensitive {
+		return key
+	}
+	key = strings.ToLower(key)
+	if c.lookAlikes != nil {
+		key = c.lookAlikes.Replace(key)
+	}
+	return key
+}
+
+const (
+	proquintConsonants = "bdfghjklmnprstvz"
+	proquintVowels     = "aiou"
+	maxRandomQuints    = 5 // 29 characters, the key column holds 32
+)
+
+// proquint encodes every 16 bits as a consonant-vowel-consonant-vowel-consonant "word", the words are separated by dashes.
+type proquint struct{}
+
+func (proquint) Encode(n uint64) string {
+	quints := make([]string, 0, 4)
+	for i := 3; i >= 0; i-- {
+		q := uint16(n >> (16 * i))
+		if q != 0 || len(quints) > 0 || i == 0 {
+			quints = append(quints, quint(q))
+		}
+	}
+	return strings.Join(quints, "-")
+}
+
+// Random returns at least two words (32 bits) and adds a word per 5 characters of the length.
+func (proquint) Random(length int) string {
+	count := min(max(2, (length+4)/5), maxRandomQuints)
+	buf := make([]byte, 2*count)
+	_, _ = rand.Read(buf) // never returns an error
+	quints := make([]string, count)
+	for i := range quints {
+		quints[i] = quint(binary.BigEndian.Uint16(buf[2*i:]))
+	}
+	return strings.Join(quints, "-")
+}
+
+func (proquint) CaseInsensitive() bool {
+	return true
+}
+
+func (proquint) Normalize(key string) string {
+	return strings.ToLower(key)
+}
+
+func quint(q uint16) string {
+	return string([]byte{
+		proquintConsonants[q>>12&0xf],
+		proquintVowels[q>>10&0x3],
+		proquintConsonants[q>>6&0xf],
+		proquintVowels[q>>4&0x3],
+		proquintConsonants[q&0xf],
+	})
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlphabetEncode(t *testing.T) {
+	assert.Equal(t, "0", Alphabets[AlphabetBase62].Encode(0))
+	assert.Equal(t, base62Chars[61:], Alphabets[AlphabetBase62].Encode(61))
+	assert.Equal(t, "10", Alphabets[AlphabetBase62].Encode(62))
+	assert.Equal(t, "z", Alphabets[AlphabetCrockford].Encode(31))
+	assert.Equal(t, "10", Alphabets[AlphabetLowercase].Encode(36))
+	assert.Equal(t, "2", Alphabets[AlphabetUnambiguous].Encode(0))
+
+	assert.Equal(t, "babab", Alphabets[AlphabetWords].Encode(0))
+	assert.Equal(t, "babad", Alphabets[AlphabetWords].Encode(1))
+	assert.Equal(t, "babad-babab", Alphabets[AlphabetWords].Encode(1<<16))
+}
+
+func TestAlphabetRandom(t *testing.T) {
+	for _, name := range AlphabetNames() {
+		if name == AlphabetWords {
+			continue
+		}
+		chars := Alphabets[name].(charset).chars
+		key := Alphabets[name].Random(10)
+		assert.Len(t, key, 10, name)
+		assert.Equal(t, -1, strings.IndexFunc(key, func(r rune) bool { return !strings.ContainsRune(chars, r) }), name)
+	}
+
+	assert.Len(t, strings.Split(Alphabets[AlphabetWords].Random(1), "-"), 2)
+	assert.Len(t, strings.Split(Alphabets[AlphabetWords].Random(15), "-"), 3)
+	assert.Len(t, Alphabets[AlphabetWords].Random(100), 29)
+}
+
+func TestAlphabetNormalize(t *testing.T) {
+	assert.Equal(t, "AbC", Alphabets[AlphabetBase62].Normalize("AbC"))
+	assert.Equal(t, "abc10", Alphabets[AlphabetCrockford].Normalize("ABCLO"))
+	assert.Equal(t, "abclo", Alphabets[AlphabetLowercase].Normalize("ABCLO"))
+	assert.Equal(t, "lusab-babad", Alphabets[AlphabetWords].Normalize("Lusab-Babad"))
+}
+
+func TestIsAlphabet(t *testing.T) {
+	assert.True(t, IsAlphabet(AlphabetCrockford))
+	assert.False(t, IsAlphabet("emoji"))
+	assert.Equal(t, []string{AlphabetBase62, AlphabetCrockford, AlphabetLowercase, AlphabetUnambiguous, AlphabetWords}, AlphabetNames())
+}
@@ -0,0 +1,393 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/landingpage"
+	"github.com/lnk.by/shared/service/shorturl"
+)
+
+const (
+	Format  = "lnk.by-export"
+	Version = 1
+
+	ContentType = "application/gzip"
+
+	manifestFile   = "manifest.json"
+	configurations = "landingpages/conf/"
+)
+
+// Manifest describes the archive; it is the first file of the archive.
+type Manifest struct {
+	Format                string         `json:"format"`
+	Version               int            `json:"version"`
+	OrganizationID        uuid.UUID      `json:"organizationId"`
+	CreatedAt             time.Time      `json:"createdAt"`
+	Counts                map[string]int `json:"counts"`
+	MissingConfigurations []string       `json:"missingConfigurations,omitempty"`
+}
+
+type TableReport struct {
+	Restored int `json:"restored"`
+	Skipped  int `json:"skipped"`
+}
+
+// RestoreReport counts the restored rows per table; rows that already exist in the deployment are skipped.
+type RestoreReport struct {
+	OrganizationID uuid.UUID               `json:"organizationId"`
+	Tables         map[string]*TableReport `json:"tables"`
+	Configurations int                     `json:"configurations"`
+}
+
+// table is exported to (and restored from) its own JSON lines file; the order of tables respects foreign keys.
+type table struct {
+	name      string
+	exportSQL string
+}
+
+const (
+	customersSQL = "SELECT id FROM customer WHERE organization_id = $1"
+	campaignsSQL = "SELECT id FROM campaign WHERE organization_id = $1 OR customer_id IN (" + customersSQL + ")"
+	keysSQL      = "SELECT key FROM shorturl WHERE customer_id IN (" + customersSQL + ") OR campaign_id IN (" + campaignsSQL + ")"
+)
+
+var tables = []table{
+	{"organization", "SELECT row_to_json(t) FROM organization t WHERE t.id = $1"},
+	{"domain", "SELECT row_to_json(t) FROM domain t WHERE t.organization_id = $1"},
+	{"customer", "SELECT row_to_json(t) FROM customer t WHERE t.id IN (" + customersSQL + ")"},
+	{"campaign", "SELECT row_to_json(t) FROM campaign t WHERE t.id IN (" + campaignsSQL + ")"},
+	{"landingpage", "SELECT row_to_json(t) FROM landingpage t WHERE t.organization_id = $1 OR t.customer_id IN (" + customersSQL + ")"},
+	{"shorturl", "SELECT row_to_json(t) FROM shorturl t WHERE t.key IN (" + keysSQL + ")"},
+	{"total_count", "SELECT row_to_json(t) FROM total_count t WHERE t.key IN (" + keysSQL + ")"},
+	{"daily_count", "SELECT row_to_json(t) FROM daily_count t WHERE t.key IN (" + keysSQL + ")"},
+	{"hourly_count", "SELECT row_to_json(t) FROM hourly_count t WHERE t.key IN (" + keysSQL + ")"},
+	{"useragent_count", "SELECT row_to_json(t) FROM useragent_count t WHERE t.key IN (" + keysSQL + ")"},
+	{"country_count", "SELECT row_to_json(t) FROM country_count t WHERE t.key IN (" + keysSQL + ")"},
+}
+
+var CanExportSQL = "SELECT count(*) FROM customer WHERE id = $1 AND organization_id = $2 AND status = 'active'"
+
+func restoreSQL(table string) string {
+	return fmt.Sprintf("INSERT INTO %[1]s SELECT * FROM json_populate_record(NULL::%[1]s, $1::json) ON CONFLICT DO NOTHING", table)
+}
+
+func fileName(table string) string {
+	return table + ".jsonl"
+}
+
+// ArchiveName is the suggested name of the file the archive is downloaded to.
+func ArchiveName(organizationID uuid.UUID, at time.Time) string {
+	return fmt.Sprintf("lnkby-%s-%s.tar.gz", organizationID, at.UTC().Format("20060102"))
+}
+
+// CanExport checks that the user belongs to the organization.
+func CanExport(ctx context.Context, userID *uuid.UUID, organizationID string) (int, uuid.UUID, error) {
+	id, err := uuid.FromString(organizationID)
+	if err != nil {
+		return http.StatusNotFound, id, fmt.Errorf("failed to parse organization ID: %v: %w", organizationID, err)
+	}
+	if userID == nil {
+		return http.StatusUnauthorized, id, errors.New("authentication is required to export data")
+	}
+
+	return service.InTransaction(ctx, func(tx pgx.Tx) (int, uuid.UUID, error) {
+		var count int
+		if err := tx.QueryRow(ctx, CanExportSQL, userID, id).Scan(&count); err != nil {
+			return http.StatusInternalServerError, id, fmt.Errorf("failed to check membership in organization %v: %w", id, err)
+		}
+		if count == 0 {
+			return http.StatusForbidden, id, fmt.Errorf("customer %v does not belong to organization %v", userID, id)
+		}
+		return http.StatusOK, id, nil
+	})
+}
+
+// Authorizer checks that the caller may restore the archive of the organization.
+type Authorizer func(ctx context.Context, organizationID uuid.UUID) (int, error)
+
+// Anyone lets the command line restore any archive: it already has the credentials of the DB.
+var Anyone Authorizer = func(ctx context.Context, organizationID uuid.UUID) (int, error) {
+	return http.StatusOK, nil
+}
+
+// CanRestore lets administrators restore any archive and other users only the archives of their organizations, like CanExport.
+// The subject and the groups must come from a verified token, see auth.VerifyBearer.
+func CanRestore(sub string, groups []string) Authorizer {
+	return func(ctx context.Context, organizationID uuid.UUID) (int, error) {
+		if service.IsAdmin(sub, groups) {
+			return http.StatusOK, nil
+		}
+		status, _, err := CanExport(ctx, service.ToUUID(sub), organizationID.String())
+		return status, err
+	}
+}
+
+// Export writes everything the organization owns into w as a gzipped tar archive.
+func Export(ctx context.Context, organizationID uuid.UUID, w io.Writer) (*Manifest, error) {
+	manifest := &Manifest{Format: Format, Version: Version, OrganizationID: organizationID, CreatedAt: time.Now().UTC(), Counts: map[string]int{}}
+	files := map[string][]byte{}
+
+	_, _, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *Manifest, error) {
+		for _, t := range tables {
+			rows, err := tx.Query(ctx, t.exportSQL, organizationID)
+			if err != nil {
+				return http.StatusInternalServerError, manifest, fmt.Errorf("failed to export %s: %w", t.name, err)
+			}
+			lines, err := pgx.CollectRows(rows, pgx.RowTo[[]byte])
+			if err != nil {
+				return http.StatusInternalServerError, manifest, fmt.Errorf("failed to read %s: %w", t.name, err)
+			}
+
+			var buf bytes.Buffer
+			for _, line := range lines {
+				buf.Write(line)
+				buf.WriteByte('\n')
+			}
+			files[fileName(t.name)] = buf.Bytes()
+			manifest.Counts[t.name] = len(lines)
+		}
+		return http.StatusOK, manifest, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	configs, missing := exportConfigurations(ctx, files[fileName("landingpage")])
+	manifest.MissingConfigurations = missing
+
+	return manifest, writeArchive(w, manifest, files, configs)
+}
+
+// exportConfigurations reads the configurations of the exported landing pages, which are stored outside of the DB.
+func exportConfigurations(ctx context.Context, landingPages []byte) (map[string][]byte, []string) {
+	configs := map[string][]byte{}
+	var missing []string
+	for line := range strings.SplitSeq(strings.TrimSpace(string(landingPages)), "\n") {
+		if line == "" {
+			continue
+		}
+		page := &landingpage.LandingPage{}
+		if err := json.Unmarshal([]byte(line), page); err != nil {
+			slog.Warn("Failed to parse exported landing page", "error", err)
+			continue
+		}
+		if _, err := landingpage.SetConfiguration(ctx, page); err != nil {
+			slog.Warn("Failed to read landing page configuration", "id", page.ID, "error", err)
+			missing = append(missing, page.ID.String())
+			continue
+		}
+		config, err := json.Marshal(page.Configuration)
+		if err != nil {
+			missing = append(missing, page.ID.String())
+			continue
+		}
+		configs[configurations+page.ID.String()+".json"] = config
+	}
+	return configs, missing
+}
+
+func writeArchive(w io.Writer, manifest *Manifest, files map[string][]byte, configs map[string][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeFile(tw, manifestFile, manifestBytes, manifest.CreatedAt); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := writeFile(tw, fileName(t.name), files[fileName(t.name)], manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	for name, content := range configs {
+		if err := writeFile(tw, name, content, manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write header of %s: %w", name, err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// readArchive returns the manifest and the content of all the files of the archive.
+func readArchive(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		files[path.Clean(header.Name)] = content
+	}
+
+	manifestBytes, ok := files[manifestFile]
+	if !ok {
+		return nil, nil, errors.New("invalid archive: manifest not found")
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Format != Format {
+		return nil, nil, fmt.Errorf("unsupported archive format %q", manifest.Format)
+	}
+	if manifest.Version < 1 || manifest.Version > Version {
+		return nil, nil, fmt.Errorf("unsupported archive version %d, at most %d is supported", manifest.Version, Version)
+	}
+
+	return manifest, files, nil
+}
+
+// Restore loads an archive produced by Export in one transaction; rows that already exist are skipped and reported.
+// Rows of other organizations than the one of the manifest are rejected, short URLs are checked like created ones, see shorturl.RestoreShortURL.
+func Restore(ctx context.Context, r io.Reader, authorize Authorizer) (int, *RestoreReport, error) {
+	manifest, files, err := readArchive(r)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if status, err := authorize(ctx, manifest.OrganizationID); err != nil {
+		return status, nil, err
+	}
+
+	report := &RestoreReport{OrganizationID: manifest.OrganizationID, Tables: map[string]*TableReport{}}
+	restoredPages := map[string]bool{}
+	status, report, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *RestoreReport, error) {
+		for _, t := range tables {
+			tableReport := &TableReport{}
+			report.Tables[t.name] = tableReport
+			for line := range strings.SplitSeq(string(files[fileName(t.name)]), "\n") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				if err := checkOrganization(t.name, line, manifest.OrganizationID); err != nil {
+					return http.StatusBadRequest, report, err
+				}
+				status, restored, err := restoreRow(ctx, tx, t.name, line)
+				if err != nil {
+					return status, report, fmt.Errorf("failed to restore %s: %w", t.name, err)
+				}
+				if !restored {
+					tableReport.Skipped++
+					continue
+				}
+				tableReport.Restored++
+				if t.name == "landingpage" {
+					var page struct {
+						ID string `json:"id"`
+					}
+					if err := json.Unmarshal([]byte(line), &page); err == nil {
+						restoredPages[page.ID] = true
+					}
+				}
+			}
+		}
+		return http.StatusCreated, report, nil
+	})
+	if err != nil {
+		return status, report, err
+	}
+
+	// configurations of the landing pages that already existed are not overwritten
+	for name, content := range files {
+		if !strings.HasPrefix(name, configurations) {
+			continue
+		}
+		id, err := uuid.FromString(strings.TrimSuffix(path.Base(name), ".json"))
+		if err != nil || !restoredPages[id.String()] {
+			continue
+		}
+		page := &landingpage.LandingPage{ID: id}
+		if err := json.Unmarshal(content, &page.Configuration); err != nil {
+			return http.StatusInternalServerError, report, fmt.Errorf("failed to parse configuration %s: %w", name, err)
+		}
+		if err := landingpage.StroreConfiguration(ctx, page); err != nil {
+			return http.StatusInternalServerError, report, fmt.Errorf("failed to store configuration %s: %w", name, err)
+		}
+		report.Configurations++
+	}
+
+	return status, report, nil
+}
+
+// restoreRow inserts the row unless it already exists; restored is false if it is skipped.
+func restoreRow(ctx context.Context, tx pgx.Tx, table string, line string) (status int, restored bool, err error) {
+	if table == "shorturl" {
+		return shorturl.RestoreShortURL(ctx, tx, line)
+	}
+	commandTag, err := tx.Exec(ctx, restoreSQL(table), line)
+	if err != nil {
+		return http.StatusInternalServerError, false, fmt.Errorf("failed to restore %s: %w", line, err)
+	}
+	return http.StatusCreated, commandTag.RowsAffected() > 0, nil
+}
+
+// checkOrganization rejects the rows that belong to another organization than the one of the archive.
+func checkOrganization(table string, line string, organizationID uuid.UUID) error {
+	var row struct {
+		ID             *uuid.UUID `json:"id"`
+		OrganizationID *uuid.UUID `json:"organization_id"`
+	}
+	if err := json.Unmarshal([]byte(line), &row); err != nil {
+		return fmt.Errorf("invalid %s %s: %w", table, line, err)
+	}
+	owner := row.OrganizationID
+	if table == "organization" {
+		owner = row.ID
+	}
+	if owner != nil && *owner != organizationID {
+		return fmt.Errorf("%s %s does not belong to organization %v", table, line, organizationID)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAndReadArchive(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	manifest := &Manifest{Format: Format, Version: Version, OrganizationID: id, CreatedAt: time.Now().UTC(), Counts: map[string]int{"organization": 1}}
+	files := map[string][]byte{"organization.jsonl": []byte(`{"id":"` + id.String() + `"}` + "\n")}
+	configs := map[string][]byte{"landingpages/conf/" + id.String() + ".json": []byte(`{"title":"hello"}`)}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeArchive(&buf, manifest, files, configs))
+
+	readManifest, readFiles, err := readArchive(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, id, readManifest.OrganizationID)
+	assert.Equal(t, 1, readManifest.Counts["organization"])
+	assert.Equal(t, files["organization.jsonl"], readFiles["organization.jsonl"])
+	assert.Equal(t, []byte(`{"title":"hello"}`), readFiles["landingpages/conf/"+id.String()+".json"])
+	assert.Empty(t, readFiles["shorturl.jsonl"])
+}
+
+func TestReadArchive_unsupportedVersion(t *testing.T) {
+	manifest := &Manifest{Format: Format, Version: Version + 1}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeArchive(&buf, manifest, map[string][]byte{}, map[string][]byte{}))
+
+	_, _, err := readArchive(&buf)
+	assert.Error(t, err)
+}
+
+func TestReadArchive_notAnArchive(t *testing.T) {
+	_, _, err := readArchive(bytes.NewReader([]byte("not an archive")))
+	assert.Error(t, err)
+}
+
+func TestCheckOrganization(t *testing.T) {
+	id := uuid.Must(uuid.NewV4())
+	other := uuid.Must(uuid.NewV4())
+
+	assert.NoError(t, checkOrganization("organization", `{"id":"`+id.String()+`"}`, id))
+	assert.NoError(t, checkOrganization("domain", `{"id":"`+other.String()+`","organization_id":"`+id.String()+`"}`, id))
+	assert.NoError(t, checkOrganization("campaign", `{"id":"`+other.String()+`","organization_id":null}`, id))
+	assert.Error(t, checkOrganization("organization", `{"id":"`+other.String()+`"}`, id))
+	assert.Error(t, checkOrganization("customer", `{"id":"`+id.String()+`","organization_id":"`+other.String()+`"}`, id))
+}
+
+func TestRestore_unauthorized(t *testing.T) {
+	manifest := &Manifest{Format: Format, Version: Version, OrganizationID: uuid.Must(uuid.NewV4())}
+	var buf bytes.Buffer
+	assert.NoError(t, writeArchive(&buf, manifest, map[string][]byte{}, map[string][]byte{}))
+
+	status, _, err := Restore(context.Background(), &buf, CanRestore("", nil))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -16,14 +16,16 @@ type Campaign struct {
 	OrganizationID *uuid.UUID   `json:"organizationId"`
 	CustomerID     *uuid.UUID   `json:"customerId"`
 	Status         utils.Status `json:"status"`
+	UTM            *utils.UTM   `json:"utm,omitempty"` // defaults of the short URLs of the campaign
+	Tags           []string     `json:"tags"`          // also match the short URLs of the campaign when they are listed by tag
 }
 
 func (c *Campaign) FieldsPtrs() []any {
-	return []any{&c.ID, &c.Name, &c.OrganizationID, &c.CustomerID, &c.Status}
+	return []any{&c.ID, &c.Name, &c.OrganizationID, &c.CustomerID, &c.Status, &c.UTM, &c.Tags}
 }
 
 func (c *Campaign) FieldsVals() []any {
-	return []any{c.ID, c.Name, c.OrganizationID, c.CustomerID, c.Status}
+	return []any{c.ID, c.Name, c.OrganizationID, c.CustomerID, c.Status, c.UTM, c.Tags}
 }
 
 func (c *Campaign) ParseID(idString string) (uuid.UUID, error) {
@@ -35,6 +37,11 @@ func (c *Campaign) WithID(id uuid.UUID) {
 }
 
 func (c *Campaign) Validate() error {
+	var err error
+	if c.Tags, err = utils.NormalizeTags(c.Tags); err != nil {
+		return err
+	}
+
 	switch {
 	case c.Name == "":
 		return service.ErrNameRequired
@@ -45,18 +52,34 @@ func (c *Campaign) Validate() error {
 	}
 }
 
-func (c *Campaign) Generate() {
+func (c *Campaign) Generate() error {
 	c.ID = service.UUID()
 
 	if c.Status == "" {
 		c.Status = utils.StatusActive
 	}
+	return nil
 }
 
 var (
-	CreateSQL   service.CreateSQL[*Campaign]   = "INSERT INTO campaign (id, name, organization_id, customer_id, status) VALUES ($1, $2, $3, $4, $5)"
-	RetrieveSQL service.RetrieveSQL[*Campaign] = "SELECT id, name, organization_id, customer_id, status FROM campaign WHERE id = $1 AND status='active' AND now() BETWEEN valid_from AND valid_until"
-	UpdateSQL   service.UpdateSQL[*Campaign]   = "UPDATE campaign SET name = $2, organization_id = $3, customer_id = $4, status = $5 WHERE id = $1"
+	CreateSQL   service.CreateSQL[*Campaign]   = "INSERT INTO campaign (id, name, organization_id, customer_id, status, utm, tags) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	RetrieveSQL service.RetrieveSQL[*Campaign] = "SELECT id, name, organization_id, customer_id, status, utm, tags FROM campaign WHERE id = $1 AND status='active' AND now() BETWEEN valid_from AND valid_until"
+	UpdateSQL   service.UpdateSQL[*Campaign]   = "UPDATE campaign SET name = $2, organization_id = $3, customer_id = $4, status = $5, utm = $6, tags = $7 WHERE id = $1"
 	DeleteSQL   service.DeleteSQL[*Campaign]   = "DELETE FROM campaign WHERE id = $1"
-	ListSQL     service.ListSQL[*Campaign]     = "SELECT id, name, organization_id, customer_id, status FROM campaign WHERE status='active' AND customer_id=$1 OFFSET $2 LIMIT $3"
+	VersionSQL  service.VersionSQL[*Campaign]  = "SELECT updated_at FROM campaign WHERE id = $1"
 )
+
+var ListSQL = service.ListSQL[*Campaign]{
+	Columns: "id, name, organization_id, customer_id, status, utm, tags",
+	From:    "FROM campaign WHERE status='active' AND customer_id=$1",
+	ID:      "id",
+	Sorts:   map[string]string{"name": "name", "createdAt": "created_at", "updatedAt": "updated_at"},
+	Filters: map[string]service.Filter{
+		"name":           {Condition: "name ILIKE %[1]s", Type: service.ContainsFilter},
+		"organizationId": {Condition: "organization_id = %[1]s", Type: service.UUIDFilter},
+		"tag":            {Condition: "tags @> ARRAY[%[1]s::text]", Type: service.TagFilter},
+		"createdFrom":    {Condition: "created_at >= %[1]s", Type: service.TimeFilter},
+		"createdUntil":   {Condition: "created_at < %[1]s", Type: service.TimeFilter},
+	},
+	DefaultSort: "createdAt",
+}
@@ -9,12 +9,15 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
 	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/gofrs/uuid"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/lnk.by/shared/db"
 )
@@ -25,7 +28,6 @@ type CreateSQL[T any] string
 type RetrieveSQL[T any] string
 type UpdateSQL[T any] string
 type DeleteSQL[T any] string
-type ListSQL[T any] string
 
 type failure struct {
 	Error string `json:"error"`
@@ -51,14 +53,68 @@ func withConn[T any](ctx context.Context, f func(conn *pgxpool.Conn) (int, T, er
 	return f(conn)
 }
 
+// Querier is implemented by both a pooled connection and a transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// InTransaction runs f in a single DB transaction that is committed only if f returns neither an error nor an error status.
+func InTransaction[T any](ctx context.Context, f func(tx pgx.Tx) (int, T, error)) (int, T, error) {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		var zero T
+		return http.StatusInternalServerError, zero, err
+	}
+	defer tx.Rollback(ctx) // does nothing if the transaction is already committed
+
+	status, t, err := f(tx)
+	if err != nil || status >= http.StatusMultipleChoices {
+		return status, t, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return http.StatusInternalServerError, t, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return status, t, nil
+}
+
+// exec wraps the statement into a savepoint when running in a transaction, so its failure (e.g. duplicate key) does not abort the whole transaction.
+func exec(ctx context.Context, q Querier, sql string, args ...any) (pgconn.CommandTag, error) {
+	tx, ok := q.(pgx.Tx)
+	if !ok {
+		return q.Exec(ctx, sql, args...)
+	}
+
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	commandTag, err := savepoint.Exec(ctx, sql, args...)
+	if err != nil {
+		_ = savepoint.Rollback(ctx)
+		return commandTag, err
+	}
+
+	return commandTag, savepoint.Commit(ctx)
+}
+
 type FieldsValsAware interface {
 	Validate() error
 	FieldsVals() []any
 }
 
+// UpdateValsAware entities are updated with their own arguments instead of FieldsVals, e.g. without the fields decided on creation.
+type UpdateValsAware interface {
+	UpdateVals() []any
+}
+
 type Creatable interface {
 	FieldsValsAware
-	Generate()
+	Generate() error
 }
 
 type retriable interface {
@@ -96,31 +152,42 @@ func Create[T Creatable](ctx context.Context, createSQL CreateSQL[T], content []
 }
 
 func CreateRecord[T Creatable](ctx context.Context, createSQL CreateSQL[T], t T, generateFromIteration int) (int, string) {
+	return Marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, T, error) {
+		return createRecord(ctx, conn, createSQL, t, generateFromIteration)
+	}))
+}
+
+func CreateRecordInTx[T Creatable](ctx context.Context, tx pgx.Tx, createSQL CreateSQL[T], t T, generateFromIteration int) (int, T, error) {
+	return createRecord(ctx, tx, createSQL, t, generateFromIteration)
+}
+
+func createRecord[T Creatable](ctx context.Context, q Querier, createSQL CreateSQL[T], t T, generateFromIteration int) (int, T, error) {
 	maxAttempts := 1
 	if t, ok := any(t).(retriable); ok {
 		maxAttempts = t.MaxAttempts()
 	}
 
-	return marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, T, error) {
-		for i := 0; i < maxAttempts; i++ {
-			if i >= generateFromIteration {
-				t.Generate()
+	for i := 0; i < maxAttempts; i++ {
+		if i >= generateFromIteration {
+			if err := t.Generate(); err != nil {
+				return http.StatusServiceUnavailable, t, fmt.Errorf("failed to generate identifier for %T: %w", t, err)
 			}
-			if _, err := conn.Exec(ctx, string(createSQL), t.FieldsVals()...); err != nil {
-				if isDuplicateKeyError(err) {
-					continue // try again
-				}
-				return http.StatusInternalServerError, t, fmt.Errorf("failed to insert %T %v: %w", t, t, err)
+		}
+		if _, err := exec(ctx, q, string(createSQL), t.FieldsVals()...); err != nil {
+			if IsDuplicateKeyError(err) {
+				continue // try again
 			}
-
-			return http.StatusCreated, t, nil
+			return http.StatusInternalServerError, t, fmt.Errorf("failed to insert %T %v: %w", t, t, err)
 		}
 
-		return http.StatusConflict, t, fmt.Errorf("failed to create unique identifier for %T", t)
-	}))
+		return http.StatusCreated, t, nil
+	}
+
+	return http.StatusConflict, t, fmt.Errorf("failed to create unique identifier for %T", t)
 }
 
-func isDuplicateKeyError(err error) bool {
+// IsDuplicateKeyError tells whether the statement violated a unique constraint.
+func IsDuplicateKeyError(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "duplicate key")
 }
 
@@ -138,10 +205,10 @@ func inst[T any]() T {
 }
 
 func Retrieve[K any, T Retrievable[K]](ctx context.Context, retrieveSQL RetrieveSQL[T], id string, transformer func(t T) (T, error)) (int, string) {
-	return marshal(retrieve(ctx, retrieveSQL, id, transformer))
+	return Marshal(retrieve(ctx, retrieveSQL, id, transformer))
 }
 
-func marshal[T any](status int, t T, err error) (int, string) {
+func Marshal[T any](status int, t T, err error) (int, string) {
 	if err != nil {
 		return failed(status, err)
 	}
@@ -217,56 +284,98 @@ func UpdateFromReqBody[K any, T Updatable[K]](ctx context.Context, updateSQL Upd
 }
 
 func Update[K any, T Updatable[K]](ctx context.Context, updateSQL UpdateSQL[T], idString string, content []byte, finalizer func(id K, t T) error) (int, string) {
+	status, body, _ := UpdateConditional(ctx, updateSQL, "", idString, content, "", finalizer)
+	return status, body
+}
+
+// UpdateConditional updates the entity unless the If-Match header does not match its ETag, and returns the new ETag.
+func UpdateConditional[K any, T Updatable[K]](ctx context.Context, updateSQL UpdateSQL[T], versionSQL VersionSQL[T], idString string, content []byte, ifMatch string, finalizer func(id K, t T) error) (int, string, string) {
 	t := inst[T]()
 	if err := json.Unmarshal(content, t); err != nil {
-		return failed(http.StatusBadRequest, fmt.Errorf("failed to unmarshal %T from JSON: %w", t, err))
+		status, body := failed(http.StatusBadRequest, fmt.Errorf("failed to unmarshal %T from JSON: %w", t, err))
+		return status, body, ""
 	}
 	if err := t.Validate(); err != nil {
-		return failed(http.StatusBadRequest, fmt.Errorf("failed to validate %T: %w", t, err))
+		status, body := failed(http.StatusBadRequest, fmt.Errorf("failed to validate %T: %w", t, err))
+		return status, body, ""
 	}
 
 	id, err := t.ParseID(idString)
 	if err != nil {
-		return failed(http.StatusNotFound, fmt.Errorf("failed to parse %T ID: %v: %w", t, idString, err))
+		status, body := failed(http.StatusNotFound, fmt.Errorf("failed to parse %T ID: %v: %w", t, idString, err))
+		return status, body, ""
 	}
 
 	t.WithID(id)
 
-	return marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, T, error) {
-		commandTag, err := conn.Exec(ctx, string(updateSQL), t.FieldsVals()...)
-		switch {
-		case err != nil:
-			return http.StatusInternalServerError, t, fmt.Errorf("failed to update %T %v: %w", t, t, err)
-		case commandTag.RowsAffected() == 0:
-			return http.StatusNotFound, t, fmt.Errorf("failed to update %T %v: %w", t, t, pgx.ErrNoRows)
-		case commandTag.RowsAffected() > 1: // TODO is it too late?
-			return http.StatusConflict, t, fmt.Errorf("failed to update %T %v: %w", t, t, pgx.ErrTooManyRows)
+	var etag string
+	status, body := Marshal(InTransaction(ctx, func(tx pgx.Tx) (int, T, error) {
+		if status, err := CheckVersion(ctx, tx, versionSQL, id, ifMatch); err != nil {
+			return status, t, err
+		}
+
+		if status, t, err := updateRecord(ctx, tx, updateSQL, t); err != nil {
+			return status, t, err
 		}
 
 		if err = finalizer(id, t); err != nil {
 			return http.StatusInternalServerError, t, fmt.Errorf("failed to finilize updating of %T with id %v: %w", t, id, err)
 		}
 
+		status, updated, err := version(ctx, tx, versionSQL, id, false)
+		if err != nil {
+			return status, t, err
+		}
+		etag = updated
 		return http.StatusOK, t, nil
 	}))
+	if status != http.StatusOK {
+		etag = ""
+	}
+	return status, body, etag
+}
+
+// UpdateInTx updates the record with the ID already set, e.g. after checks that need the same transaction.
+func UpdateInTx[T FieldsValsAware](ctx context.Context, tx pgx.Tx, updateSQL UpdateSQL[T], t T) (int, T, error) {
+	return updateRecord(ctx, tx, updateSQL, t)
+}
+
+func updateRecord[T FieldsValsAware](ctx context.Context, q Querier, updateSQL UpdateSQL[T], t T) (int, T, error) {
+	args := t.FieldsVals()
+	if u, ok := any(t).(UpdateValsAware); ok {
+		args = u.UpdateVals()
+	}
+	commandTag, err := q.Exec(ctx, string(updateSQL), args...)
+	switch {
+	case err != nil:
+		return http.StatusInternalServerError, t, fmt.Errorf("failed to update %T %v: %w", t, t, err)
+	case commandTag.RowsAffected() == 0:
+		return http.StatusNotFound, t, fmt.Errorf("failed to update %T %v: %w", t, t, pgx.ErrNoRows)
+	case commandTag.RowsAffected() > 1: // TODO is it too late?
+		return http.StatusConflict, t, fmt.Errorf("failed to update %T %v: %w", t, t, pgx.ErrTooManyRows)
+	}
+	return http.StatusOK, t, nil
 }
 
 func Delete[K any, T Identifiable[K]](ctx context.Context, deleteSQL DeleteSQL[T], idString string, finalizer func(id K) error) (int, string) {
+	return DeleteConditional(ctx, deleteSQL, "", idString, "", finalizer)
+}
+
+// DeleteConditional deletes the entity unless the If-Match header does not match its ETag.
+func DeleteConditional[K any, T Identifiable[K]](ctx context.Context, deleteSQL DeleteSQL[T], versionSQL VersionSQL[T], idString string, ifMatch string, finalizer func(id K) error) (int, string) {
 	var t T
 	id, err := t.ParseID(idString) // it it OK if t is nil
 	if err != nil {
 		return failed(http.StatusNotFound, fmt.Errorf("failed to parse %T ID: %v: %w", t, idString, err))
 	}
 
-	return marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, T, error) {
-		commandTag, err := conn.Exec(ctx, string(deleteSQL), id)
-		switch {
-		case err != nil:
-			return http.StatusInternalServerError, t, fmt.Errorf("failed to delete %T with id %v: %w", t, id, err)
-		case commandTag.RowsAffected() == 0:
-			return http.StatusNotFound, t, fmt.Errorf("failed to delete %T with id %v: %w", t, id, pgx.ErrNoRows)
-		case commandTag.RowsAffected() > 1: // TODO is it too late?
-			return http.StatusNotFound, t, fmt.Errorf("failed to delete %T with id %v: %w", t, id, pgx.ErrTooManyRows)
+	return Marshal(InTransaction(ctx, func(tx pgx.Tx) (int, T, error) {
+		if status, err := CheckVersion(ctx, tx, versionSQL, id, ifMatch); err != nil {
+			return status, t, err
+		}
+
+		if status, err := deleteRecord(ctx, tx, deleteSQL, id); err != nil {
+			return status, t, err
 		}
 
 		if err = finalizer(id); err != nil {
@@ -277,31 +386,23 @@ func Delete[K any, T Identifiable[K]](ctx context.Context, deleteSQL DeleteSQL[T
 	}))
 }
 
-func List[K any, T Retrievable[K]](ctx context.Context, listSQL ListSQL[T], userID *uuid.UUID, offset int, limit int, transformer func(t T) (T, error)) (int, string) {
-	return marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, []T, error) {
-		sql := string(listSQL)
-
-		rows, err := conn.Query(ctx, sql, userID, offset, limit)
-		if err != nil {
-			return http.StatusInternalServerError, nil, fmt.Errorf("failed to execute list query for %T: %w", new(T), err)
-		}
-		defer rows.Close()
+func DeleteInTx[K any, T Identifiable[K]](ctx context.Context, tx pgx.Tx, deleteSQL DeleteSQL[T], id K) (int, error) {
+	return deleteRecord(ctx, tx, deleteSQL, id)
+}
 
-		ts := make([]T, 0)
-		for rows.Next() {
-			t := inst[T]()
-			if err := rows.Scan(t.FieldsPtrs()...); err != nil {
-				return http.StatusInternalServerError, ts, fmt.Errorf("failed to scan row to build the %T: %w", t, err)
-			}
-			t, err = transformer(t)
-			if err != nil {
-				return http.StatusInternalServerError, ts, fmt.Errorf("failed to transform row value %T: %w", t, err)
-			}
-			ts = append(ts, t)
-		}
+func deleteRecord[K any, T Identifiable[K]](ctx context.Context, q Querier, deleteSQL DeleteSQL[T], id K) (int, error) {
+	var t T
+	commandTag, err := q.Exec(ctx, string(deleteSQL), id)
+	switch {
+	case err != nil:
+		return http.StatusInternalServerError, fmt.Errorf("failed to delete %T with id %v: %w", t, id, err)
+	case commandTag.RowsAffected() == 0:
+		return http.StatusNotFound, fmt.Errorf("failed to delete %T with id %v: %w", t, id, pgx.ErrNoRows)
+	case commandTag.RowsAffected() > 1: // TODO is it too late?
+		return http.StatusNotFound, fmt.Errorf("failed to delete %T with id %v: %w", t, id, pgx.ErrTooManyRows)
+	}
 
-		return http.StatusOK, ts, nil
-	}))
+	return http.StatusNoContent, nil
 }
 
 func UUID() uuid.UUID {
@@ -329,6 +430,20 @@ func GetUUIDFromAuthorization(authHeader string) *uuid.UUID {
 	return nil
 }
 
+// IsAdmin tells whether the user is a moderator: a member of the ADMIN_GROUP (admin by default) Cognito group,
+// or one of the comma-separated ADMIN_USERS. The subject and the groups must come from a verified token, see auth.VerifyBearer.
+func IsAdmin(sub string, groups []string) bool {
+	group := os.Getenv("ADMIN_GROUP")
+	if group == "" {
+		group = "admin"
+	}
+	if slices.Contains(groups, group) {
+		return true
+	}
+
+	return sub != "" && slices.Contains(strings.Split(os.Getenv("ADMIN_USERS"), ","), sub)
+}
+
 func getClaimsFromAuthorization(authHeader string) map[string]interface{} {
 	var claims map[string]interface{}
 
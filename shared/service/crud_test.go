@@ -1,8 +1,10 @@
 package service
 
 import (
-	"github.com/stretchr/testify/assert"
+	"net/http"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 type shit struct {
@@ -17,3 +19,33 @@ func TestInst(t *testing.T) {
 	assert.NotNil(t, shitPtr)
 	assert.NotNil(t, shitPtr.fieldsPtrs())
 }
+
+func TestIsAdmin(t *testing.T) {
+	t.Setenv("ADMIN_GROUP", "")
+	t.Setenv("ADMIN_USERS", "")
+	assert.False(t, IsAdmin("", nil))
+	assert.False(t, IsAdmin("u1", nil))
+	assert.True(t, IsAdmin("u1", []string{"users", "admin"}))
+
+	t.Setenv("ADMIN_GROUP", "moderators")
+	assert.False(t, IsAdmin("u1", []string{"admin"}))
+	assert.True(t, IsAdmin("u1", []string{"moderators"}))
+
+	t.Setenv("ADMIN_USERS", "u2,u3")
+	assert.True(t, IsAdmin("u3", nil))
+	assert.False(t, IsAdmin("u4", nil))
+	assert.False(t, IsAdmin("", nil))
+}
+
+type unidentifiable struct{}
+
+func (u *unidentifiable) Validate() error   { return nil }
+func (u *unidentifiable) FieldsVals() []any { return nil }
+func (u *unidentifiable) Generate() error   { return ErrLeaseExpired }
+
+func TestCreateRecordGenerateFailure(t *testing.T) {
+	// fails before the query, so no DB is needed
+	status, _, err := createRecord(t.Context(), nil, "", &unidentifiable{}, 0)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.ErrorIs(t, err, ErrLeaseExpired)
+}
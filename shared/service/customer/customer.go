@@ -46,25 +46,33 @@ func (c *Customer) Validate() error {
 	}
 }
 
-func (c *Customer) Generate() {
+func (c *Customer) Generate() error {
 	c.ID = service.UUID()
 
 	if c.Status == "" {
 		c.Status = utils.StatusActive
 	}
+	return nil
 }
 
 var (
 	CreateSQL   service.CreateSQL[*Customer]   = "INSERT INTO customer (id, email, name, organization_id, status) VALUES ($1, $2, $3, $4, $5)"
 	RetrieveSQL service.RetrieveSQL[*Customer] = "SELECT id, email, name, organization_id, status FROM customer WHERE id = $1 AND status='active'"
-	UpdateSQL   service.UpdateSQL[*Customer]   = "UPDATE customer SET email = $2, name = $3, organization_id = $4, status = $5 WHERE id = $1"
+	UpdateSQL   service.UpdateSQL[*Customer]   = "UPDATE customer SET email = $2, name = $3, organization_id = $4, status = CASE WHEN status = 'banned' THEN status ELSE $5 END WHERE id = $1"
 	DeleteSQL   service.DeleteSQL[*Customer]   = "DELETE FROM customer WHERE id = $1"
+	VersionSQL  service.VersionSQL[*Customer]  = "SELECT updated_at FROM customer WHERE id = $1"
 	// Right now select all customers that belong to the same organization together with the currently logged in customer.
-	ListSQL service.ListSQL[*Customer] = `
-		SELECT c.id, c.email, c.name, c.organization_id, c.status
-		FROM customer c
-		JOIN customer me ON me.id = $1
-		WHERE c.status = 'active' AND c.organization_id = me.organization_id
-		OFFSET $2 LIMIT $3
-	`
+	ListSQL = service.ListSQL[*Customer]{
+		Columns: "c.id, c.email, c.name, c.organization_id, c.status",
+		From:    "FROM customer c JOIN customer me ON me.id = $1 WHERE c.status = 'active' AND c.organization_id = me.organization_id",
+		ID:      "c.id",
+		Sorts:   map[string]string{"name": "c.name", "email": "c.email", "createdAt": "c.created_at", "updatedAt": "c.updated_at"},
+		Filters: map[string]service.Filter{
+			"name":         {Condition: "c.name ILIKE %[1]s", Type: service.ContainsFilter},
+			"email":        {Condition: "c.email ILIKE %[1]s", Type: service.ContainsFilter},
+			"createdFrom":  {Condition: "c.created_at >= %[1]s", Type: service.TimeFilter},
+			"createdUntil": {Condition: "c.created_at < %[1]s", Type: service.TimeFilter},
+		},
+		DefaultSort: "createdAt",
+	}
 )
@@ -0,0 +1,349 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/net/idna"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/utils"
+)
+
+const (
+	// VerificationPrefix is prepended to the name of the domain to get the name of the TXT record that proves its ownership.
+	VerificationPrefix = "_lnkby."
+	// VerificationValuePrefix is followed by the verification token in the TXT record.
+	VerificationValuePrefix = "lnkby-verification="
+)
+
+var namePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// ErrNameTaken is returned when another organization has verified the domain first: the name is unique among verified domains only,
+// so claims of other organizations cannot block the one that owns it.
+var ErrNameTaken = errors.New("the domain is already verified by another organization")
+
+// lookupTXT is replaced by tests.
+var lookupTXT = net.DefaultResolver.LookupTXT
+
+// Domain is a branded host of the short links of an organization; it serves them only once verified.
+type Domain struct {
+	ID                uuid.UUID    `json:"id"`
+	Name              string       `json:"name"`
+	OrganizationID    *uuid.UUID   `json:"organizationId"`
+	VerificationToken string       `json:"verificationToken"`
+	VerifiedAt        *time.Time   `json:"verifiedAt"`
+	FallbackURL       string       `json:"fallbackUrl,omitempty"` // where unknown keys of the domain are redirected, 404 if empty
+	Status            utils.Status `json:"status"`
+}
+
+func (d *Domain) FieldsPtrs() []any {
+	return []any{&d.ID, &d.Name, &d.OrganizationID, &d.VerificationToken, &d.VerifiedAt, &d.FallbackURL, &d.Status}
+}
+
+func (d *Domain) FieldsVals() []any {
+	return []any{d.ID, d.Name, d.OrganizationID, d.VerificationToken, d.VerifiedAt, d.FallbackURL, d.Status}
+}
+
+// UpdateVals leaves out the name, the owner and the verification of the domain: they cannot be changed.
+func (d *Domain) UpdateVals() []any {
+	return []any{d.ID, d.FallbackURL, d.Status}
+}
+
+func (d *Domain) ParseID(idString string) (uuid.UUID, error) {
+	return uuid.FromString(idString)
+}
+
+func (d *Domain) WithID(id uuid.UUID) {
+	d.ID = id
+}
+
+func (d *Domain) Validate() error {
+	d.Name = NormalizeHost(d.Name)
+	if ascii, err := ToASCII(d.Name); err == nil {
+		d.Name = ascii
+	}
+	switch {
+	case d.Name == "":
+		return service.ErrNameRequired
+	case !namePattern.MatchString(d.Name):
+		return fmt.Errorf("invalid domain name %q", d.Name)
+	case d.OrganizationID == nil:
+		return errors.New("organizationId is required")
+	case d.ID != uuid.Nil:
+		return service.ErrIDManagedByServer
+	case d.FallbackURL != "" && !isWebURL(d.FallbackURL):
+		return fmt.Errorf("fallbackUrl must be an absolute http(s) URL: %q", d.FallbackURL)
+	default:
+		return nil
+	}
+}
+
+func (d *Domain) Generate() error {
+	d.ID = service.UUID()
+	d.VerificationToken = newToken()
+	d.VerifiedAt = nil
+
+	if d.Status == "" {
+		d.Status = utils.StatusActive
+	}
+	return nil
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // never returns an error
+	return hex.EncodeToString(b)
+}
+
+// VerificationRecord returns the name and the value of the TXT record that has to be published to verify the domain.
+func (d *Domain) VerificationRecord() (string, string) {
+	return VerificationPrefix + d.Name, VerificationValuePrefix + d.VerificationToken
+}
+
+// NormalizeHost lower-cases the host and strips the port and the trailing dot, so it can be compared with domain names.
+func NormalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// ToASCII normalizes the host and converts an internationalized name to punycode; IP addresses are returned as is.
+func ToASCII(host string) (string, error) {
+	host = NormalizeHost(host)
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %w", host, err)
+	}
+	return ascii, nil
+}
+
+// Matches tells whether the host is the domain or one of its subdomains.
+func Matches(host string, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// NormalizeList converts the domains to punycode, so they can be matched against normalized hosts.
+func NormalizeList(domains []string) ([]string, error) {
+	normalized := make([]string, 0, len(domains))
+	for _, d := range domains {
+		ascii, err := ToASCII(d)
+		if err != nil {
+			return nil, err
+		}
+		if !namePattern.MatchString(ascii) && net.ParseIP(ascii) == nil {
+			return nil, fmt.Errorf("invalid domain name %q", d)
+		}
+		normalized = append(normalized, ascii)
+	}
+	return normalized, nil
+}
+
+func isWebURL(target string) bool {
+	return (strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")) && len(target) <= 2048
+}
+
+var (
+	CreateSQL   service.CreateSQL[*Domain]   = "INSERT INTO domain (id, name, organization_id, verification_token, verified_at, fallback_url, status) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	RetrieveSQL service.RetrieveSQL[*Domain] = "SELECT id, name, organization_id, verification_token, verified_at, fallback_url, status FROM domain WHERE id = $1 AND status='active'"
+	UpdateSQL   service.UpdateSQL[*Domain]   = "UPDATE domain SET fallback_url = $2, status = $3 WHERE id = $1"
+	DeleteSQL   service.DeleteSQL[*Domain]   = "DELETE FROM domain WHERE id = $1"
+	VersionSQL  service.VersionSQL[*Domain]  = "SELECT updated_at FROM domain WHERE id = $1"
+
+	VerifySQL = "UPDATE domain SET verified_at = now() WHERE id = $1 RETURNING verified_at"
+	// RetrieveOwnedSQL retrieves the domain only if it belongs to the organization of the customer given as $2.
+	RetrieveOwnedSQL = `
+		SELECT d.id, d.name, d.organization_id, d.verification_token, d.verified_at, d.fallback_url, d.status
+		FROM domain d JOIN customer c ON c.organization_id = d.organization_id
+		WHERE d.id = $1 AND c.id = $2 AND d.status = 'active'`
+	// MemberSQL tells whether the customer given as $1 belongs to the organization given as $2.
+	MemberSQL = "SELECT EXISTS (SELECT 1 FROM customer WHERE id = $1 AND organization_id = $2)"
+)
+
+var ListSQL = service.ListSQL[*Domain]{
+	Columns: "d.id, d.name, d.organization_id, d.verification_token, d.verified_at, d.fallback_url, d.status",
+	From:    "FROM domain d JOIN customer c ON c.organization_id=d.organization_id WHERE d.status='active' AND c.id=$1",
+	ID:      "d.id",
+	Sorts:   map[string]string{"name": "d.name", "createdAt": "d.created_at", "updatedAt": "d.updated_at"},
+	Filters: map[string]service.Filter{
+		"name":     {Condition: "d.name ILIKE %[1]s", Type: service.ContainsFilter},
+		"verified": {Condition: "(d.verified_at IS NOT NULL) = %[1]s", Type: service.BoolFilter},
+	},
+	DefaultSort: "createdAt",
+}
+
+// RetrieveOwned retrieves the domain of the organization of the customer; domains of other organizations are not found.
+func RetrieveOwned(ctx context.Context, q service.Querier, id uuid.UUID, customerID *uuid.UUID) (int, *Domain, error) {
+	d := &Domain{}
+	if err := q.QueryRow(ctx, RetrieveOwnedSQL, id, customerID).Scan(d.FieldsPtrs()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, nil, fmt.Errorf("domain %v is not found: %w", id, err)
+		}
+		return http.StatusInternalServerError, nil, fmt.Errorf("failed to retrieve domain %v: %w", id, err)
+	}
+	return http.StatusOK, d, nil
+}
+
+// Create creates the domain for the organization of the customer; other organizations cannot claim domains on its behalf.
+func Create(ctx context.Context, content []byte, userID *uuid.UUID) (int, string) {
+	d, err := service.Parse[*Domain](ctx, content)
+	if err != nil {
+		return service.Marshal(http.StatusBadRequest, d, err)
+	}
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Domain, error) {
+		if status, err := checkMember(ctx, tx, userID, *d.OrganizationID); err != nil {
+			return status, d, err
+		}
+		return service.CreateRecordInTx(ctx, tx, CreateSQL, d, 0)
+	}))
+}
+
+func checkMember(ctx context.Context, q service.Querier, userID *uuid.UUID, organizationID uuid.UUID) (int, error) {
+	if userID == nil {
+		return http.StatusUnauthorized, errors.New("authentication is required to manage domains")
+	}
+	var member bool
+	if err := q.QueryRow(ctx, MemberSQL, userID, organizationID).Scan(&member); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to check membership in organization %v: %w", organizationID, err)
+	}
+	if !member {
+		return http.StatusForbidden, fmt.Errorf("customer %v does not belong to organization %v", userID, organizationID)
+	}
+	return http.StatusOK, nil
+}
+
+// Update replaces the fallback URL and the status of the domain of the organization of the customer, unless If-Match does not match its ETag.
+func Update(ctx context.Context, idString string, content []byte, userID *uuid.UUID, ifMatch string) (int, string, string) {
+	d, err := service.Parse[*Domain](ctx, content)
+	if err != nil {
+		status, body := service.Marshal(http.StatusBadRequest, d, err)
+		return status, body, ""
+	}
+	return change(ctx, idString, userID, ifMatch, func(tx pgx.Tx, id uuid.UUID) (*Domain, error) {
+		d.WithID(id)
+		return d, nil
+	})
+}
+
+// Patch applies the JSON Merge Patch to the domain of the organization of the customer, unless If-Match does not match its ETag.
+func Patch(ctx context.Context, idString string, patch []byte, userID *uuid.UUID, ifMatch string) (int, string, string) {
+	return change(ctx, idString, userID, ifMatch, func(tx pgx.Tx, id uuid.UUID) (*Domain, error) {
+		_, current, err := service.RetrieveForUpdate(ctx, tx, RetrieveSQL, id)
+		if err != nil {
+			return current, err
+		}
+		d, err := service.Merge(current, patch)
+		if err != nil {
+			return d, err
+		}
+		d.WithID(id)
+		return d, nil
+	})
+}
+
+// change updates the domain built by the function if it belongs to the organization of the customer, and returns its new ETag.
+func change(ctx context.Context, idString string, userID *uuid.UUID, ifMatch string, build func(tx pgx.Tx, id uuid.UUID) (*Domain, error)) (int, string, string) {
+	id, err := uuid.FromString(idString)
+	if err != nil {
+		status, body := service.Marshal(http.StatusNotFound, &Domain{}, fmt.Errorf("failed to parse domain ID: %v: %w", idString, err))
+		return status, body, ""
+	}
+
+	var etag string
+	status, body := service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Domain, error) {
+		if status, err := service.CheckVersion(ctx, tx, VersionSQL, id, ifMatch); err != nil {
+			return status, &Domain{}, err
+		}
+		if status, d, err := RetrieveOwned(ctx, tx, id, userID); err != nil {
+			return status, d, err
+		}
+		d, err := build(tx, id)
+		if err != nil {
+			return http.StatusBadRequest, d, err
+		}
+		if status, d, err := service.UpdateInTx(ctx, tx, UpdateSQL, d); err != nil {
+			return status, d, err
+		}
+		status, updated, err := service.VersionInTx(ctx, tx, VersionSQL, id)
+		if err != nil {
+			return status, d, err
+		}
+		etag = updated
+		return http.StatusOK, d, nil
+	}))
+	if status != http.StatusOK {
+		etag = ""
+	}
+	return status, body, etag
+}
+
+// Delete deletes the domain of the organization of the customer, unless If-Match does not match its ETag.
+func Delete(ctx context.Context, idString string, userID *uuid.UUID, ifMatch string) (int, string) {
+	id, err := uuid.FromString(idString)
+	if err != nil {
+		return service.Marshal(http.StatusNotFound, &Domain{}, fmt.Errorf("failed to parse domain ID: %v: %w", idString, err))
+	}
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Domain, error) {
+		if status, err := service.CheckVersion(ctx, tx, VersionSQL, id, ifMatch); err != nil {
+			return status, &Domain{}, err
+		}
+		status, d, err := RetrieveOwned(ctx, tx, id, userID)
+		if err != nil {
+			return status, d, err
+		}
+		if status, err := service.DeleteInTx(ctx, tx, DeleteSQL, id); err != nil {
+			return status, d, err
+		}
+		return http.StatusNoContent, nil, nil
+	}))
+}
+
+// Verify looks for the TXT record with the verification token of the domain and marks the domain as verified when it is found.
+// Only the organization of the domain can verify it.
+func Verify(ctx context.Context, idString string, userID *uuid.UUID) (int, string) {
+	id, err := uuid.FromString(idString)
+	if err != nil {
+		return service.Marshal(http.StatusNotFound, &Domain{}, fmt.Errorf("failed to parse domain ID: %v: %w", idString, err))
+	}
+	status, d, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *Domain, error) {
+		return RetrieveOwned(ctx, tx, id, userID)
+	})
+	if err != nil {
+		return service.Marshal(status, d, err)
+	}
+	return service.Marshal(verify(ctx, d))
+}
+
+func verify(ctx context.Context, d *Domain) (int, *Domain, error) {
+	name, value := d.VerificationRecord()
+	records, err := lookupTXT(ctx, name)
+	if err != nil || !slices.Contains(records, value) {
+		return http.StatusUnprocessableEntity, d, fmt.Errorf("TXT record %q with value %q is not found", name, value)
+	}
+
+	return service.InTransaction(ctx, func(tx pgx.Tx) (int, *Domain, error) {
+		if err := tx.QueryRow(ctx, VerifySQL, d.ID).Scan(&d.VerifiedAt); err != nil {
+			if service.IsDuplicateKeyError(err) {
+				return http.StatusConflict, d, fmt.Errorf("domain %q: %w", d.Name, ErrNameTaken)
+			}
+			return http.StatusInternalServerError, d, fmt.Errorf("failed to mark domain %q as verified: %w", d.Name, err)
+		}
+		return http.StatusOK, d, nil
+	})
+}
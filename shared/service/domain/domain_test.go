@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/lnk.by/shared/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	assert.Equal(t, "go.acme.com", NormalizeHost("Go.Acme.com"))
+	assert.Equal(t, "go.acme.com", NormalizeHost("go.acme.com:8443"))
+	assert.Equal(t, "go.acme.com", NormalizeHost("go.acme.com."))
+	assert.Equal(t, "localhost", NormalizeHost("localhost:8080"))
+}
+
+func TestToASCII(t *testing.T) {
+	name, err := ToASCII("Bücher.DE.")
+	assert.NoError(t, err)
+	assert.Equal(t, "xn--bcher-kva.de", name)
+
+	name, err = ToASCII("127.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", name)
+}
+
+func TestMatches(t *testing.T) {
+	assert.True(t, Matches("example.com", "example.com"))
+	assert.True(t, Matches("a.b.example.com", "example.com"))
+	assert.False(t, Matches("notexample.com", "example.com"))
+}
+
+func TestNormalizeList(t *testing.T) {
+	domains, err := NormalizeList([]string{"Example.com", "bücher.de"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "xn--bcher-kva.de"}, domains)
+
+	_, err = NormalizeList([]string{"not a domain"})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	organizationID := uuid.Must(uuid.NewV4())
+
+	d := &Domain{Name: "Go.Acme.com", OrganizationID: &organizationID}
+	assert.NoError(t, d.Validate())
+	assert.Equal(t, "go.acme.com", d.Name)
+
+	assert.ErrorIs(t, (&Domain{OrganizationID: &organizationID}).Validate(), service.ErrNameRequired)
+	assert.Error(t, (&Domain{Name: "acme", OrganizationID: &organizationID}).Validate())
+	assert.Error(t, (&Domain{Name: "go.acme.com"}).Validate())
+	assert.Error(t, (&Domain{Name: "go.acme.com", OrganizationID: &organizationID, FallbackURL: "ftp://acme.com"}).Validate())
+	assert.NoError(t, (&Domain{Name: "go.acme.com", OrganizationID: &organizationID, FallbackURL: "https://acme.com"}).Validate())
+}
+
+func TestGenerate(t *testing.T) {
+	d := &Domain{Name: "go.acme.com"}
+	assert.NoError(t, d.Generate())
+	assert.NotEqual(t, uuid.Nil, d.ID)
+	assert.Len(t, d.VerificationToken, 32)
+	assert.Nil(t, d.VerifiedAt)
+
+	name, value := d.VerificationRecord()
+	assert.Equal(t, "_lnkby.go.acme.com", name)
+	assert.Equal(t, "lnkby-verification="+d.VerificationToken, value)
+}
+
+func TestVerifyWithoutRecord(t *testing.T) {
+	defer func(f func(ctx context.Context, name string) ([]string, error)) { lookupTXT = f }(lookupTXT)
+
+	d := &Domain{Name: "go.acme.com", VerificationToken: "token"}
+	lookupTXT = func(ctx context.Context, name string) ([]string, error) {
+		assert.Equal(t, "_lnkby.go.acme.com", name)
+		return []string{"v=spf1 -all", "lnkby-verification=other"}, nil
+	}
+	status, _, err := verify(context.Background(), d)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Error(t, err)
+
+	lookupTXT = func(ctx context.Context, name string) ([]string, error) { return nil, errors.New("no such host") }
+	status, _, err = verify(context.Background(), d)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Error(t, err)
+}
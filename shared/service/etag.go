@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Headers of conditional requests (RFC 9110, section 13).
+const (
+	ETagHeader        = "ETag"
+	IfMatchHeader     = "If-Match"
+	IfNoneMatchHeader = "If-None-Match"
+)
+
+// VersionSQL selects the updated_at of the entity with the ID given as $1, which is maintained by the set_updated_at trigger.
+type VersionSQL[T any] string
+
+var ErrPreconditionFailed = errors.New("the entity was changed since it was retrieved, retrieve it again")
+
+// ETag is the entity tag of the version of an entity updated at the given time.
+func ETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 36) + `"`
+}
+
+// matchesETag tells whether the header is * or lists the ETag. If-Match compares the tags strongly, so weak ones (W/) never match;
+// If-None-Match compares them weakly.
+func matchesETag(header string, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag != "" && tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// version returns the ETag of the entity, empty without versionSQL; lock keeps the row from changing until the end of the transaction.
+func version[K any, T any](ctx context.Context, q Querier, versionSQL VersionSQL[T], id K, lock bool) (int, string, error) {
+	if versionSQL == "" {
+		return http.StatusOK, "", nil
+	}
+	sql := string(versionSQL)
+	if lock {
+		sql += " FOR UPDATE"
+	}
+	var updatedAt time.Time
+	if err := q.QueryRow(ctx, sql, id).Scan(&updatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, "", fmt.Errorf("failed to retrieve the version of %T with id '%v': %w", new(T), id, err)
+		}
+		return http.StatusInternalServerError, "", fmt.Errorf("failed to retrieve the version of %T with id '%v': %w", new(T), id, err)
+	}
+	return http.StatusOK, ETag(updatedAt), nil
+}
+
+// CheckVersion locks the row of the entity and fails with 412 unless its ETag matches the If-Match header.
+// There is nothing to check if the header is empty.
+func CheckVersion[K any, T any](ctx context.Context, tx pgx.Tx, versionSQL VersionSQL[T], id K, ifMatch string) (int, error) {
+	if ifMatch == "" {
+		return http.StatusOK, nil
+	}
+	status, etag, err := version(ctx, tx, versionSQL, id, true)
+	if err != nil {
+		return status, err
+	}
+	if !matchesETag(ifMatch, etag, false) {
+		return http.StatusPreconditionFailed, fmt.Errorf("failed to change %T with id '%v': %w", new(T), id, ErrPreconditionFailed)
+	}
+	return http.StatusOK, nil
+}
+
+// VersionInTx returns the ETag of the entity, e.g. after updating it in the transaction.
+func VersionInTx[K any, T any](ctx context.Context, tx pgx.Tx, versionSQL VersionSQL[T], id K) (int, string, error) {
+	return version(ctx, tx, versionSQL, id, false)
+}
+
+// RetrieveConditional retrieves the entity with its ETag, or returns 304 and no body if the ETag matches the If-None-Match header.
+// The version is read before the entity, so a concurrent update can only make the ETag older than the body and fail the next If-Match.
+func RetrieveConditional[K any, T Retrievable[K]](ctx context.Context, retrieveSQL RetrieveSQL[T], versionSQL VersionSQL[T], idString string, ifNoneMatch string, transformer func(t T) (T, error)) (int, string, string) {
+	id, err := inst[T]().ParseID(idString)
+	if err != nil {
+		status, body := failed(http.StatusNotFound, fmt.Errorf("failed to parse %T ID: %v: %w", inst[T](), idString, err))
+		return status, body, ""
+	}
+	status, etag, err := withConn(ctx, func(conn *pgxpool.Conn) (int, string, error) {
+		return version(ctx, conn, versionSQL, id, false)
+	})
+	if err != nil {
+		status, body := failed(status, err)
+		return status, body, ""
+	}
+
+	status, body := Retrieve(ctx, retrieveSQL, idString, transformer)
+	switch {
+	case status != http.StatusOK:
+		return status, body, ""
+	case ifNoneMatch != "" && matchesETag(ifNoneMatch, etag, true):
+		return http.StatusNotModified, "", etag
+	default:
+		return status, body, etag
+	}
+}
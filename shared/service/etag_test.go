@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	updatedAt := time.Date(2025, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	etag := ETag(updatedAt)
+	assert.Regexp(t, `^"[0-9a-z]+"$`, etag)
+	assert.Equal(t, etag, ETag(updatedAt.In(time.FixedZone("IDT", 3*60*60))))
+	assert.Equal(t, etag, ETag(updatedAt.Truncate(time.Microsecond)), "the DB keeps microseconds")
+	assert.NotEqual(t, etag, ETag(updatedAt.Add(time.Microsecond)))
+}
+
+func TestMatchesETag(t *testing.T) {
+	etag := `"abc"`
+	for _, example := range []struct {
+		header       string
+		strong, weak bool
+	}{
+		{`"abc"`, true, true},
+		{`"xyz", "abc"`, true, true},
+		{`W/"abc"`, false, true},
+		{`*`, true, true},
+		{` * `, true, true},
+		{`"xyz"`, false, false},
+		{`abc`, false, false},
+		{``, false, false},
+		{`,`, false, false},
+	} {
+		assert.Equal(t, example.strong, matchesETag(example.header, etag, false), example.header)
+		assert.Equal(t, example.weak, matchesETag(example.header, etag, true), example.header)
+	}
+	assert.False(t, matchesETag("*", "", false), "* needs an existing entity")
+}
@@ -0,0 +1,334 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/db"
+	"github.com/lnk.by/shared/service"
+)
+
+const (
+	userAgent    = "lnk.by-health-check/1.0"
+	maxRedirects = 10
+	tick         = time.Minute
+)
+
+// Config of the checks, see ConfigFromEnvironment.
+type Config struct {
+	Interval     time.Duration // how often every active link is checked; 0 disables the background checks
+	Batch        int           // links checked per run
+	Concurrency  int           // links checked in parallel
+	Timeout      time.Duration // of a single request, redirects included
+	BrokenAfter  int           // consecutive failed checks that flag a link as broken
+	AllowPrivate bool          // allows targets on loopback and private addresses, e.g. the local stub
+}
+
+func DefaultConfig() *Config {
+	return &Config{Interval: 24 * time.Hour, Batch: 100, Concurrency: 8, Timeout: 10 * time.Second, BrokenAfter: 2}
+}
+
+// ConfigFromEnvironment overrides the default config by HEALTH_CHECK_INTERVAL, HEALTH_CHECK_BATCH, HEALTH_CHECK_CONCURRENCY,
+// HEALTH_CHECK_TIMEOUT, HEALTH_BROKEN_AFTER and HEALTH_CHECK_ALLOW_PRIVATE.
+func ConfigFromEnvironment() (*Config, error) {
+	config := DefaultConfig()
+	for name, d := range map[string]*time.Duration{"HEALTH_CHECK_INTERVAL": &config.Interval, "HEALTH_CHECK_TIMEOUT": &config.Timeout} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("%s must be a non-negative duration, got %q", name, value)
+			}
+			*d = parsed
+		}
+	}
+	for name, n := range map[string]*int{"HEALTH_CHECK_BATCH": &config.Batch, "HEALTH_CHECK_CONCURRENCY": &config.Concurrency, "HEALTH_BROKEN_AFTER": &config.BrokenAfter} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return nil, fmt.Errorf("%s must be a positive integer, got %q", name, value)
+			}
+			*n = parsed
+		}
+	}
+	if value := os.Getenv("HEALTH_CHECK_ALLOW_PRIVATE"); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("HEALTH_CHECK_ALLOW_PRIVATE must be a boolean, got %q", value)
+		}
+		config.AllowPrivate = allow
+	}
+	return config, nil
+}
+
+// Health is the outcome of the latest check of the target of a short URL.
+type Health struct {
+	Key        string     `json:"key"`
+	Target     string     `json:"target"`
+	CheckedAt  *time.Time `json:"checkedAt"`
+	StatusCode int        `json:"statusCode"`
+	LatencyMs  int        `json:"latencyMs"`
+	FinalURL   string     `json:"finalUrl"`
+	Redirected bool       `json:"redirected"`
+	Error      string     `json:"error,omitempty"`
+	Failures   int        `json:"failures"`
+	Broken     bool       `json:"broken"`
+}
+
+func (h *Health) FieldsPtrs() []any {
+	return []any{&h.Key, &h.Target, &h.CheckedAt, &h.StatusCode, &h.LatencyMs, &h.FinalURL, &h.Error, &h.Failures, &h.Broken}
+}
+
+func (h *Health) ParseID(idString string) (string, error) {
+	return idString, nil
+}
+
+// healthy tells whether the target answered without an error status.
+func (h *Health) healthy() bool {
+	return h.Error == "" && h.StatusCode > 0 && h.StatusCode < http.StatusBadRequest
+}
+
+var errPrivateAddress = errors.New("target resolves to a private address")
+
+// Checker requests targets with HEAD, falling back to GET for servers that do not support HEAD properly.
+type Checker struct {
+	client *http.Client
+}
+
+func NewChecker(config *Config) *Checker {
+	dialer := &net.Dialer{Timeout: config.Timeout}
+	if !config.AllowPrivate {
+		// checked on the resolved address, so neither DNS nor redirects can reach the internal network
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: config.Timeout, MaxIdleConnsPerHost: 2}
+	return &Checker{client: &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}}
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// Check requests the target and records the status code, the latency and the URL reached after redirects.
+func (c *Checker) Check(ctx context.Context, target string) *Health {
+	h := c.request(ctx, http.MethodHead, target)
+	if !h.healthy() {
+		h = c.request(ctx, http.MethodGet, target)
+	}
+	return h
+}
+
+func (c *Checker) request(ctx context.Context, method string, target string) *Health {
+	now := time.Now()
+	h := &Health{Target: target, CheckedAt: &now}
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := c.client.Do(req)
+	h.LatencyMs = int(time.Since(now).Milliseconds())
+	if err != nil {
+		h.Error = err.Error()
+		return h
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024)) // lets the connection be reused
+
+	h.StatusCode = resp.StatusCode
+	h.FinalURL = resp.Request.URL.String()
+	h.Redirected = h.FinalURL != target
+	return h
+}
+
+// ClaimSQL takes the batch of active http(s) links that are due, least recently checked first; a link claimed by another
+// checker in the meantime is skipped by the conditional update.
+var ClaimSQL = `
+	WITH due AS (
+		SELECT u.key
+		FROM shorturl u
+		LEFT JOIN link_health h ON h.key = u.key
+		WHERE u.status = 'active' AND u.target ~* '^https?://'
+		AND (h.claimed_at IS NULL OR h.claimed_at < now() - make_interval(secs => $1))
+		ORDER BY h.claimed_at NULLS FIRST
+		LIMIT $2
+	)
+	INSERT INTO link_health (key, claimed_at)
+	SELECT key, now() FROM due
+	ON CONFLICT (key) DO UPDATE SET claimed_at = EXCLUDED.claimed_at
+	WHERE link_health.claimed_at < now() - make_interval(secs => $1)
+	RETURNING key, (SELECT target FROM shorturl u WHERE u.key = link_health.key)`
+
+// SaveSQL records the check; $7 tells whether it succeeded and $8 is Config.BrokenAfter.
+var SaveSQL = `
+	UPDATE link_health SET
+		checked_at = $2, status_code = $3, latency_ms = $4, final_url = $5, error = $6,
+		failures = CASE WHEN $7 THEN 0 ELSE failures + 1 END,
+		broken = NOT $7 AND failures + 1 >= $8
+	WHERE key = $1`
+
+const healthColumns = "h.key, u.target, h.checked_at, h.status_code, h.latency_ms, h.final_url, h.error, h.failures, h.broken"
+
+var RetrieveSQL service.RetrieveSQL[*Health] = "SELECT " + healthColumns + " FROM link_health h JOIN shorturl u ON u.key = h.key WHERE h.key = $1 AND h.checked_at IS NOT NULL"
+
+// ListSQL lists the checked links of the customer, latest checks first unless asked otherwise; broken=true keeps the broken ones only.
+var ListSQL = service.ListSQL[*Health]{
+	Columns:     healthColumns,
+	From:        "FROM link_health h JOIN shorturl u ON u.key = h.key WHERE u.customer_id = $1 AND h.checked_at IS NOT NULL",
+	ID:          "h.key",
+	Sorts:       map[string]string{"checkedAt": "h.checked_at", "failures": "h.failures"},
+	DefaultSort: "-checkedAt",
+	Filters: map[string]service.Filter{
+		"broken": {Condition: "h.broken OR NOT %[1]s", Type: service.BoolFilter},
+	},
+}
+
+// CheckDue checks one batch of the links that are due and returns how many of them were checked.
+func CheckDue(ctx context.Context, config *Config, checker *Checker) (int, error) {
+	due, err := claim(ctx, config)
+	if err != nil {
+		return 0, err
+	}
+
+	results := make(chan *Health)
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, config.Concurrency)
+	for _, link := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			h := checker.Check(ctx, link.Target)
+			h.Key = link.Key
+			results <- h
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	checked := 0
+	for h := range results {
+		if err := save(ctx, config, h); err != nil {
+			slog.Warn("Failed to save link health", "key", h.Key, "error", err)
+			continue
+		}
+		if !h.healthy() {
+			slog.Info("Link check failed", "key", h.Key, "target", h.Target, "statusCode", h.StatusCode, "error", h.Error)
+		}
+		checked++
+	}
+	return checked, nil
+}
+
+// claim does not keep the connection during the checks, which may take up to the timeout.
+func claim(ctx context.Context, config *Config) ([]*Health, error) {
+	conn, err := db.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, ClaimSQL, config.Interval.Seconds(), config.Batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim links to check: %w", err)
+	}
+	due, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Health, error) {
+		h := &Health{}
+		return h, row.Scan(&h.Key, &h.Target)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read links to check: %w", err)
+	}
+	return due, nil
+}
+
+func save(ctx context.Context, config *Config, h *Health) error {
+	conn, err := db.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	_, err = conn.Exec(ctx, SaveSQL, h.Key, h.CheckedAt, h.StatusCode, h.LatencyMs, h.FinalURL, h.Error, h.healthy(), config.BrokenAfter)
+	return err
+}
+
+// Start checks the links that are due every minute until the context is done; the DB must be initialized.
+func Start(ctx context.Context, config *Config) {
+	if config.Interval == 0 {
+		slog.Info("Link health checks are disabled")
+		return
+	}
+	checker := NewChecker(config)
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			// a full batch means more links are due, so the next one is checked at once
+			for {
+				checked, err := CheckDue(ctx, config, checker)
+				if err != nil {
+					slog.Error("Failed to check link health", "error", err)
+				}
+				if err != nil || checked < config.Batch {
+					break
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Retrieve returns the health of the short URL, or 404 until it is checked.
+func Retrieve(ctx context.Context, key string) (int, string) {
+	return service.Retrieve(ctx, RetrieveSQL, key, redirected)
+}
+
+// redirected tells whether the target redirected elsewhere.
+func redirected(h *Health) (*Health, error) {
+	h.Redirected = h.FinalURL != "" && h.FinalURL != h.Target
+	return h, nil
+}
+
+// List returns the health of the links of the customer, see ListSQL and service.List.
+func List(ctx context.Context, userID *uuid.UUID, params map[string]string) (int, string) {
+	return service.List(ctx, ListSQL, userID, params, redirected)
+}
@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func stubChecker(t *testing.T) (*Checker, string) {
+	server := httptest.NewServer(Stub())
+	t.Cleanup(server.Close)
+	config := DefaultConfig()
+	config.AllowPrivate = true
+	config.Timeout = 500 * time.Millisecond
+	return NewChecker(config), server.URL
+}
+
+func TestCheck(t *testing.T) {
+	checker, base := stubChecker(t)
+	ctx := context.Background()
+
+	h := checker.Check(ctx, base+"/page")
+	assert.True(t, h.healthy())
+	assert.Equal(t, http.StatusOK, h.StatusCode)
+	assert.Equal(t, base+"/page", h.FinalURL)
+	assert.False(t, h.Redirected)
+	assert.NotNil(t, h.CheckedAt)
+
+	h = checker.Check(ctx, base+"/status/404")
+	assert.False(t, h.healthy())
+	assert.Equal(t, http.StatusNotFound, h.StatusCode)
+
+	h = checker.Check(ctx, base+"/redirect/2")
+	assert.True(t, h.healthy())
+	assert.Equal(t, base+"/redirect/0", h.FinalURL)
+	assert.True(t, h.Redirected)
+
+	h = checker.Check(ctx, base+"/redirect/11")
+	assert.False(t, h.healthy())
+	assert.Contains(t, h.Error, "redirects")
+
+	// servers that refuse HEAD are checked with GET
+	h = checker.Check(ctx, base+"/no-head")
+	assert.True(t, h.healthy())
+
+	h = checker.Check(ctx, base+"/delay/1000")
+	assert.False(t, h.healthy())
+	assert.NotEmpty(t, h.Error)
+}
+
+func TestCheckPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(Stub())
+	defer server.Close()
+
+	h := NewChecker(DefaultConfig()).Check(context.Background(), server.URL)
+	assert.False(t, h.healthy())
+	assert.Contains(t, h.Error, errPrivateAddress.Error())
+}
+
+func TestConfigFromEnvironment(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1h")
+	t.Setenv("HEALTH_BROKEN_AFTER", "3")
+	t.Setenv("HEALTH_CHECK_ALLOW_PRIVATE", "true")
+	config, err := ConfigFromEnvironment()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, config.Interval)
+	assert.Equal(t, 3, config.BrokenAfter)
+	assert.True(t, config.AllowPrivate)
+	assert.Equal(t, DefaultConfig().Batch, config.Batch)
+
+	t.Setenv("HEALTH_CHECK_BATCH", "0")
+	_, err = ConfigFromEnvironment()
+	assert.Error(t, err)
+}
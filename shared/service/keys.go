@@ -0,0 +1,116 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"slices"
+)
+
+// Strategies of generation of keys: the encoded snowflake IDs are short, but sequential, so neighbours of a key are easy to guess.
+const (
+	KeyStrategySequential = "sequential"
+	KeyStrategyRandom     = "random"
+	KeyStrategyPermuted   = "permuted"
+)
+
+var KeyStrategies = []string{KeyStrategySequential, KeyStrategyRandom, KeyStrategyPermuted}
+
+func IsKeyStrategy(strategy string) bool {
+	return slices.Contains(KeyStrategies, strategy)
+}
+
+// KeyGenerator generates keys that are unique with high probability; collisions are handled by retries of CreateRecord.
+type KeyGenerator interface {
+	NextKey() (string, error)
+	// CaseInsensitive tells whether the keys are found in any case, see Alphabet.Normalize.
+	CaseInsensitive() bool
+}
+
+// SequentialKeyGenerator encodes snowflake IDs: the keys are short and unique without retries, but easy to guess.
+type SequentialKeyGenerator struct {
+	Generator *Generator
+	Alphabet  Alphabet
+}
+
+func (s *SequentialKeyGenerator) NextKey() (string, error) {
+	id, err := s.Generator.NextID()
+	if err != nil {
+		return "", err
+	}
+	return s.Alphabet.Encode(uint64(id)), nil
+}
+
+func (s *SequentialKeyGenerator) CaseInsensitive() bool {
+	return s.Alphabet.CaseInsensitive()
+}
+
+// RandomKeyGenerator generates keys of the given length from a cryptographically secure source.
+type RandomKeyGenerator struct {
+	Length   int
+	Alphabet Alphabet
+}
+
+func (r *RandomKeyGenerator) NextKey() (string, error) {
+	return r.Alphabet.Random(r.Length), nil
+}
+
+func (r *RandomKeyGenerator) CaseInsensitive() bool {
+	return r.Alphabet.CaseInsensitive()
+}
+
+const permutationRounds = 4
+
+// PermutedKeyGenerator encodes snowflake IDs passed through a keyed Feistel permutation of 64-bit numbers:
+// the keys stay unique without retries, but consecutive ones look unrelated unless the secret is known.
+type PermutedKeyGenerator struct {
+	generator *Generator
+	alphabet  Alphabet
+	secret    []byte
+}
+
+func NewPermutedKeyGenerator(generator *Generator, alphabet Alphabet, secret []byte) (*PermutedKeyGenerator, error) {
+	if len(secret) < 16 {
+		return nil, errors.New("permutation secret must be at least 16 bytes long")
+	}
+	return &PermutedKeyGenerator{generator: generator, alphabet: alphabet, secret: secret}, nil
+}
+
+func (p *PermutedKeyGenerator) NextKey() (string, error) {
+	id, err := p.generator.NextID()
+	if err != nil {
+		return "", err
+	}
+	return p.alphabet.Encode(p.Permute(uint64(id))), nil
+}
+
+func (p *PermutedKeyGenerator) CaseInsensitive() bool {
+	return p.alphabet.CaseInsensitive()
+}
+
+func (p *PermutedKeyGenerator) Permute(n uint64) uint64 {
+	left, right := uint32(n>>32), uint32(n)
+	for round := range permutationRounds {
+		left, right = right, left^p.round(round, right)
+	}
+	return uint64(left)<<32 | uint64(right)
+}
+
+// Unpermute reverses Permute.
+func (p *PermutedKeyGenerator) Unpermute(n uint64) uint64 {
+	left, right := uint32(n>>32), uint32(n)
+	for round := permutationRounds - 1; round >= 0; round-- {
+		left, right = right^p.round(round, left), left
+	}
+	return uint64(left)<<32 | uint64(right)
+}
+
+func (p *PermutedKeyGenerator) round(round int, half uint32) uint32 {
+	mac := hmac.New(sha256.New, p.secret)
+	var input [5]byte
+	input[0] = byte(round)
+	binary.BigEndian.PutUint32(input[1:], half)
+	mac.Write(input[:])
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
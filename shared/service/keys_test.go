@@ -0,0 +1,65 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomKeyGenerator(t *testing.T) {
+	keys := &RandomKeyGenerator{Length: 8, Alphabet: Alphabets[AlphabetBase62]}
+	seen := map[string]bool{}
+	for range 1000 {
+		key, err := keys.NextKey()
+		assert.NoError(t, err)
+		assert.Len(t, key, 8)
+		assert.Equal(t, -1, strings.IndexFunc(key, func(r rune) bool { return !strings.ContainsRune(base62Chars, r) }))
+		seen[key] = true
+	}
+	assert.Len(t, seen, 1000)
+}
+
+func TestPermutedKeyGenerator(t *testing.T) {
+	generator, err := NewGenerator(1)
+	assert.NoError(t, err)
+
+	_, err = NewPermutedKeyGenerator(generator, Alphabets[AlphabetBase62], []byte("short"))
+	assert.Error(t, err)
+
+	keys, err := NewPermutedKeyGenerator(generator, Alphabets[AlphabetBase62], []byte("0123456789abcdef"))
+	assert.NoError(t, err)
+	for _, n := range []uint64{0, 1, 2, 1 << 40, 1<<63 - 1, 1<<64 - 1} {
+		assert.Equal(t, n, keys.Unpermute(keys.Permute(n)))
+	}
+	// neighbours are not neighbours after the permutation
+	assert.NotEqual(t, keys.Permute(1)+1, keys.Permute(2))
+
+	other, err := NewPermutedKeyGenerator(generator, Alphabets[AlphabetBase62], []byte("fedcba9876543210"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, keys.Permute(42), other.Permute(42))
+
+	first, err := keys.NextKey()
+	assert.NoError(t, err)
+	second, err := keys.NextKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestSequentialKeyGenerator(t *testing.T) {
+	generator, err := NewGenerator(1)
+	assert.NoError(t, err)
+
+	keys := &SequentialKeyGenerator{Generator: generator, Alphabet: Alphabets[AlphabetCrockford]}
+	key, err := keys.NextKey()
+	assert.NoError(t, err)
+	assert.Equal(t, key, strings.ToLower(key))
+	next, err := keys.NextKey()
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, next)
+}
+
+func TestIsKeyStrategy(t *testing.T) {
+	assert.True(t, IsKeyStrategy(KeyStrategyRandom))
+	assert.False(t, IsKeyStrategy("guessable"))
+}
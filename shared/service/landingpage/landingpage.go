@@ -52,12 +52,13 @@ func (p *LandingPage) Validate() error {
 	}
 }
 
-func (p *LandingPage) Generate() {
+func (p *LandingPage) Generate() error {
 	p.ID = service.UUID()
 
 	if p.Status == "" {
 		p.Status = utils.StatusActive
 	}
+	return nil
 }
 
 var (
@@ -65,16 +66,20 @@ var (
 	RetrieveSQL service.RetrieveSQL[*LandingPage] = "SELECT id, name, template, style, organization_id, customer_id, status FROM landingpage WHERE id = $1 AND status='active'"
 	UpdateSQL   service.UpdateSQL[*LandingPage]   = "UPDATE landingpage SET name = $2, template=$3, style=$4, customer_id=$5, organization_id = $6, status = $7 WHERE id = $1"
 	DeleteSQL   service.DeleteSQL[*LandingPage]   = "DELETE FROM landingpage WHERE id = $1"
+	VersionSQL  service.VersionSQL[*LandingPage]  = "SELECT updated_at FROM landingpage WHERE id = $1"
 	// Right now select all landing pages that belong to the same organization together with the currently logged in customer.
-	ListSQL service.ListSQL[*LandingPage] = `
-		SELECT p.id, p.name, p.template, p.style, p.organization_id, p.customer_id, p.status
-		FROM landingpage p
-		JOIN customer me ON me.id = $1
-		WHERE p.status = 'active'
-		AND (p.customer_id = me.id OR p.organization_id = me.organization_id)
-		AND now() BETWEEN valid_from AND valid_until
-		OFFSET $2 LIMIT $3
-	`
+	ListSQL = service.ListSQL[*LandingPage]{
+		Columns: "p.id, p.name, p.template, p.style, p.organization_id, p.customer_id, p.status",
+		From: `FROM landingpage p JOIN customer me ON me.id = $1
+			WHERE p.status = 'active' AND (p.customer_id = me.id OR p.organization_id = me.organization_id) AND now() BETWEEN p.valid_from AND p.valid_until`,
+		ID:    "p.id",
+		Sorts: map[string]string{"name": "p.name", "template": "p.template", "createdAt": "p.created_at", "updatedAt": "p.updated_at"},
+		Filters: map[string]service.Filter{
+			"name":     {Condition: "p.name ILIKE %[1]s", Type: service.ContainsFilter},
+			"template": {Condition: "p.template = %[1]s", Type: service.TextFilter},
+		},
+		DefaultSort: "createdAt",
+	}
 )
 
 func SetConfiguration(ctx context.Context, page *LandingPage) (*LandingPage, error) {
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/lnk.by/shared/utils"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ListSQL describes the list of an entity. The query is
+//
+//	SELECT <Columns> <From> AND <filters> ORDER BY <sort field>, <ID>
+//
+// so Columns are the ones of FieldsPtrs and From ends with a WHERE clause selecting the entities visible to the user given as $1.
+type ListSQL[T any] struct {
+	Columns     string
+	From        string
+	Unscoped    bool              // From does not refer to the user, e.g. of the lists of moderators authorized beforehand
+	ID          string            // unique column that breaks the ties of the sort fields
+	Sorts       map[string]string // sort fields accepted by the sort parameter and their (not null) columns
+	DefaultSort string            // the ID if empty
+	Filters     map[string]Filter // query parameters the list may be filtered by
+}
+
+// Filter is a query parameter: its value is converted by Type and the placeholder of the result is %[1]s in Condition.
+type Filter struct {
+	Condition string
+	Type      FilterType
+	Default   string // applied when the parameter is missing
+}
+
+// FilterType converts the value of a query parameter to the argument of a filter condition.
+type FilterType func(value string) (any, error)
+
+var (
+	TextFilter FilterType = func(value string) (any, error) { return value, nil }
+	UUIDFilter FilterType = func(value string) (any, error) { return uuid.FromString(value) }
+	BoolFilter FilterType = func(value string) (any, error) { return strconv.ParseBool(value) }
+	TimeFilter FilterType = func(value string) (any, error) { return time.Parse(time.RFC3339, value) }
+	// ContainsFilter is a LIKE pattern matching the value anywhere, use it with ILIKE.
+	ContainsFilter FilterType = func(value string) (any, error) { return "%" + EscapeLike(value) + "%", nil }
+	TagFilter      FilterType = func(value string) (any, error) { return utils.NormalizeTag(value), nil }
+)
+
+// EscapeLike makes the wildcards of LIKE match themselves.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Page is the response of a list asked for with any of the list parameters; without them the list is a plain array, as it used
+// to be, of the first MaxPageSize entities. Next is the cursor parameter of the following page, empty on the last one;
+// Total counts all the entities matching the filters.
+type Page[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Total int    `json:"total"`
+}
+
+// Parameters of a list, the other ones are filters.
+const (
+	SortParam   = "sort"   // a sort field, descending if prefixed with "-"
+	CursorParam = "cursor" // the next token of the previous page
+	OffsetParam = "offset" // rows skipped after the cursor
+	LimitParam  = "limit"  // DefaultPageSize by default, MaxPageSize at most
+)
+
+var listParams = []string{SortParam, CursorParam, OffsetParam, LimitParam}
+
+// cursor keeps the position after the last row of a page: the values of its sort field and ID.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"i"`
+}
+
+func (c cursor) encode() string {
+	content, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeCursor(token string) (cursor, error) {
+	var c cursor
+	content, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(content, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid %s", CursorParam)
+	}
+	return c, nil
+}
+
+// listQuery is a list request translated to SQL.
+type listQuery struct {
+	sql      string
+	countSQL string
+	args     []any
+	count    int // of the args of countSQL
+	sort     string
+	limit    int
+	paged    bool // any of the list parameters is given, see Page
+}
+
+func (l ListSQL[T]) query(userID *uuid.UUID, params map[string]string) (*listQuery, error) {
+	q := &listQuery{args: []any{userID}, limit: DefaultPageSize}
+	q.paged = slices.ContainsFunc(listParams, func(name string) bool { return params[name] != "" })
+	if l.Unscoped {
+		q.args = nil
+	}
+	placeholder := func(arg any) string {
+		q.args = append(q.args, arg)
+		return "$" + strconv.Itoa(len(q.args))
+	}
+
+	var where strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(l.Filters)) {
+		filter := l.Filters[name]
+		value := params[name]
+		if value == "" {
+			value = filter.Default
+		}
+		if value == "" {
+			continue
+		}
+		arg, err := filter.Type(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+		fmt.Fprintf(&where, " AND (%s)", fmt.Sprintf(filter.Condition, placeholder(arg)))
+	}
+	q.countSQL = "SELECT count(*) " + l.From + where.String()
+	q.count = len(q.args)
+
+	q.sort = params[SortParam]
+	if q.sort == "" {
+		q.sort = l.DefaultSort
+	}
+	column, desc := l.ID, false
+	if q.sort != "" {
+		var ok bool
+		if column, ok = l.Sorts[strings.TrimPrefix(q.sort, "-")]; !ok {
+			return nil, fmt.Errorf("invalid %s %q, use one of %v (prefixed with - for descending order)", SortParam, q.sort, slices.Sorted(maps.Keys(l.Sorts)))
+		}
+		desc = strings.HasPrefix(q.sort, "-")
+	}
+	direction, after := "ASC", ">"
+	if desc {
+		direction, after = "DESC", "<"
+	}
+
+	if token := params[CursorParam]; token != "" {
+		c, err := decodeCursor(token)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != q.sort {
+			return nil, fmt.Errorf("%s was issued for %s %q", CursorParam, SortParam, c.Sort)
+		}
+		if column == l.ID {
+			fmt.Fprintf(&where, " AND %s %s %s", l.ID, after, placeholder(c.ID))
+		} else {
+			fmt.Fprintf(&where, " AND (%s, %s) %s (%s, %s)", column, l.ID, after, placeholder(c.Value), placeholder(c.ID))
+		}
+	}
+
+	offset, err := intParam(params, OffsetParam, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	if q.limit, err = intParam(params, LimitParam, DefaultPageSize, 1); err != nil {
+		return nil, err
+	}
+	q.limit = min(q.limit, MaxPageSize)
+	if !q.paged {
+		q.limit = MaxPageSize
+	}
+
+	order := fmt.Sprintf("%s %s, %s %s", column, direction, l.ID, direction)
+	if column == l.ID {
+		order = fmt.Sprintf("%s %s", l.ID, direction)
+	}
+	// one more row than asked tells whether there is a next page
+	q.sql = fmt.Sprintf("SELECT %s, (%s)::text, (%s)::text %s%s ORDER BY %s OFFSET %s LIMIT %s",
+		l.Columns, column, l.ID, l.From, where.String(), order, placeholder(offset), placeholder(q.limit+1))
+	return q, nil
+}
+
+// List returns a page of the entities visible to the user, see ListSQL and the list parameters, or a plain array without the parameters.
+func List[K any, T Retrievable[K]](ctx context.Context, listSQL ListSQL[T], userID *uuid.UUID, params map[string]string, transformer func(t T) (T, error)) (int, string) {
+	q, err := listSQL.query(userID, params)
+	if err != nil {
+		return failed(http.StatusBadRequest, err)
+	}
+
+	return Marshal(withConn(ctx, func(conn *pgxpool.Conn) (int, any, error) {
+		page := &Page[T]{Items: make([]T, 0)}
+		if q.paged {
+			if err := conn.QueryRow(ctx, q.countSQL, q.args[:q.count]...).Scan(&page.Total); err != nil {
+				return http.StatusInternalServerError, nil, fmt.Errorf("failed to count %T: %w", new(T), err)
+			}
+		}
+
+		rows, err := conn.Query(ctx, q.sql, q.args...)
+		if err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to execute list query for %T: %w", new(T), err)
+		}
+		defer rows.Close()
+
+		var last cursor
+		for rows.Next() {
+			if len(page.Items) == q.limit {
+				page.Next = last.encode()
+				break
+			}
+			t := inst[T]()
+			last = cursor{Sort: q.sort}
+			if err := rows.Scan(append(t.FieldsPtrs(), &last.Value, &last.ID)...); err != nil {
+				return http.StatusInternalServerError, nil, fmt.Errorf("failed to scan row to build the %T: %w", t, err)
+			}
+			t, err = transformer(t)
+			if err != nil {
+				return http.StatusInternalServerError, nil, fmt.Errorf("failed to transform row value %T: %w", t, err)
+			}
+			page.Items = append(page.Items, t)
+		}
+		if err := rows.Err(); err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to read %T: %w", new(T), err)
+		}
+
+		if !q.paged {
+			return http.StatusOK, page.Items, nil
+		}
+		return http.StatusOK, page, nil
+	}))
+}
+
+func intParam(params map[string]string, name string, defaultValue int, minValue int) (int, error) {
+	value := params[name]
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue {
+		return 0, fmt.Errorf("%s must be an integer not less than %d, got %q", name, minValue, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type listed struct{}
+
+var testListSQL = ListSQL[*listed]{
+	Columns: "t.id, t.name",
+	From:    "FROM thing t WHERE t.owner = $1",
+	ID:      "t.id",
+	Sorts:   map[string]string{"name": "t.name", "createdAt": "t.created_at"},
+	Filters: map[string]Filter{
+		"name":   {Condition: "t.name ILIKE %[1]s", Type: ContainsFilter},
+		"status": {Condition: "t.status = %[1]s", Type: TextFilter, Default: "active"},
+		"since":  {Condition: "t.created_at >= %[1]s", Type: TimeFilter},
+	},
+	DefaultSort: "createdAt",
+}
+
+func TestListQuery(t *testing.T) {
+	userID := uuid.Must(uuid.NewV4())
+
+	q, err := testListSQL.query(&userID, map[string]string{"limit": "100"})
+	assert.NoError(t, err)
+	assert.True(t, q.paged)
+	assert.Equal(t, "SELECT count(*) FROM thing t WHERE t.owner = $1 AND (t.status = $2)", q.countSQL)
+	assert.Equal(t, "SELECT t.id, t.name, (t.created_at)::text, (t.id)::text FROM thing t WHERE t.owner = $1 AND (t.status = $2) ORDER BY t.created_at ASC, t.id ASC OFFSET $3 LIMIT $4", q.sql)
+	assert.Equal(t, []any{&userID, "active", 0, DefaultPageSize + 1}, q.args)
+	assert.Equal(t, 2, q.count)
+	assert.Equal(t, DefaultPageSize, q.limit)
+
+	// without the list parameters the entities are listed as a plain array, still of MaxPageSize at most
+	q, err = testListSQL.query(&userID, map[string]string{"name": "summer"})
+	assert.NoError(t, err)
+	assert.False(t, q.paged)
+	assert.Equal(t, "SELECT t.id, t.name, (t.created_at)::text, (t.id)::text FROM thing t WHERE t.owner = $1 AND (t.name ILIKE $2) AND (t.status = $3) ORDER BY t.created_at ASC, t.id ASC OFFSET $4 LIMIT $5", q.sql)
+	assert.Equal(t, []any{&userID, "%summer%", "active", 0, MaxPageSize + 1}, q.args)
+	assert.Equal(t, MaxPageSize, q.limit)
+
+	q, err = testListSQL.query(&userID, map[string]string{"name": "50%", "status": "cancelled", "sort": "-name", "limit": "5000", "offset": "10"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT t.id, t.name, (t.name)::text, (t.id)::text FROM thing t WHERE t.owner = $1 AND (t.name ILIKE $2) AND (t.status = $3) ORDER BY t.name DESC, t.id DESC OFFSET $4 LIMIT $5", q.sql)
+	assert.Equal(t, []any{&userID, `%50\%%`, "cancelled", 10, MaxPageSize + 1}, q.args)
+	assert.Equal(t, MaxPageSize, q.limit)
+}
+
+func TestListQueryCursor(t *testing.T) {
+	token := cursor{Sort: "-name", Value: "beta", ID: "42"}.encode()
+	q, err := testListSQL.query(nil, map[string]string{"sort": "-name", "cursor": token, "limit": "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM thing t WHERE t.owner = $1 AND (t.status = $2)", q.countSQL)
+	assert.Equal(t, "SELECT t.id, t.name, (t.name)::text, (t.id)::text FROM thing t WHERE t.owner = $1 AND (t.status = $2) AND (t.name, t.id) < ($3, $4) ORDER BY t.name DESC, t.id DESC OFFSET $5 LIMIT $6", q.sql)
+	assert.Equal(t, []any{(*uuid.UUID)(nil), "active", "beta", "42", 0, 3}, q.args)
+
+	// sorting by the ID needs no tie-breaker
+	noSorts := testListSQL
+	noSorts.DefaultSort = ""
+	token = cursor{ID: "42"}.encode()
+	q, err = noSorts.query(nil, map[string]string{"cursor": token})
+	assert.NoError(t, err)
+	assert.Contains(t, q.sql, "AND t.id > $3 ORDER BY t.id ASC OFFSET")
+
+	// a cursor is only valid for the sort it was issued for
+	_, err = testListSQL.query(nil, map[string]string{"sort": "name", "cursor": cursor{Sort: "-name"}.encode()})
+	assert.Error(t, err)
+}
+
+func TestListQueryUnscoped(t *testing.T) {
+	unscoped := testListSQL
+	unscoped.From, unscoped.Unscoped = "FROM thing t WHERE TRUE", true
+	q, err := unscoped.query(nil, map[string]string{"sort": "createdAt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT count(*) FROM thing t WHERE TRUE AND (t.status = $1)", q.countSQL)
+	assert.Equal(t, []any{"active", 0, DefaultPageSize + 1}, q.args)
+	assert.Equal(t, 1, q.count)
+}
+
+func TestListQueryInvalid(t *testing.T) {
+	for _, params := range []map[string]string{
+		{"sort": "owner"},
+		{"cursor": "!!!"},
+		{"limit": "0"},
+		{"limit": "ten"},
+		{"offset": "-1"},
+		{"since": "yesterday"},
+	} {
+		_, err := testListSQL.query(nil, params)
+		assert.Error(t, err, params)
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/lnk.by/shared/db"
+)
+
+// Sources of machine IDs in MACHINE_ID besides an explicit number.
+const (
+	MachineIDHostname = "hostname" // the ordinal of a pod of a StatefulSet, e.g. 3 of "server-3"
+	MachineIDLease    = "lease"    // leased from the machine_lease table, see Generator.Start
+)
+
+const (
+	machineLeaseTTL       = time.Minute
+	machineLeaseHeartbeat = machineLeaseTTL / 3
+	machineLeaseMargin    = 5 * time.Second // for the clocks of the machine and of the DB to differ
+	machineLeaseWait      = 5 * time.Second // for a renewal once the lease may have expired, see NextID
+)
+
+var hostnameOrdinal = regexp.MustCompile(`-(\d+)$`)
+
+// MachineIDFromEnvironment returns the machine ID of MACHINE_ID, and whether it is to be leased. Without MACHINE_ID the ID is
+// a hash of the log stream of the lambda or of the hostname, which may collide: replicas of the server should set it.
+func MachineIDFromEnvironment() (int64, bool, error) {
+	switch value := os.Getenv("MACHINE_ID"); value {
+	case "":
+		return hashedMachineID(), false, nil
+	case MachineIDHostname:
+		hostname, err := os.Hostname()
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get hostname: %w", err)
+		}
+		id, err := ordinalOf(hostname)
+		return id, false, err
+	case MachineIDLease:
+		// used until the lease is acquired
+		return hashedMachineID(), true, nil
+	default:
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 || id > maxMachineID {
+			return 0, false, fmt.Errorf("MACHINE_ID must be %q, %q or a number between 0 and %d, got %q", MachineIDHostname, MachineIDLease, maxMachineID, value)
+		}
+		return id, false, nil
+	}
+}
+
+func ordinalOf(hostname string) (int64, error) {
+	match := hostnameOrdinal.FindStringSubmatch(hostname)
+	if match == nil {
+		return 0, fmt.Errorf("hostname %q does not end with an ordinal", hostname)
+	}
+	id, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || id > maxMachineID {
+		return 0, fmt.Errorf("ordinal of hostname %q must be at most %d", hostname, maxMachineID)
+	}
+	return id, nil
+}
+
+func hashedMachineID() int64 {
+	val := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
+	if val == "" {
+		val, _ = os.Hostname()
+	}
+	if val == "" {
+		val = "default-machine"
+	}
+	h := fnv.New32a()
+	h.Write([]byte(val))
+	return int64(h.Sum32() & maxMachineID)
+}
+
+// AcquireMachineLeaseSQL takes the lowest machine ID that is not leased or whose lease has expired; a concurrent acquirer
+// of the same ID gets no rows and retries.
+var AcquireMachineLeaseSQL = `
+	INSERT INTO machine_lease (machine_id, owner, expires_at)
+	SELECT id, $1, now() + make_interval(secs => $2)
+	FROM generate_series(0, 1023) id
+	WHERE NOT EXISTS (SELECT 1 FROM machine_lease l WHERE l.machine_id = id AND l.expires_at > now())
+	ORDER BY id
+	LIMIT 1
+	ON CONFLICT (machine_id) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+	WHERE machine_lease.expires_at <= now()
+	RETURNING machine_id`
+
+var (
+	RenewMachineLeaseSQL   = "UPDATE machine_lease SET expires_at = now() + make_interval(secs => $3) WHERE machine_id = $1 AND owner = $2"
+	ReleaseMachineLeaseSQL = "DELETE FROM machine_lease WHERE machine_id = $1 AND owner = $2"
+)
+
+const maxLeaseAttempts = 5
+
+var errNoMachineID = errors.New("all machine IDs are leased")
+
+// Start leases the machine ID when MACHINE_ID=lease and renews the lease until the context is done; the DB must be initialized.
+// A lost lease (e.g. after a long pause) is replaced by a new one. While the lease cannot be renewed, IDs are generated
+// till it may expire, then NextID waits for a renewal and fails with ErrLeaseExpired.
+func (g *Generator) Start(ctx context.Context) error {
+	if !g.lease {
+		return nil
+	}
+
+	owner, err := leaseOwner()
+	if err != nil {
+		return err
+	}
+	leasedAt := time.Now()
+	id, err := acquireMachineLease(ctx, owner)
+	if err != nil {
+		return err
+	}
+	g.setMachineID(id, leasedAt)
+	slog.Info("Leased machine ID", "machineId", id, "owner", owner)
+
+	go func() {
+		ticker := time.NewTicker(machineLeaseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				releaseMachineLease(id, owner)
+				return
+			case <-ticker.C:
+				renewedAt := time.Now()
+				renewed, err := renewMachineLease(ctx, id, owner)
+				if err != nil {
+					slog.Error("Failed to renew machine ID lease", "machineId", id, "error", err)
+					continue
+				}
+				id = renewed
+				g.setMachineID(id, renewedAt)
+			}
+		}
+	}()
+	return nil
+}
+
+// setMachineID switches to the machine ID leased (or renewed) at the given time and wakes up NextID waiting for the lease.
+func (g *Generator) setMachineID(id int64, leasedAt time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.machineID = id
+	g.leasedTill = leasedAt.Add(machineLeaseTTL - machineLeaseMargin).UnixMilli()
+	g.renewed.Broadcast()
+}
+
+func leaseOwner() (string, error) {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate lease owner: %w", err)
+	}
+	return fmt.Sprintf("%s/%d/%s", hostname, os.Getpid(), hex.EncodeToString(suffix)), nil
+}
+
+func acquireMachineLease(ctx context.Context, owner string) (int64, error) {
+	conn, err := db.Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Release()
+
+	for range maxLeaseAttempts {
+		var id int64
+		err = conn.QueryRow(ctx, AcquireMachineLeaseSQL, owner, machineLeaseTTL.Seconds()).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, fmt.Errorf("failed to lease machine ID: %w", err)
+		}
+	}
+	return 0, errNoMachineID
+}
+
+// renewMachineLease extends the lease, or acquires a new one if it has been taken over.
+func renewMachineLease(ctx context.Context, id int64, owner string) (int64, error) {
+	conn, err := db.Get(ctx)
+	if err != nil {
+		return id, err
+	}
+	tag, err := conn.Exec(ctx, RenewMachineLeaseSQL, id, owner, machineLeaseTTL.Seconds())
+	conn.Release()
+	switch {
+	case err != nil:
+		return id, fmt.Errorf("failed to renew lease of machine ID %d: %w", id, err)
+	case tag.RowsAffected() == 0:
+		slog.Warn("Lost machine ID lease", "machineId", id, "owner", owner)
+		return acquireMachineLease(ctx, owner)
+	default:
+		return id, nil
+	}
+}
+
+func releaseMachineLease(id int64, owner string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := db.Get(ctx)
+	if err != nil {
+		slog.Warn("Failed to release machine ID lease", "machineId", id, "error", err)
+		return
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, ReleaseMachineLeaseSQL, id, owner); err != nil {
+		slog.Warn("Failed to release machine ID lease", "machineId", id, "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachineIDFromEnvironment(t *testing.T) {
+	t.Setenv("MACHINE_ID", "42")
+	id, lease, err := MachineIDFromEnvironment()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+	assert.False(t, lease)
+
+	t.Setenv("MACHINE_ID", "1024")
+	_, _, err = MachineIDFromEnvironment()
+	assert.Error(t, err)
+
+	t.Setenv("MACHINE_ID", MachineIDLease)
+	id, lease, err = MachineIDFromEnvironment()
+	assert.NoError(t, err)
+	assert.Equal(t, hashedMachineID(), id)
+	assert.True(t, lease)
+
+	t.Setenv("MACHINE_ID", "")
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2025/06/01/[$LATEST]abc")
+	first, _, err := MachineIDFromEnvironment()
+	assert.NoError(t, err)
+	t.Setenv("AWS_LAMBDA_LOG_STREAM_NAME", "2025/06/01/[$LATEST]def")
+	second, _, err := MachineIDFromEnvironment()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestOrdinalOf(t *testing.T) {
+	id, err := ordinalOf("server-3")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), id)
+
+	_, err = ordinalOf("server")
+	assert.Error(t, err)
+
+	_, err = ordinalOf("server-2048")
+	assert.Error(t, err)
+}
+
+func TestNewDefaultGeneratorWithLease(t *testing.T) {
+	t.Setenv("MACHINE_ID", MachineIDLease)
+	generator, err := NewDefaultGenerator()
+	assert.NoError(t, err)
+	assert.True(t, generator.lease)
+
+	t.Setenv("MACHINE_ID", "5")
+	generator, err = NewDefaultGenerator()
+	assert.NoError(t, err)
+	assert.False(t, generator.lease)
+	assert.NoError(t, generator.Start(t.Context())) // nothing to lease
+}
+
+func TestNextIDWaitsForExpiredLease(t *testing.T) {
+	generator, err := NewGenerator(1)
+	assert.NoError(t, err)
+	leasedAt := time.Now()
+	generator.setMachineID(2, leasedAt)
+	id, err := generator.NextID()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), id>>machineIDShift&maxMachineID)
+
+	generator.clock = func() int64 { return leasedAt.Add(machineLeaseTTL).UnixMilli() }
+	ids := make(chan int64)
+	go func() {
+		id, _ := generator.NextID()
+		ids <- id
+	}()
+	select {
+	case <-ids:
+		assert.Fail(t, "an ID is generated after the lease may have expired")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	generator.setMachineID(3, leasedAt.Add(machineLeaseTTL))
+	select {
+	case id := <-ids:
+		assert.Equal(t, int64(3), id>>machineIDShift&maxMachineID)
+	case <-time.After(time.Second):
+		assert.Fail(t, "the renewed lease does not resume generation")
+	}
+}
+
+func TestNextIDFailsOnceLeaseIsNotRenewed(t *testing.T) {
+	generator, err := NewGenerator(1)
+	assert.NoError(t, err)
+	generator.leaseWait = 20 * time.Millisecond
+	leasedAt := time.Now().Add(-machineLeaseTTL)
+	generator.setMachineID(2, leasedAt)
+
+	_, err = generator.NextID()
+	assert.ErrorIs(t, err, ErrLeaseExpired)
+}
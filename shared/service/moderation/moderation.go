@@ -0,0 +1,344 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+)
+
+type Reason string
+
+const (
+	ReasonPhishing Reason = "phishing"
+	ReasonMalware  Reason = "malware"
+	ReasonSpam     Reason = "spam"
+	ReasonIllegal  Reason = "illegal"
+	ReasonOther    Reason = "other"
+)
+
+var reasons = []Reason{ReasonPhishing, ReasonMalware, ReasonSpam, ReasonIllegal, ReasonOther}
+
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+const (
+	ActionSuspend = "suspend"
+	ActionRestore = "restore"
+	ActionBan     = "ban"
+	ActionDismiss = "dismiss"
+)
+
+const (
+	maxDetails = 4096
+	maxContact = 255
+)
+
+var (
+	ErrForbidden       = errors.New("only moderators can review reports")
+	ErrUnknownReason   = fmt.Errorf("reason must be one of %v", reasons)
+	ErrDetailsTooLong  = fmt.Errorf("details must be at most %d characters", maxDetails)
+	ErrContactTooLong  = fmt.Errorf("contact must be at most %d characters", maxContact)
+	ErrReportNotOpen   = errors.New("the report is not open")
+	ErrNotSuspended    = errors.New("the short URL is not suspended")
+	ErrShortURLUnknown = errors.New("the short URL does not exist")
+)
+
+// Report of a short URL by the public; Target and ShortURLStatus are only set in the moderation queue.
+type Report struct {
+	ID             uuid.UUID  `json:"id"`
+	Key            string     `json:"key"`
+	Reason         Reason     `json:"reason"`
+	Details        string     `json:"details"`
+	Contact        string     `json:"contact"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+	Target         string     `json:"target,omitempty"`
+	ShortURLStatus string     `json:"shortUrlStatus,omitempty"`
+}
+
+func (r *Report) ParseID(idString string) (uuid.UUID, error) {
+	return uuid.FromString(idString)
+}
+
+func (r *Report) FieldsPtrs() []any {
+	return []any{&r.ID, &r.Key, &r.Reason, &r.Details, &r.Contact, &r.Status, &r.CreatedAt, &r.ResolvedAt, &r.Target, &r.ShortURLStatus}
+}
+
+func (r *Report) Validate() error {
+	r.Reason = Reason(strings.ToLower(strings.TrimSpace(string(r.Reason))))
+	r.Details = strings.TrimSpace(r.Details)
+	r.Contact = strings.TrimSpace(r.Contact)
+	switch {
+	case !slices.Contains(reasons, r.Reason):
+		return ErrUnknownReason
+	case len(r.Details) > maxDetails:
+		return ErrDetailsTooLong
+	case len(r.Contact) > maxContact:
+		return ErrContactTooLong
+	default:
+		return nil
+	}
+}
+
+// Action of a moderator, kept as the audit of moderation.
+type Action struct {
+	ID          uuid.UUID  `json:"id"`
+	Action      string     `json:"action"`
+	Key         *string    `json:"key,omitempty"`
+	CustomerID  *uuid.UUID `json:"customerId,omitempty"`
+	ReportID    *uuid.UUID `json:"reportId,omitempty"`
+	ModeratorID uuid.UUID  `json:"moderatorId"`
+	Note        string     `json:"note"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	// Affected lists the keys of the short URLs suspended or restored by the action.
+	Affected []string `json:"affected,omitempty"`
+}
+
+func (a *Action) FieldsVals() []any {
+	return []any{a.ID, a.Action, a.Key, a.CustomerID, a.ReportID, a.ModeratorID, a.Note, a.CreatedAt}
+}
+
+func (a *Action) ParseID(idString string) (uuid.UUID, error) {
+	return uuid.FromString(idString)
+}
+
+func (a *Action) FieldsPtrs() []any {
+	return []any{&a.ID, &a.Action, &a.Key, &a.CustomerID, &a.ReportID, &a.ModeratorID, &a.Note, &a.CreatedAt}
+}
+
+// request is the optional body of the moderation actions.
+type request struct {
+	Note string `json:"note"`
+}
+
+var (
+	// CreateReportSQL only accepts reports of existing short URLs.
+	CreateReportSQL = `
+		INSERT INTO abuse_report (id, key, reason, details, contact, status, created_at)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE EXISTS (SELECT 1 FROM shorturl WHERE key = $2)`
+	DismissReportSQL   = "UPDATE abuse_report SET status = 'dismissed', resolved_at = now() WHERE id = $1 AND status = 'open' RETURNING key"
+	ResolveReportsSQL  = "UPDATE abuse_report SET status = 'resolved', resolved_at = now() WHERE key = ANY($1) AND status = 'open'"
+	SuspendShortURLSQL = "UPDATE shorturl SET status = 'suspended' WHERE key = $1 AND status IN ('active', 'suspended') RETURNING customer_id"
+	RestoreShortURLSQL = "UPDATE shorturl SET status = 'active' WHERE key = $1 AND status = 'suspended' RETURNING customer_id"
+	BanCustomerSQL     = "UPDATE customer SET status = 'banned' WHERE id = $1"
+	SuspendCustomerSQL = "UPDATE shorturl SET status = 'suspended' WHERE customer_id = $1 AND status = 'active' RETURNING key"
+	CreateActionSQL    = "INSERT INTO moderation_action (id, action, key, customer_id, report_id, moderator_id, note, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+)
+
+// ListReportsSQL lists the reports of the moderation queue, the open ones oldest first unless asked otherwise.
+var ListReportsSQL = service.ListSQL[*Report]{
+	Columns:  "r.id, r.key, r.reason, r.details, r.contact, r.status, r.created_at, r.resolved_at, COALESCE(u.target, ''), COALESCE(u.status, '')",
+	From:     "FROM abuse_report r LEFT JOIN shorturl u ON u.key = r.key WHERE TRUE",
+	Unscoped: true,
+	ID:       "r.id",
+	Sorts:    map[string]string{"createdAt": "r.created_at"},
+	Filters: map[string]service.Filter{
+		"status": {Condition: "r.status = %[1]s", Type: reportStatusFilter, Default: ReportOpen},
+		"key":    {Condition: "r.key = %[1]s", Type: service.TextFilter},
+	},
+	DefaultSort: "createdAt",
+}
+
+// ListActionsSQL lists the audit of moderation, latest first unless asked otherwise.
+var ListActionsSQL = service.ListSQL[*Action]{
+	Columns:  "id, action, key, customer_id, report_id, moderator_id, note, created_at",
+	From:     "FROM moderation_action WHERE TRUE",
+	Unscoped: true,
+	ID:       "id",
+	Sorts:    map[string]string{"createdAt": "created_at"},
+	Filters: map[string]service.Filter{
+		"action":      {Condition: "action = %[1]s", Type: service.TextFilter},
+		"key":         {Condition: "key = %[1]s", Type: service.TextFilter},
+		"customerId":  {Condition: "customer_id = %[1]s", Type: service.UUIDFilter},
+		"moderatorId": {Condition: "moderator_id = %[1]s", Type: service.UUIDFilter},
+	},
+	DefaultSort: "-createdAt",
+}
+
+func reportStatusFilter(value string) (any, error) {
+	if value != ReportOpen && value != ReportResolved && value != ReportDismissed {
+		return nil, fmt.Errorf("use %q, %q or %q", ReportOpen, ReportResolved, ReportDismissed)
+	}
+	return value, nil
+}
+
+// Moderator returns the ID of the user if the user is a moderator, see service.IsAdmin. The subject and the groups must be verified:
+// by the JWT authorizer of API Gateway for the lambdas, by auth.VerifyBearer for the server.
+func Moderator(sub string, groups []string) (int, *uuid.UUID, error) {
+	moderatorID := service.ToUUID(sub)
+	switch {
+	case moderatorID == nil:
+		return http.StatusUnauthorized, nil, errors.New("authentication is required to moderate")
+	case !service.IsAdmin(sub, groups):
+		return http.StatusForbidden, moderatorID, ErrForbidden
+	default:
+		return http.StatusOK, moderatorID, nil
+	}
+}
+
+// CreateReport files a report of the short URL by anyone; reports are reviewed in the moderation queue.
+func CreateReport(ctx context.Context, key string, requestBody []byte) (int, string) {
+	report := &Report{}
+	if err := json.Unmarshal(requestBody, report); err != nil {
+		return service.Marshal(http.StatusBadRequest, report, fmt.Errorf("failed to unmarshal %T from JSON: %w", report, err))
+	}
+	if err := report.Validate(); err != nil {
+		return service.Marshal(http.StatusBadRequest, report, err)
+	}
+	report.ID, report.Key, report.Status, report.CreatedAt = service.UUID(), key, ReportOpen, time.Now()
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Report, error) {
+		tag, err := tx.Exec(ctx, CreateReportSQL, report.ID, report.Key, report.Reason, report.Details, report.Contact, report.Status, report.CreatedAt)
+		switch {
+		case err != nil:
+			return http.StatusInternalServerError, report, fmt.Errorf("failed to report short URL %q: %w", key, err)
+		case tag.RowsAffected() == 0:
+			return http.StatusNotFound, report, ErrShortURLUnknown
+		}
+		return http.StatusCreated, report, nil
+	}))
+}
+
+// ListReports returns a page of the moderation queue, see ListReportsSQL and service.List.
+func ListReports(ctx context.Context, params map[string]string) (int, string) {
+	return service.List(ctx, ListReportsSQL, nil, params, func(r *Report) (*Report, error) { return r, nil })
+}
+
+// ListActions returns a page of the audit of moderation, see ListActionsSQL and service.List.
+func ListActions(ctx context.Context, params map[string]string) (int, string) {
+	return service.List(ctx, ListActionsSQL, nil, params, func(a *Action) (*Action, error) { return a, nil })
+}
+
+// DismissReport closes the report without acting on the short URL.
+func DismissReport(ctx context.Context, id string, requestBody []byte, moderatorID uuid.UUID) (int, string) {
+	reportID, err := uuid.FromString(id)
+	if err != nil {
+		return service.Marshal(http.StatusNotFound, &Action{}, fmt.Errorf("failed to parse report ID: %v: %w", id, err))
+	}
+	action, err := newAction(ActionDismiss, requestBody, moderatorID)
+	if err != nil {
+		return service.Marshal(http.StatusBadRequest, action, err)
+	}
+	action.ReportID = &reportID
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Action, error) {
+		var key string
+		if err := tx.QueryRow(ctx, DismissReportSQL, reportID).Scan(&key); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return http.StatusConflict, action, ErrReportNotOpen
+			}
+			return http.StatusInternalServerError, action, fmt.Errorf("failed to dismiss report %v: %w", reportID, err)
+		}
+		action.Key = &key
+		return record(ctx, tx, action)
+	}))
+}
+
+// SuspendShortURL suspends the short URL, so it serves a notice instead of redirecting, and resolves its open reports.
+func SuspendShortURL(ctx context.Context, key string, requestBody []byte, moderatorID uuid.UUID) (int, string) {
+	return changeShortURL(ctx, ActionSuspend, SuspendShortURLSQL, key, requestBody, moderatorID)
+}
+
+// RestoreShortURL reactivates a suspended short URL.
+func RestoreShortURL(ctx context.Context, key string, requestBody []byte, moderatorID uuid.UUID) (int, string) {
+	return changeShortURL(ctx, ActionRestore, RestoreShortURLSQL, key, requestBody, moderatorID)
+}
+
+func changeShortURL(ctx context.Context, name string, sql string, key string, requestBody []byte, moderatorID uuid.UUID) (int, string) {
+	action, err := newAction(name, requestBody, moderatorID)
+	if err != nil {
+		return service.Marshal(http.StatusBadRequest, action, err)
+	}
+	action.Key = &key
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Action, error) {
+		if err := tx.QueryRow(ctx, sql, key).Scan(&action.CustomerID); err != nil {
+			switch {
+			case !errors.Is(err, pgx.ErrNoRows):
+				return http.StatusInternalServerError, action, fmt.Errorf("failed to %s short URL %q: %w", name, key, err)
+			case name == ActionRestore:
+				return http.StatusConflict, action, ErrNotSuspended
+			default:
+				return http.StatusNotFound, action, ErrShortURLUnknown
+			}
+		}
+		action.Affected = []string{key}
+		if name == ActionSuspend {
+			if _, err := tx.Exec(ctx, ResolveReportsSQL, action.Affected); err != nil {
+				return http.StatusInternalServerError, action, fmt.Errorf("failed to resolve reports of %q: %w", key, err)
+			}
+		}
+		return record(ctx, tx, action)
+	}))
+}
+
+// BanCustomer bans the customer from creating and changing short URLs, suspends all the customer's active ones and resolves their reports.
+func BanCustomer(ctx context.Context, id string, requestBody []byte, moderatorID uuid.UUID) (int, string) {
+	customerID, err := uuid.FromString(id)
+	if err != nil {
+		return service.Marshal(http.StatusNotFound, &Action{}, fmt.Errorf("failed to parse customer ID: %v: %w", id, err))
+	}
+	action, err := newAction(ActionBan, requestBody, moderatorID)
+	if err != nil {
+		return service.Marshal(http.StatusBadRequest, action, err)
+	}
+	action.CustomerID = &customerID
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Action, error) {
+		tag, err := tx.Exec(ctx, BanCustomerSQL, customerID)
+		switch {
+		case err != nil:
+			return http.StatusInternalServerError, action, fmt.Errorf("failed to ban customer %v: %w", customerID, err)
+		case tag.RowsAffected() == 0:
+			return http.StatusNotFound, action, fmt.Errorf("customer %v does not exist", customerID)
+		}
+
+		rows, err := tx.Query(ctx, SuspendCustomerSQL, customerID)
+		if err != nil {
+			return http.StatusInternalServerError, action, fmt.Errorf("failed to suspend short URLs of customer %v: %w", customerID, err)
+		}
+		if action.Affected, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return http.StatusInternalServerError, action, fmt.Errorf("failed to read suspended short URLs: %w", err)
+		}
+		if _, err := tx.Exec(ctx, ResolveReportsSQL, action.Affected); err != nil {
+			return http.StatusInternalServerError, action, fmt.Errorf("failed to resolve reports of customer %v: %w", customerID, err)
+		}
+		return record(ctx, tx, action)
+	}))
+}
+
+func newAction(name string, requestBody []byte, moderatorID uuid.UUID) (*Action, error) {
+	action := &Action{ID: service.UUID(), Action: name, ModeratorID: moderatorID, CreatedAt: time.Now()}
+	if len(strings.TrimSpace(string(requestBody))) == 0 {
+		return action, nil
+	}
+	var r request
+	if err := json.Unmarshal(requestBody, &r); err != nil {
+		return action, fmt.Errorf("failed to unmarshal %T from JSON: %w", r, err)
+	}
+	action.Note = strings.TrimSpace(r.Note)
+	return action, nil
+}
+
+// record adds the action to the audit in the transaction of the action.
+func record(ctx context.Context, tx pgx.Tx, action *Action) (int, *Action, error) {
+	if _, err := tx.Exec(ctx, CreateActionSQL, action.FieldsVals()...); err != nil {
+		return http.StatusInternalServerError, action, fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	return http.StatusOK, action, nil
+}
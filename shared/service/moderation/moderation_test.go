@@ -0,0 +1,47 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportValidate(t *testing.T) {
+	report := &Report{Reason: " Phishing ", Contact: " abuse@example.com "}
+	assert.NoError(t, report.Validate())
+	assert.Equal(t, ReasonPhishing, report.Reason)
+	assert.Equal(t, "abuse@example.com", report.Contact)
+
+	assert.ErrorIs(t, (&Report{}).Validate(), ErrUnknownReason)
+	assert.ErrorIs(t, (&Report{Reason: "boring"}).Validate(), ErrUnknownReason)
+	assert.ErrorIs(t, (&Report{Reason: ReasonSpam, Details: strings.Repeat("x", maxDetails+1)}).Validate(), ErrDetailsTooLong)
+	assert.ErrorIs(t, (&Report{Reason: ReasonOther, Contact: strings.Repeat("x", maxContact+1)}).Validate(), ErrContactTooLong)
+}
+
+func TestNewAction(t *testing.T) {
+	moderatorID := uuid.Must(uuid.NewV4())
+
+	action, err := newAction(ActionSuspend, nil, moderatorID)
+	assert.NoError(t, err)
+	assert.Equal(t, ActionSuspend, action.Action)
+	assert.Equal(t, moderatorID, action.ModeratorID)
+	assert.Empty(t, action.Note)
+
+	action, err = newAction(ActionBan, []byte(`{"note": " spam campaign "}`), moderatorID)
+	assert.NoError(t, err)
+	assert.Equal(t, "spam campaign", action.Note)
+
+	_, err = newAction(ActionBan, []byte(`{"note":`), moderatorID)
+	assert.Error(t, err)
+}
+
+func TestReportStatusFilter(t *testing.T) {
+	status, err := reportStatusFilter(ReportDismissed)
+	assert.NoError(t, err)
+	assert.Equal(t, ReportDismissed, status)
+
+	_, err = reportStatusFilter("closed")
+	assert.Error(t, err)
+}
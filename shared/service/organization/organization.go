@@ -1,23 +1,34 @@
 package organization
 
 import (
+	"fmt"
+
 	"github.com/gofrs/uuid"
 	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
 	"github.com/lnk.by/shared/utils"
 )
 
+const maxKeyPrefixLength = 16
+
 type Organization struct {
-	ID     uuid.UUID    `json:"id"`
-	Name   string       `json:"name"`
-	Status utils.Status `json:"status"`
+	ID          uuid.UUID    `json:"id"`
+	Name        string       `json:"name"`
+	Status      utils.Status `json:"status"`
+	KeyPrefix   string       `json:"keyPrefix,omitempty"`   // required at the beginning of the custom keys of the customers of the organization
+	KeyStrategy string       `json:"keyStrategy,omitempty"` // of the generated keys of the customers of the organization, empty - the default one
+	KeyAlphabet string       `json:"keyAlphabet,omitempty"` // of the generated keys of the customers of the organization, empty - the default one
+	// domains (with their subdomains) the targets of the short URLs of the customers must (not) belong to, empty - any
+	TargetAllowlist []string `json:"targetAllowlist,omitempty"`
+	TargetDenylist  []string `json:"targetDenylist,omitempty"`
 }
 
 func (o *Organization) FieldsPtrs() []any {
-	return []any{&o.ID, &o.Name, &o.Status}
+	return []any{&o.ID, &o.Name, &o.Status, &o.KeyPrefix, &o.KeyStrategy, &o.KeyAlphabet, &o.TargetAllowlist, &o.TargetDenylist}
 }
 
 func (o *Organization) FieldsVals() []any {
-	return []any{o.ID, o.Name, o.Status}
+	return []any{o.ID, o.Name, o.Status, o.KeyPrefix, o.KeyStrategy, o.KeyAlphabet, o.TargetAllowlist, o.TargetDenylist}
 }
 
 func (c *Organization) ParseID(idString string) (uuid.UUID, error) {
@@ -29,28 +40,54 @@ func (c *Organization) WithID(id uuid.UUID) {
 }
 
 func (o *Organization) Validate() error {
+	var err error
+	if o.TargetAllowlist, err = domain.NormalizeList(o.TargetAllowlist); err != nil {
+		return fmt.Errorf("invalid targetAllowlist: %w", err)
+	}
+	if o.TargetDenylist, err = domain.NormalizeList(o.TargetDenylist); err != nil {
+		return fmt.Errorf("invalid targetDenylist: %w", err)
+	}
+
 	switch {
 	case o.Name == "":
 		return service.ErrNameRequired
 	case o.ID != uuid.Nil:
 		return service.ErrIDManagedByServer
+	case len(o.KeyPrefix) > maxKeyPrefixLength:
+		return fmt.Errorf("keyPrefix must be at most %d characters long", maxKeyPrefixLength)
+	case o.KeyStrategy != "" && !service.IsKeyStrategy(o.KeyStrategy):
+		return fmt.Errorf("unknown keyStrategy %q, use one of %v", o.KeyStrategy, service.KeyStrategies)
+	case o.KeyAlphabet != "" && !service.IsAlphabet(o.KeyAlphabet):
+		return fmt.Errorf("unknown keyAlphabet %q, use one of %v", o.KeyAlphabet, service.AlphabetNames())
 	default:
 		return nil
 	}
 }
 
-func (o *Organization) Generate() {
+func (o *Organization) Generate() error {
 	o.ID = service.UUID()
 
 	if o.Status == "" {
 		o.Status = utils.StatusActive
 	}
+	return nil
 }
 
 var (
-	CreateSQL   service.CreateSQL[*Organization]   = "INSERT INTO organization (id, name, status) VALUES ($1, $2, $3)"
-	RetrieveSQL service.RetrieveSQL[*Organization] = "SELECT id, name, status FROM organization WHERE id = $1 AND status='active'"
-	UpdateSQL   service.UpdateSQL[*Organization]   = "UPDATE organization SET name = $2, status=$3 WHERE id = $1"
+	CreateSQL   service.CreateSQL[*Organization]   = "INSERT INTO organization (id, name, status, key_prefix, key_strategy, key_alphabet, target_allowlist, target_denylist) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	RetrieveSQL service.RetrieveSQL[*Organization] = "SELECT id, name, status, key_prefix, key_strategy, key_alphabet, target_allowlist, target_denylist FROM organization WHERE id = $1 AND status='active'"
+	UpdateSQL   service.UpdateSQL[*Organization]   = "UPDATE organization SET name = $2, status=$3, key_prefix = $4, key_strategy = $5, key_alphabet = $6, target_allowlist = $7, target_denylist = $8 WHERE id = $1"
 	DeleteSQL   service.DeleteSQL[*Organization]   = "DELETE FROM organization WHERE id = $1"
-	ListSQL     service.ListSQL[*Organization]     = "SELECT o.id, o.name, o.status FROM organization o JOIN customer c ON c.organization_id=o.id WHERE o.status='active' AND c.id=$1 OFFSET $2 LIMIT $3"
+	VersionSQL  service.VersionSQL[*Organization]  = "SELECT updated_at FROM organization WHERE id = $1"
 )
+
+var ListSQL = service.ListSQL[*Organization]{
+	Columns: "o.id, o.name, o.status, o.key_prefix, o.key_strategy, o.key_alphabet, o.target_allowlist, o.target_denylist",
+	From:    "FROM organization o JOIN customer c ON c.organization_id=o.id WHERE o.status='active' AND c.id=$1",
+	ID:      "o.id",
+	Sorts:   map[string]string{"name": "o.name", "createdAt": "o.created_at", "updatedAt": "o.updated_at"},
+	Filters: map[string]service.Filter{
+		"name": {Condition: "o.name ILIKE %[1]s", Type: service.ContainsFilter},
+	},
+	DefaultSort: "createdAt",
+}
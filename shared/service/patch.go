@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Patchable[K any] interface {
+	Retrievable[K]
+	Updatable[K]
+}
+
+var ErrPatchNotObject = errors.New("merge patch must be a JSON object")
+
+// MergePatch applies the JSON Merge Patch (RFC 7386) to the JSON document: members of the patch replace the ones of the document,
+// objects are merged recursively and null removes the member.
+func MergePatch(document []byte, patch []byte) ([]byte, error) {
+	var doc, p any
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the patched document: %w", err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal merge patch: %w", err)
+	}
+	if _, ok := p.(map[string]any); !ok {
+		return nil, ErrPatchNotObject
+	}
+	return json.Marshal(mergePatch(doc, p))
+}
+
+func mergePatch(target any, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
+
+// Merge returns a new entity with the patch applied to the current one and validated like the body of an update,
+// so the ID is left out of the current entity and the caller sets it.
+func Merge[K any, T Patchable[K]](current T, patch []byte) (T, error) {
+	var zero K
+	current.WithID(zero)
+	document, err := json.Marshal(current)
+	if err != nil {
+		return current, fmt.Errorf("failed to marshal %T: %w", current, err)
+	}
+	merged, err := MergePatch(document, patch)
+	if err != nil {
+		return current, err
+	}
+
+	t := inst[T]()
+	if err := json.Unmarshal(merged, t); err != nil {
+		return t, fmt.Errorf("failed to unmarshal patched %T: %w", t, err)
+	}
+	if err := t.Validate(); err != nil {
+		return t, fmt.Errorf("failed to validate %T: %w", t, err)
+	}
+	return t, nil
+}
+
+// RetrieveForUpdate retrieves the entity and locks its row until the end of the transaction, so it is not changed before being patched.
+func RetrieveForUpdate[K any, T Retrievable[K]](ctx context.Context, tx pgx.Tx, retrieveSQL RetrieveSQL[T], id K) (int, T, error) {
+	t := inst[T]()
+	if err := tx.QueryRow(ctx, string(retrieveSQL)+" FOR UPDATE", id).Scan(t.FieldsPtrs()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, t, fmt.Errorf("failed to retrieve the %T with id '%v': %w", t, id, err)
+		}
+		return http.StatusInternalServerError, t, fmt.Errorf("failed to retrieve the %T with id '%v': %w", t, id, err)
+	}
+	return http.StatusOK, t, nil
+}
+
+// Patch updates only the fields given in the JSON Merge Patch. The current entity (completed by the transformer) is retrieved
+// with retrieveSQL, so only the entities that can be retrieved can be patched.
+func Patch[K any, T Patchable[K]](ctx context.Context, retrieveSQL RetrieveSQL[T], updateSQL UpdateSQL[T], idString string, content []byte, transformer func(t T) (T, error), finalizer func(id K, t T) error) (int, string) {
+	status, body, _ := PatchConditional(ctx, retrieveSQL, updateSQL, "", idString, content, "", transformer, finalizer)
+	return status, body
+}
+
+// PatchConditional patches the entity unless the If-Match header does not match its ETag, and returns the new ETag.
+func PatchConditional[K any, T Patchable[K]](ctx context.Context, retrieveSQL RetrieveSQL[T], updateSQL UpdateSQL[T], versionSQL VersionSQL[T], idString string, content []byte, ifMatch string, transformer func(t T) (T, error), finalizer func(id K, t T) error) (int, string, string) {
+	id, err := inst[T]().ParseID(idString)
+	if err != nil {
+		status, body := failed(http.StatusNotFound, fmt.Errorf("failed to parse %T ID: %v: %w", inst[T](), idString, err))
+		return status, body, ""
+	}
+
+	var etag string
+	status, body := Marshal(InTransaction(ctx, func(tx pgx.Tx) (int, T, error) {
+		if status, err := CheckVersion(ctx, tx, versionSQL, id, ifMatch); err != nil {
+			return status, inst[T](), err
+		}
+		status, current, err := RetrieveForUpdate(ctx, tx, retrieveSQL, id)
+		if err != nil {
+			return status, current, err
+		}
+		if current, err = transformer(current); err != nil {
+			return http.StatusInternalServerError, current, fmt.Errorf("failed to transform row value %T: %w", current, err)
+		}
+
+		t, err := Merge(current, content)
+		if err != nil {
+			return http.StatusBadRequest, t, err
+		}
+		t.WithID(id)
+
+		if status, t, err := updateRecord(ctx, tx, updateSQL, t); err != nil {
+			return status, t, err
+		}
+
+		if err = finalizer(id, t); err != nil {
+			return http.StatusInternalServerError, t, fmt.Errorf("failed to finalize updating of %T with id %v: %w", t, id, err)
+		}
+
+		status, updated, err := version(ctx, tx, versionSQL, id, false)
+		if err != nil {
+			return status, t, err
+		}
+		etag = updated
+		return http.StatusOK, t, nil
+	}))
+	if status != http.StatusOK {
+		etag = ""
+	}
+	return status, body, etag
+}
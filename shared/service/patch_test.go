@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples of RFC 7386, appendix A
+	for _, example := range []struct{ document, patch, merged string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		merged, err := MergePatch([]byte(example.document), []byte(example.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, example.merged, string(merged), example.patch)
+	}
+
+	for _, patch := range []string{`["a"]`, `"a"`, `null`} {
+		_, err := MergePatch([]byte(`{"a":"b"}`), []byte(patch))
+		assert.ErrorIs(t, err, ErrPatchNotObject)
+	}
+	_, err := MergePatch([]byte(`{"a":"b"}`), []byte(`{"a":`))
+	assert.Error(t, err)
+}
+
+type patched struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Notes *string  `json:"notes"`
+	Tags  []string `json:"tags"`
+}
+
+func (p *patched) ParseID(s string) (int, error) { return strconv.Atoi(s) }
+func (p *patched) FieldsPtrs() []any             { return []any{&p.ID, &p.Name, &p.Notes, &p.Tags} }
+func (p *patched) FieldsVals() []any             { return []any{p.ID, p.Name, p.Notes, p.Tags} }
+func (p *patched) WithID(id int)                 { p.ID = id }
+func (p *patched) Validate() error {
+	if p.ID != 0 {
+		return ErrIDManagedByServer
+	}
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestMerge(t *testing.T) {
+	notes := "first"
+	current := &patched{ID: 7, Name: "spring", Notes: &notes, Tags: []string{"a"}}
+
+	merged, err := Merge(current, []byte(`{"name":"summer","notes":null}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &patched{Name: "summer", Tags: []string{"a"}}, merged)
+
+	// the merged entity is validated like the body of an update
+	_, err = Merge(&patched{Name: "spring"}, []byte(`{"name":""}`))
+	assert.Error(t, err)
+	_, err = Merge(&patched{Name: "spring"}, []byte(`{"id":8}`))
+	assert.ErrorIs(t, err, ErrIDManagedByServer)
+	_, err = Merge(&patched{Name: "spring"}, []byte(`[]`))
+	assert.ErrorIs(t, err, ErrPatchNotObject)
+}
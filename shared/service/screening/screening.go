@@ -0,0 +1,274 @@
+package screening
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lnk.by/shared/service/domain"
+)
+
+// Files of the blocklists: one entry per line, empty lines and lines starting with # are ignored.
+type Files struct {
+	Domains      string // domains whose subdomains are blocked too
+	HashPrefixes string // hex SHA-256 prefixes (4 to 32 bytes) of URL expressions, as in the Safe Browsing Update API
+	Rules        string // regular expressions matched against the whole target
+}
+
+type lists struct {
+	domains      []string
+	hashPrefixes map[string]bool
+	prefixLens   []int // distinct lengths of the prefixes in bytes
+	rules        []*regexp.Regexp
+}
+
+// Blocklists screen targets against the lists loaded from files; the files are reloaded when they change,
+// at most once per refresh interval.
+type Blocklists struct {
+	files    Files
+	refresh  time.Duration
+	mu       sync.RWMutex
+	lists    *lists
+	modTimes map[string]time.Time
+	checked  time.Time
+}
+
+const defaultRefresh = time.Minute
+
+// FromEnvironment loads the blocklists of SCREENING_DOMAINS_FILE, SCREENING_HASH_PREFIXES_FILE and SCREENING_RULES_FILE,
+// which are checked for changes every SCREENING_REFRESH (a duration, 1m by default).
+func FromEnvironment() (*Blocklists, error) {
+	refresh := defaultRefresh
+	if value := os.Getenv("SCREENING_REFRESH"); value != "" {
+		var err error
+		if refresh, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid SCREENING_REFRESH %q: %w", value, err)
+		}
+	}
+	return New(Files{
+		Domains:      os.Getenv("SCREENING_DOMAINS_FILE"),
+		HashPrefixes: os.Getenv("SCREENING_HASH_PREFIXES_FILE"),
+		Rules:        os.Getenv("SCREENING_RULES_FILE"),
+	}, refresh)
+}
+
+func New(files Files, refresh time.Duration) (*Blocklists, error) {
+	b := &Blocklists{files: files, refresh: refresh, lists: &lists{hashPrefixes: map[string]bool{}}}
+	if err := b.Refresh(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Refresh reloads the lists if any of the files has changed; the lists in use are kept if a file cannot be loaded.
+func (b *Blocklists) Refresh() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.checked = time.Now()
+
+	modTimes := map[string]time.Time{}
+	changed := b.modTimes == nil
+	for _, path := range []string{b.files.Domains, b.files.HashPrefixes, b.files.Rules} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to check blocklist %q: %w", path, err)
+		}
+		modTimes[path] = info.ModTime()
+		changed = changed || !info.ModTime().Equal(b.modTimes[path])
+	}
+	if !changed {
+		return nil
+	}
+
+	loaded, err := load(b.files)
+	if err != nil {
+		return err
+	}
+	b.lists, b.modTimes = loaded, modTimes
+	slog.Info("Loaded blocklists", "domains", len(loaded.domains), "hashPrefixes", len(loaded.hashPrefixes), "rules", len(loaded.rules))
+	return nil
+}
+
+func load(files Files) (*lists, error) {
+	l := &lists{hashPrefixes: map[string]bool{}}
+	err := readLines(files.Domains, func(line string) error {
+		name, err := domain.ToASCII(line)
+		if err != nil {
+			return err
+		}
+		l.domains = append(l.domains, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := map[int]bool{}
+	err = readLines(files.HashPrefixes, func(line string) error {
+		prefix, err := hex.DecodeString(line)
+		if err != nil || len(prefix) < 4 || len(prefix) > sha256.Size {
+			return fmt.Errorf("hash prefix %q must be 4 to 32 hex encoded bytes", line)
+		}
+		l.hashPrefixes[string(prefix)] = true
+		if !lengths[len(prefix)] {
+			lengths[len(prefix)] = true
+			l.prefixLens = append(l.prefixLens, len(prefix))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readLines(files.Rules, func(line string) error {
+		rule, err := regexp.Compile(line)
+		if err != nil {
+			return fmt.Errorf("invalid rule %q: %w", line, err)
+		}
+		l.rules = append(l.rules, rule)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func readLines(path string, f func(line string) error) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open blocklist %q: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := f(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read blocklist %q: %w", path, err)
+	}
+	return nil
+}
+
+// Check returns why the target is blocked, or an empty string if it is not.
+func (b *Blocklists) Check(target string) string {
+	if b.refresh > 0 && time.Since(b.checkedAt()) > b.refresh {
+		if err := b.Refresh(); err != nil {
+			slog.Warn("Failed to refresh blocklists", "error", err)
+		}
+	}
+
+	b.mu.RLock()
+	l := b.lists
+	b.mu.RUnlock()
+
+	u, err := neturl.Parse(target)
+	if err != nil {
+		return ""
+	}
+	host := domain.NormalizeHost(u.Hostname())
+	for _, d := range l.domains {
+		if domain.Matches(host, d) {
+			return fmt.Sprintf("domain %q is blocklisted", d)
+		}
+	}
+	if len(l.hashPrefixes) > 0 {
+		for _, expression := range Expressions(u) {
+			hash := sha256.Sum256([]byte(expression))
+			for _, n := range l.prefixLens {
+				if l.hashPrefixes[string(hash[:n])] {
+					return fmt.Sprintf("%q matches a blocklisted hash prefix", expression)
+				}
+			}
+		}
+	}
+	for _, rule := range l.rules {
+		if rule.MatchString(target) {
+			return fmt.Sprintf("target matches rule %q", rule)
+		}
+	}
+	return ""
+}
+
+func (b *Blocklists) checkedAt() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.checked
+}
+
+const (
+	maxHostSuffixes = 5
+	maxPathPrefixes = 4
+)
+
+// Expressions returns the host suffix / path prefix combinations of the URL that are hashed by the Safe Browsing Update API,
+// without its full canonicalization: the host as is and up to 4 suffixes of its last 5 components, the path with and without
+// the query, and up to 4 prefixes of the path.
+func Expressions(u *neturl.URL) []string {
+	host := domain.NormalizeHost(u.Hostname())
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		components := strings.Split(host, ".")
+		if len(components) > maxHostSuffixes {
+			components = components[len(components)-maxHostSuffixes:]
+			hosts = append(hosts, strings.Join(components, "."))
+		}
+		for i := 1; i < len(components)-1; i++ {
+			hosts = append(hosts, strings.Join(components[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	paths := []string{}
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	for i, component := range strings.Split(strings.Trim(path, "/"), "/") {
+		if i >= maxPathPrefixes || component == "" {
+			break
+		}
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		prefix += component + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expression := h + p; !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
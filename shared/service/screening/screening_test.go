@@ -0,0 +1,84 @@
+package screening
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestCheck(t *testing.T) {
+	hash := sha256.Sum256([]byte("evil.example.org/login/"))
+	blocklists, err := New(Files{
+		Domains:      write(t, "domains.txt", "# phishing\nbad.com\n\nBücher-Phish.de\n"),
+		HashPrefixes: write(t, "prefixes.txt", hex.EncodeToString(hash[:4])+"\n"),
+		Rules:        write(t, "rules.txt", `(?i)paypal.*\.verify-account\.`+"\n"),
+	}, 0)
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, blocklists.Check("https://bad.com/"))
+	assert.NotEmpty(t, blocklists.Check("https://www.bad.com/x"))
+	assert.NotEmpty(t, blocklists.Check("https://xn--bcher-phish-thb.de/"))
+	assert.NotEmpty(t, blocklists.Check("https://a.evil.example.org/login/index.html?u=1"))
+	assert.NotEmpty(t, blocklists.Check("https://PayPal.com.verify-account.top/"))
+
+	assert.Empty(t, blocklists.Check("https://notbad.com/"))
+	assert.Empty(t, blocklists.Check("https://evil.example.org/"))
+	assert.Empty(t, blocklists.Check("https://paypal.com/"))
+}
+
+func TestRefresh(t *testing.T) {
+	path := write(t, "domains.txt", "bad.com\n")
+	blocklists, err := New(Files{Domains: path}, time.Nanosecond)
+	assert.NoError(t, err)
+	assert.Empty(t, blocklists.Check("https://worse.com/"))
+
+	assert.NoError(t, os.WriteFile(path, []byte("bad.com\nworse.com\n"), 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.NotEmpty(t, blocklists.Check("https://worse.com/"))
+
+	// a broken file keeps the lists in use
+	assert.NoError(t, os.WriteFile(path, []byte("not a domain\n"), 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	assert.Error(t, blocklists.Refresh())
+	assert.NotEmpty(t, blocklists.Check("https://worse.com/"))
+}
+
+func TestNewWithInvalidFiles(t *testing.T) {
+	_, err := New(Files{HashPrefixes: write(t, "prefixes.txt", "abc\n")}, 0)
+	assert.Error(t, err)
+
+	_, err = New(Files{Rules: write(t, "rules.txt", "(\n")}, 0)
+	assert.Error(t, err)
+
+	_, err = New(Files{Domains: filepath.Join(t.TempDir(), "missing.txt")}, 0)
+	assert.Error(t, err)
+}
+
+func TestExpressions(t *testing.T) {
+	u, err := neturl.Parse("http://a.b.c/1/2.html?param=1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"a.b.c/1/2.html?param=1", "a.b.c/1/2.html", "a.b.c/", "a.b.c/1/",
+		"b.c/1/2.html?param=1", "b.c/1/2.html", "b.c/", "b.c/1/",
+	}, Expressions(u))
+
+	u, err = neturl.Parse("http://a.b.c.d.e.f.g/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.b.c.d.e.f.g/", "c.d.e.f.g/", "d.e.f.g/", "e.f.g/", "f.g/"}, Expressions(u))
+
+	u, err = neturl.Parse("http://1.2.3.4/1/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1.2.3.4/1/", "1.2.3.4/"}, Expressions(u))
+}
@@ -0,0 +1,320 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/utils"
+)
+
+const (
+	ContentTypeCSV  = "text/csv"
+	ContentTypeJSON = "application/json"
+
+	// MaxBulkSize limits the number of short URLs that can be created by one bulk request.
+	MaxBulkSize = 1000
+)
+
+// BulkResult describes the outcome of creation of one row of a bulk request.
+type BulkResult struct {
+	Row    int    `json:"row"`
+	Key    string `json:"key"`
+	Link   string `json:"link"`
+	Target string `json:"target"`
+	Reused bool   `json:"reused,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+var bulkResultCSVHeader = []string{"row", "key", "link", "target", "error"}
+
+// bulkCSVColumns maps the accepted CSV columns to the setters of the corresponding ShortURL fields.
+var bulkCSVColumns = map[string]func(u *ShortURL, value string) error{
+	"target": func(u *ShortURL, value string) error { u.Target = value; return nil },
+	"key":    func(u *ShortURL, value string) error { u.Key = value; return nil },
+	"campaignId": func(u *ShortURL, value string) error {
+		id, err := uuid.FromString(value)
+		u.CampaignID = &id
+		return err
+	},
+	"totalLimit":  func(u *ShortURL, value string) (err error) { u.TotalLimit, err = strconv.Atoi(value); return },
+	"dailyLimit":  func(u *ShortURL, value string) (err error) { u.DailyLimit, err = strconv.Atoi(value); return },
+	"hourlyLimit": func(u *ShortURL, value string) (err error) { u.HourlyLimit, err = strconv.Atoi(value); return },
+	"validFrom": func(u *ShortURL, value string) (err error) {
+		u.ValidFrom, err = time.Parse(time.RFC3339, value)
+		return
+	},
+	"validUntil": func(u *ShortURL, value string) (err error) {
+		u.ValidUntil, err = time.Parse(time.RFC3339, value)
+		return
+	},
+	"passthrough":       func(u *ShortURL, value string) error { u.Passthrough = Passthrough(value); return nil },
+	"redirectType":      func(u *ShortURL, value string) error { u.RedirectType = RedirectType(value); return nil },
+	"interstitialDelay": func(u *ShortURL, value string) (err error) { u.InterstitialDelay, err = strconv.Atoi(value); return },
+	"utmSource":         func(u *ShortURL, value string) error { utm(u).Source = value; return nil },
+	"utmMedium":         func(u *ShortURL, value string) error { utm(u).Medium = value; return nil },
+	"utmCampaign":       func(u *ShortURL, value string) error { utm(u).Campaign = value; return nil },
+	"utmTerm":           func(u *ShortURL, value string) error { utm(u).Term = value; return nil },
+	"utmContent":        func(u *ShortURL, value string) error { utm(u).Content = value; return nil },
+	"ogTitle":           func(u *ShortURL, value string) error { openGraph(u).Title = value; return nil },
+	"ogDescription":     func(u *ShortURL, value string) error { openGraph(u).Description = value; return nil },
+	"ogImage":           func(u *ShortURL, value string) error { openGraph(u).Image = value; return nil },
+	"tags":              func(u *ShortURL, value string) error { u.Tags = strings.Split(value, ";"); return nil },
+}
+
+func openGraph(u *ShortURL) *OpenGraph {
+	if u.OpenGraph == nil {
+		u.OpenGraph = &OpenGraph{}
+	}
+	return u.OpenGraph
+}
+
+func utm(u *ShortURL) *utils.UTM {
+	if u.UTM == nil {
+		u.UTM = &utils.UTM{}
+	}
+	return u.UTM
+}
+
+var baseURL = shortURLBase()
+
+func shortURLBase() string {
+	base := os.Getenv("SHORT_URL_BASE")
+	if base == "" {
+		base = "http://localhost:8080/"
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base
+}
+
+// Link returns the full short link of the given key.
+func Link(key string) string {
+	return baseURL + key
+}
+
+// CreateShortURLs creates short URLs from a JSON array or a CSV document (possibly uploaded as multipart/form-data).
+// When atomic is true either all the rows are created in one transaction or none of them;
+// otherwise every row is created separately and its result (or error) is reported individually.
+func CreateShortURLs(ctx context.Context, contentType string, requestBody []byte, userID *uuid.UUID, atomic bool) (int, []*BulkResult, error) {
+	urls, err := ParseBulk(contentType, requestBody)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if len(urls) > MaxBulkSize {
+		return http.StatusRequestEntityTooLarge, nil, fmt.Errorf("too many rows: %d, at most %d are allowed", len(urls), MaxBulkSize)
+	}
+
+	results := make([]*BulkResult, len(urls))
+	for i, url := range urls {
+		results[i] = &BulkResult{Row: i + 1, Target: url.Target}
+		if err := url.Validate(); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		url.withDefaults(userID)
+	}
+
+	if atomic {
+		return createAtomically(ctx, urls, results)
+	}
+
+	status := http.StatusCreated
+	for i, url := range urls {
+		if results[i].Error == "" {
+			_, _, err = service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+				return createShortURL(ctx, tx, url)
+			})
+			results[i].setOutcome(url, err)
+		}
+		if results[i].Error != "" {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	return status, results, nil
+}
+
+func createAtomically(ctx context.Context, urls []*ShortURL, results []*BulkResult) (int, []*BulkResult, error) {
+	for _, result := range results {
+		if result.Error != "" {
+			return http.StatusBadRequest, results, fmt.Errorf("row %d: %s", result.Row, result.Error)
+		}
+	}
+
+	return service.InTransaction(ctx, func(tx pgx.Tx) (int, []*BulkResult, error) {
+		for i, url := range urls {
+			if status, _, err := createShortURL(ctx, tx, url); err != nil {
+				results[i].Error = err.Error()
+				return status, results, fmt.Errorf("row %d: %w", results[i].Row, err)
+			}
+			results[i].setOutcome(url, nil)
+		}
+		return http.StatusCreated, results, nil
+	})
+}
+
+func (r *BulkResult) setOutcome(url *ShortURL, err error) {
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.Key = url.Key
+	r.Link = url.link()
+	r.Reused = url.Reused
+}
+
+// ParseBulk parses the rows of a bulk request; the format is chosen by the content type, JSON is the default.
+func ParseBulk(contentType string, content []byte) ([]*ShortURL, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ContentTypeJSON
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		mediaType, content, err = readUploadedFile(params["boundary"], content)
+		if err != nil {
+			return nil, err
+		}
+		if mediaType != ContentTypeJSON {
+			return parseBulkCSV(content)
+		}
+		return parseBulkJSON(content)
+	case ContentTypeCSV, "application/csv", "text/plain":
+		return parseBulkCSV(content)
+	default:
+		return parseBulkJSON(content)
+	}
+}
+
+// readUploadedFile returns the content of the first file of the multipart form and its content type.
+func readUploadedFile(boundary string, content []byte) (string, []byte, error) {
+	reader := multipart.NewReader(bytes.NewReader(content), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", nil, errors.New("no file found in the multipart form")
+			}
+			return "", nil, fmt.Errorf("failed to read multipart form: %w", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read uploaded file %q: %w", part.FileName(), err)
+		}
+
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil || mediaType == "application/octet-stream" {
+			if strings.HasSuffix(strings.ToLower(part.FileName()), ".json") {
+				mediaType = ContentTypeJSON
+			} else {
+				mediaType = ContentTypeCSV
+			}
+		}
+		return mediaType, data, nil
+	}
+}
+
+func parseBulkJSON(content []byte) ([]*ShortURL, error) {
+	var urls []*ShortURL
+	if err := json.Unmarshal(content, &urls); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal array of %T from JSON: %w", urls, err)
+	}
+	for i, url := range urls {
+		if url == nil {
+			return nil, fmt.Errorf("JSON row %d is null, a short URL object is expected", i+1)
+		}
+	}
+	return urls, nil
+}
+
+// parseBulkCSV parses CSV with a header line; only the target column is mandatory.
+func parseBulkCSV(content []byte) ([]*ShortURL, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	setters := make([]func(u *ShortURL, value string) error, len(header))
+	hasTarget := false
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		setter, ok := bulkCSVColumns[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+		setters[i] = setter
+		hasTarget = hasTarget || column == "target"
+	}
+	if !hasTarget {
+		return nil, errors.New("CSV column \"target\" is required")
+	}
+
+	var urls []*ShortURL
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", row, err)
+		}
+
+		url := &ShortURL{}
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if err := setters[i](url, value); err != nil {
+				return nil, fmt.Errorf("invalid value of %q in CSV row %d: %w", header[i], row, err)
+			}
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// BulkResultsCSV renders the results of a bulk request as CSV.
+func BulkResultsCSV(results []*BulkResult) (string, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(bulkResultCSVHeader); err != nil {
+		return "", fmt.Errorf("failed to write CSV header: %w", err)
+	}
+	for _, r := range results {
+		if err := writer.Write([]string{strconv.Itoa(r.Row), r.Key, r.Link, r.Target, r.Error}); err != nil {
+			return "", fmt.Errorf("failed to write CSV row %d: %w", r.Row, err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,85 @@
+package shorturl
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBulkJSON(t *testing.T) {
+	urls, err := ParseBulk("application/json", []byte(`[{"target":"https://example.com"},{"target":"https://example.org","key":"org","totalLimit":5}]`))
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	assert.Equal(t, "https://example.com", urls[0].Target)
+	assert.Equal(t, "org", urls[1].Key)
+	assert.Equal(t, 5, urls[1].TotalLimit)
+}
+
+func TestParseBulkJSON_null(t *testing.T) {
+	_, err := ParseBulk("application/json", []byte(`[null]`))
+	assert.ErrorContains(t, err, "row 1")
+	_, err = ParseBulk("application/json", []byte(`[{"target":"https://example.com"},null]`))
+	assert.ErrorContains(t, err, "row 2")
+}
+
+func TestParseBulkCSV(t *testing.T) {
+	csv := `target,key,campaignId,totalLimit,validUntil
+https://example.com,,,,
+https://example.org, org ,f81d4fae-7dec-11d0-a765-00a0c91e6bf6,5,2030-01-02T03:04:05Z
+`
+	urls, err := ParseBulk("text/csv; charset=utf-8", []byte(csv))
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	assert.Equal(t, "https://example.com", urls[0].Target)
+	assert.Equal(t, "", urls[0].Key)
+	assert.Nil(t, urls[0].CampaignID)
+	assert.Equal(t, "org", urls[1].Key)
+	assert.Equal(t, "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", urls[1].CampaignID.String())
+	assert.Equal(t, 5, urls[1].TotalLimit)
+	assert.Equal(t, time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), urls[1].ValidUntil)
+}
+
+func TestParseBulkCSV_unknownColumn(t *testing.T) {
+	_, err := ParseBulk("text/csv", []byte("target,color\nhttps://example.com,red\n"))
+	assert.Error(t, err)
+}
+
+func TestParseBulkCSV_targetRequired(t *testing.T) {
+	_, err := ParseBulk("text/csv", []byte("key\nabc\n"))
+	assert.Error(t, err)
+}
+
+func TestParseBulkCSV_invalidValue(t *testing.T) {
+	_, err := ParseBulk("text/csv", []byte("target,totalLimit\nhttps://example.com,many\n"))
+	assert.Error(t, err)
+}
+
+func TestParseBulkMultipart(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	assert.NoError(t, writer.WriteField("comment", "ignored"))
+	file, err := writer.CreateFormFile("file", "links.csv")
+	assert.NoError(t, err)
+	_, err = file.Write([]byte("target\nhttps://example.com\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	urls, err := ParseBulk(writer.FormDataContentType(), body.Bytes())
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "https://example.com", urls[0].Target)
+}
+
+func TestBulkResultsCSV(t *testing.T) {
+	body, err := BulkResultsCSV([]*BulkResult{
+		{Row: 1, Key: "abc", Link: Link("abc"), Target: "https://example.com"},
+		{Row: 2, Target: "", Error: "target is required"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "row,key,link,target,error\n"+
+		"1,abc,http://localhost:8080/abc,https://example.com,\n"+
+		"2,,,,target is required\n", body)
+}
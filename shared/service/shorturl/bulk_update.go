@@ -0,0 +1,216 @@
+package shorturl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/stats"
+	"github.com/lnk.by/shared/utils"
+)
+
+// BulkFilter selects the short URLs of the current customer affected by a bulk operation.
+// All the specified criteria must match; at least one of them is required.
+type BulkFilter struct {
+	Keys         []string   `json:"keys"`
+	CampaignID   *uuid.UUID `json:"campaignId"`
+	CreatedFrom  *time.Time `json:"createdFrom"`
+	CreatedUntil *time.Time `json:"createdUntil"`
+	Tag          string     `json:"tag"` // matches the tags of the link or of its campaign, like the list filter
+}
+
+// BulkPatch contains the values to set; fields that are not specified are left as is.
+type BulkPatch struct {
+	Target      *string       `json:"target"`
+	Status      *utils.Status `json:"status"`
+	TotalLimit  *int          `json:"totalLimit"`
+	DailyLimit  *int          `json:"dailyLimit"`
+	HourlyLimit *int          `json:"hourlyLimit"`
+	ValidFrom   *time.Time    `json:"validFrom"`
+	ValidUntil  *time.Time    `json:"validUntil"`
+}
+
+type BulkUpdateRequest struct {
+	Filter BulkFilter `json:"filter"`
+	Patch  BulkPatch  `json:"patch"`
+}
+
+type BulkDeleteRequest struct {
+	Filter BulkFilter `json:"filter"`
+}
+
+// BulkOutcome reports the keys affected by a bulk update or delete.
+type BulkOutcome struct {
+	Affected int      `json:"affected"`
+	Keys     []string `json:"keys"`
+}
+
+var (
+	BulkUpdateSQL = `
+		UPDATE shorturl SET
+			target = COALESCE($2, target),
+			status = CASE WHEN status = 'suspended' THEN status ELSE COALESCE($3, status) END,
+			total_limit = COALESCE($4, total_limit),
+			daily_limit = COALESCE($5, daily_limit),
+			hourly_limit = COALESCE($6, hourly_limit),
+			valid_from = COALESCE($7, valid_from),
+			valid_until = COALESCE($8, valid_until)
+		WHERE customer_id = $1
+		AND ($9::varchar[] IS NULL OR key = ANY($9))
+		AND ($10::uuid IS NULL OR campaign_id = $10)
+		AND ($11::timestamptz IS NULL OR created_at >= $11)
+		AND ($12::timestamptz IS NULL OR created_at < $12)
+		AND ($13::text IS NULL OR tags @> ARRAY[$13::text] OR campaign_id IN (SELECT id FROM campaign WHERE tags @> ARRAY[$13::text]))
+		RETURNING key`
+	BulkDeleteSQL = `
+		DELETE FROM shorturl
+		WHERE customer_id = $1
+		AND ($2::varchar[] IS NULL OR key = ANY($2))
+		AND ($3::uuid IS NULL OR campaign_id = $3)
+		AND ($4::timestamptz IS NULL OR created_at >= $4)
+		AND ($5::timestamptz IS NULL OR created_at < $5)
+		AND ($6::text IS NULL OR tags @> ARRAY[$6::text] OR campaign_id IN (SELECT id FROM campaign WHERE tags @> ARRAY[$6::text]))
+		RETURNING key`
+)
+
+var (
+	ErrEmptyFilter = errors.New("filter must specify keys, campaignId, tag or created range")
+	ErrEmptyPatch  = errors.New("patch must specify at least one field")
+)
+
+func (f *BulkFilter) Validate() error {
+	f.Tag = utils.NormalizeTag(f.Tag)
+	if len(f.Keys) == 0 && f.CampaignID == nil && f.CreatedFrom == nil && f.CreatedUntil == nil && f.Tag == "" {
+		return ErrEmptyFilter
+	}
+	if len(f.Keys) > MaxBulkSize {
+		return fmt.Errorf("too many keys: %d, at most %d are allowed", len(f.Keys), MaxBulkSize)
+	}
+	return nil
+}
+
+func (f *BulkFilter) FieldsVals() []any {
+	var keys []string
+	if len(f.Keys) > 0 {
+		keys = f.Keys
+	}
+	var tag *string
+	if f.Tag != "" {
+		tag = &f.Tag
+	}
+	return []any{keys, f.CampaignID, f.CreatedFrom, f.CreatedUntil, tag}
+}
+
+func (p *BulkPatch) Validate() error {
+	if p.Target != nil {
+		target, err := NormalizeTarget(*p.Target)
+		if err != nil {
+			return err
+		}
+		p.Target = &target
+	}
+
+	switch {
+	case p.Target == nil && p.Status == nil && p.TotalLimit == nil && p.DailyLimit == nil && p.HourlyLimit == nil && p.ValidFrom == nil && p.ValidUntil == nil:
+		return ErrEmptyPatch
+	case p.Status != nil && !p.Status.IsValid():
+		return fmt.Errorf("invalid status %q", *p.Status)
+	case p.TotalLimit != nil && *p.TotalLimit <= 0, p.DailyLimit != nil && *p.DailyLimit <= 0, p.HourlyLimit != nil && *p.HourlyLimit <= 0:
+		return errors.New("limits must be positive")
+	case p.ValidFrom != nil && p.ValidUntil != nil && !p.ValidFrom.Before(*p.ValidUntil):
+		return errors.New("validFrom must be before validUntil")
+	}
+
+	if p.Target != nil {
+		if reason := blocklists.Check(*p.Target); reason != "" {
+			slog.Warn("Suspending short URLs with blocklisted target", "target", *p.Target, "reason", reason)
+			suspended := utils.StatusSuspended
+			p.Status = &suspended
+		}
+	}
+	return nil
+}
+
+func (p *BulkPatch) FieldsVals() []any {
+	return []any{p.Target, p.Status, p.TotalLimit, p.DailyLimit, p.HourlyLimit, p.ValidFrom, p.ValidUntil}
+}
+
+// UpdateShortURLs applies the patch to all the short URLs of the customer matching the filter in one transaction.
+func UpdateShortURLs(ctx context.Context, requestBody []byte, userID *uuid.UUID) (int, string) {
+	var request BulkUpdateRequest
+	if err := json.Unmarshal(requestBody, &request); err != nil {
+		return service.Marshal(http.StatusBadRequest, &BulkOutcome{}, fmt.Errorf("failed to unmarshal %T from JSON: %w", request, err))
+	}
+	if err := request.Filter.Validate(); err != nil {
+		return service.Marshal(http.StatusBadRequest, &BulkOutcome{}, err)
+	}
+	if err := request.Patch.Validate(); err != nil {
+		return service.Marshal(http.StatusBadRequest, &BulkOutcome{}, err)
+	}
+
+	args := append(append([]any{userID}, request.Patch.FieldsVals()...), request.Filter.FieldsVals()...)
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *BulkOutcome, error) {
+		if status, err := checkNotBanned(ctx, tx, userID); err != nil {
+			return status, nil, err
+		}
+		if request.Patch.Target != nil {
+			if status, err := checkTarget(ctx, tx, userID, *request.Patch.Target); err != nil {
+				return status, nil, err
+			}
+		}
+		keys, err := queryKeys(ctx, tx, BulkUpdateSQL, args...)
+		if err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to update short URLs: %w", err)
+		}
+		return http.StatusOK, &BulkOutcome{Affected: len(keys), Keys: keys}, nil
+	}))
+}
+
+// DeleteShortURLs deletes all the short URLs of the customer matching the filter together with their counters in one transaction.
+func DeleteShortURLs(ctx context.Context, requestBody []byte, userID *uuid.UUID) (int, string) {
+	var request BulkDeleteRequest
+	if err := json.Unmarshal(requestBody, &request); err != nil {
+		return service.Marshal(http.StatusBadRequest, &BulkOutcome{}, fmt.Errorf("failed to unmarshal %T from JSON: %w", request, err))
+	}
+	if err := request.Filter.Validate(); err != nil {
+		return service.Marshal(http.StatusBadRequest, &BulkOutcome{}, err)
+	}
+
+	args := append([]any{userID}, request.Filter.FieldsVals()...)
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *BulkOutcome, error) {
+		keys, err := queryKeys(ctx, tx, BulkDeleteSQL, args...)
+		if err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to delete short URLs: %w", err)
+		}
+		if len(keys) > 0 {
+			if status, err := stats.DeleteCounters(ctx, tx, keys...); err != nil {
+				return status, nil, err
+			}
+		}
+		return http.StatusOK, &BulkOutcome{Affected: len(keys), Keys: keys}, nil
+	}))
+}
+
+func queryKeys(ctx context.Context, tx pgx.Tx, sql string, args ...any) ([]string, error) {
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	return keys, nil
+}
@@ -0,0 +1,40 @@
+package shorturl
+
+import (
+	"testing"
+
+	"github.com/lnk.by/shared/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkFilterValidate(t *testing.T) {
+	assert.Equal(t, ErrEmptyFilter, (&BulkFilter{}).Validate())
+	assert.Equal(t, ErrEmptyFilter, (&BulkFilter{Keys: []string{}}).Validate())
+	assert.NoError(t, (&BulkFilter{Keys: []string{"abc"}}).Validate())
+	assert.Equal(t, ErrEmptyFilter, (&BulkFilter{Tag: "  "}).Validate())
+
+	filter := &BulkFilter{Tag: " Summer "}
+	assert.NoError(t, filter.Validate())
+	assert.Equal(t, "summer", *filter.FieldsVals()[4].(*string))
+}
+
+func TestBulkFilterFieldsVals_noKeys(t *testing.T) {
+	vals := (&BulkFilter{Keys: []string{}}).FieldsVals()
+	assert.Nil(t, vals[0])
+	assert.Nil(t, vals[4])
+}
+
+func TestBulkPatchValidate(t *testing.T) {
+	empty := ""
+	zero := 0
+	ten := 10
+	invalid := utils.Status("paused")
+	cancelled := utils.StatusCancelled
+
+	assert.Equal(t, ErrEmptyPatch, (&BulkPatch{}).Validate())
+	assert.Error(t, (&BulkPatch{Target: &empty}).Validate())
+	assert.Error(t, (&BulkPatch{Status: &invalid}).Validate())
+	assert.Error(t, (&BulkPatch{DailyLimit: &zero}).Validate())
+	assert.NoError(t, (&BulkPatch{Status: &cancelled}).Validate())
+	assert.NoError(t, (&BulkPatch{TotalLimit: &ten}).Validate())
+}
@@ -0,0 +1,395 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/stats"
+)
+
+// MaxImportSize limits the number of links that can be imported at once.
+const MaxImportSize = 100000
+
+const (
+	ImportStatusImported = "imported"
+	ImportStatusConflict = "conflict"
+	ImportStatusInvalid  = "invalid"
+	ImportStatusFailed   = "failed"
+)
+
+// ImportRecord is one link exported by another shortener.
+type ImportRecord struct {
+	Key     string    `json:"key"`
+	Target  string    `json:"target"`
+	Created time.Time `json:"created"`
+	Clicks  int       `json:"clicks"`
+	invalid error     // a malformed value makes only its own record invalid
+}
+
+type ImportResult struct {
+	Row    int    `json:"row"`
+	Key    string `json:"key"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Imported  int             `json:"imported"`
+	Conflicts int             `json:"conflicts"`
+	Invalid   int             `json:"invalid"`
+	Failed    int             `json:"failed"`
+	Results   []*ImportResult `json:"results"`
+}
+
+// importColumns maps column (or JSON property) names used by popular shorteners to the fields of ImportRecord.
+var importColumns = map[string]string{
+	"key":          "key",
+	"keyword":      "key",
+	"slug":         "key",
+	"slashtag":     "key",
+	"short_code":   "key",
+	"shortcode":    "key",
+	"custom_key":   "key",
+	"link":         "link",
+	"short_url":    "link",
+	"shorturl":     "link",
+	"target":       "target",
+	"url":          "target",
+	"long_url":     "target",
+	"longurl":      "target",
+	"original_url": "target",
+	"destination":  "target",
+	"created":      "created",
+	"created_at":   "created",
+	"createdat":    "created",
+	"timestamp":    "created",
+	"date":         "created",
+	"clicks":       "clicks",
+	"visits":       "clicks",
+	"hits":         "clicks",
+	"total_clicks": "clicks",
+}
+
+var importTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+var UpdateCreatedAtSQL = "UPDATE shorturl SET created_at = $2 WHERE key = $1"
+
+// ImportShortURLs imports links exported by another shortener. Every link is imported in its own transaction,
+// so a conflict with an existing key (or any other problem) is reported for that link only.
+func ImportShortURLs(ctx context.Context, contentType string, content []byte, customerID *uuid.UUID, campaignID *uuid.UUID) (int, *ImportReport, error) {
+	records, err := ParseImport(contentType, content)
+	if err != nil {
+		return http.StatusBadRequest, nil, err
+	}
+	if len(records) > MaxImportSize {
+		return http.StatusRequestEntityTooLarge, nil, fmt.Errorf("too many links: %d, at most %d are allowed", len(records), MaxImportSize)
+	}
+
+	report := &ImportReport{Results: make([]*ImportResult, len(records))}
+	for i, record := range records {
+		result := importRecord(ctx, record, customerID, campaignID)
+		result.Row = i + 1
+		report.add(result)
+	}
+
+	return http.StatusOK, report, nil
+}
+
+func importRecord(ctx context.Context, record *ImportRecord, customerID *uuid.UUID, campaignID *uuid.UUID) *ImportResult {
+	result := &ImportResult{Key: record.Key, Target: record.Target}
+	if record.invalid != nil {
+		result.Status, result.Error = ImportStatusInvalid, record.invalid.Error()
+		return result
+	}
+
+	url := &ShortURL{Key: record.Key, Target: record.Target, CustomerID: customerID, CampaignID: campaignID}
+	if err := url.Validate(); err != nil {
+		result.Status, result.Error = ImportStatusInvalid, err.Error()
+		return result
+	}
+	if record.Clicks < 0 {
+		result.Status, result.Error = ImportStatusInvalid, "clicks must not be negative"
+		return result
+	}
+	url.withDefaults(customerID)
+
+	status, _, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+		status, _, err := createShortURL(ctx, tx, url)
+		if err != nil {
+			return status, url, err
+		}
+		if !record.Created.IsZero() {
+			if _, err := tx.Exec(ctx, UpdateCreatedAtSQL, url.Key, record.Created); err != nil {
+				return http.StatusInternalServerError, url, fmt.Errorf("failed to set creation time of %q: %w", url.Key, err)
+			}
+		}
+		if record.Clicks > 0 {
+			if status, err := stats.SeedTotal(ctx, tx, url.Key, record.Clicks); err != nil {
+				return status, url, err
+			}
+		}
+		return status, url, nil
+	})
+
+	result.Key = url.Key
+	switch {
+	case err == nil:
+		result.Status = ImportStatusImported
+	case status == http.StatusConflict:
+		result.Status, result.Error = ImportStatusConflict, fmt.Sprintf("key %q already exists", url.Key)
+	default:
+		result.Status, result.Error = ImportStatusFailed, err.Error()
+	}
+	return result
+}
+
+// RowSQL reads a row of the shorturl table exported as JSON by archive.Export; the columns added after the first exports get their defaults.
+var RowSQL = `
+	SELECT key, is_custom, target, campaign_id, customer_id, COALESCE(status, 'active'), total_limit, daily_limit, hourly_limit, valid_from, valid_until, utm,
+		COALESCE(passthrough, 'none'), COALESCE(interstitial_delay, 0), open_graph, COALESCE(redirect_type, '302'), domain_id, COALESCE(slug, key),
+		COALESCE(tags, '{}'), COALESCE(case_insensitive, FALSE), created_at
+	FROM json_populate_record(NULL::shorturl, $1::json)`
+
+// RestoreSQL inserts the restored short URL unless its key (or its slug on the domain) is taken.
+var RestoreSQL = string(CreateSQL) + " ON CONFLICT DO NOTHING"
+
+// RestoreShortURL checks the exported row of the shorturl table like a created link: the target is normalized, screened and checked
+// against the policy of the organization, custom keys against the key policy, the customer must not be banned and the domain must be
+// a verified one of the organization. Links whose key is taken are skipped: restored is false.
+func RestoreShortURL(ctx context.Context, tx pgx.Tx, row string) (status int, restored bool, err error) {
+	url := &ShortURL{}
+	var createdAt time.Time
+	if err := tx.QueryRow(ctx, RowSQL, row).Scan(append(url.FieldsPtrs(), &createdAt)...); err != nil {
+		return http.StatusBadRequest, false, fmt.Errorf("invalid short URL %s: %w", row, err)
+	}
+
+	// generated keys (and the slugs that mirror them on the default domain) are kept as they are: the key policy only applies to typed ones
+	key, slug, custom := url.Key, url.Slug, url.custom
+	if !custom {
+		url.Key = ""
+	}
+	if url.DomainID == nil {
+		url.Slug = ""
+	}
+	if err := url.Validate(); err != nil {
+		return http.StatusBadRequest, false, fmt.Errorf("invalid short URL %q: %w", key, err)
+	}
+	if !custom {
+		url.Key, url.custom = key, false
+	}
+	if url.DomainID == nil {
+		url.Slug = slug
+	}
+
+	if custom {
+		status, settings, err := retrieveKeySettings(ctx, tx, url.CustomerID)
+		if err != nil {
+			return status, false, err
+		}
+		if err := settings.checkPrefix(url.Key); err != nil {
+			return http.StatusBadRequest, false, fmt.Errorf("invalid short URL %q: %w", key, err)
+		}
+	}
+	if status, err := checkNotBanned(ctx, tx, url.CustomerID); err != nil {
+		return status, false, err
+	}
+	if status, err := checkDomain(ctx, tx, url); err != nil {
+		return status, false, err
+	}
+	if status, err := checkTarget(ctx, tx, url.CustomerID, url.Target); err != nil {
+		return status, false, err
+	}
+
+	commandTag, err := tx.Exec(ctx, RestoreSQL, url.FieldsVals()...)
+	if err != nil {
+		return http.StatusInternalServerError, false, fmt.Errorf("failed to restore short URL %q: %w", key, err)
+	}
+	if commandTag.RowsAffected() == 0 {
+		return http.StatusOK, false, nil
+	}
+	if _, err := tx.Exec(ctx, UpdateCreatedAtSQL, url.Key, createdAt); err != nil {
+		return http.StatusInternalServerError, false, fmt.Errorf("failed to set creation time of %q: %w", key, err)
+	}
+	return http.StatusCreated, true, nil
+}
+
+func (r *ImportReport) add(result *ImportResult) {
+	r.Results[result.Row-1] = result
+	switch result.Status {
+	case ImportStatusImported:
+		r.Imported++
+	case ImportStatusConflict:
+		r.Conflicts++
+	case ImportStatusInvalid:
+		r.Invalid++
+	default:
+		r.Failed++
+	}
+}
+
+// ParseImport parses CSV (with a header line) or JSON (an array of objects, or an object with a "links" array) export.
+func ParseImport(contentType string, content []byte) ([]*ImportRecord, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+	if mediaType == "multipart/form-data" {
+		if mediaType, content, err = readUploadedFile(params["boundary"], content); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case mediaType == ContentTypeJSON:
+		return parseImportJSON(content)
+	case mediaType == "":
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+			return parseImportJSON(content)
+		}
+		return parseImportCSV(content)
+	default:
+		return parseImportCSV(content)
+	}
+}
+
+func parseImportCSV(content []byte) ([]*ImportRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	var records []*ImportRecord
+	for row := 1; ; row++ {
+		values, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", row, err)
+		}
+
+		fields := make(map[string]any, len(header))
+		for i, column := range header {
+			if i < len(values) {
+				fields[column] = values[i]
+			}
+		}
+		records = append(records, toImportRecord(fields))
+	}
+
+	return records, nil
+}
+
+func parseImportJSON(content []byte) ([]*ImportRecord, error) {
+	var rows []map[string]any
+	if err := json.Unmarshal(content, &rows); err != nil {
+		var wrapper struct {
+			Links []map[string]any `json:"links"`
+		}
+		if wrapperErr := json.Unmarshal(content, &wrapper); wrapperErr != nil {
+			return nil, fmt.Errorf("failed to unmarshal links from JSON: %w", err)
+		}
+		rows = wrapper.Links
+	}
+
+	records := make([]*ImportRecord, len(rows))
+	for i, fields := range rows {
+		records[i] = toImportRecord(fields)
+	}
+	return records, nil
+}
+
+func toImportRecord(fields map[string]any) *ImportRecord {
+	record := &ImportRecord{}
+	var link string
+	for name, value := range fields {
+		field, ok := importColumns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok || value == nil {
+			continue // unknown columns (title, tags, etc) are ignored
+		}
+
+		var err error
+		switch field {
+		case "key":
+			record.Key = strings.Trim(strings.TrimSpace(fmt.Sprint(value)), "/")
+		case "link":
+			link = strings.TrimSpace(fmt.Sprint(value))
+		case "target":
+			record.Target = strings.TrimSpace(fmt.Sprint(value))
+		case "created":
+			record.Created, err = parseImportTime(value)
+		case "clicks":
+			record.Clicks, err = parseImportInt(value)
+		}
+		if err != nil {
+			record.invalid = fmt.Errorf("invalid value of %q: %w", name, err)
+		}
+	}
+
+	// exports that contain only the full short link (e.g. https://bit.ly/abc) keep the key as its last path segment
+	if record.Key == "" && link != "" {
+		if u, err := neturl.Parse(link); err == nil && strings.Trim(u.Path, "/") != "" {
+			record.Key = path.Base(u.Path)
+		}
+	}
+	return record
+}
+
+func parseImportTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Unix(int64(v), 0).UTC(), nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return time.Time{}, nil
+		}
+		if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC(), nil
+		}
+		for _, layout := range importTimeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unsupported time format %q", v)
+	default:
+		return time.Time{}, fmt.Errorf("unsupported time value %v", v)
+	}
+}
+
+func parseImportInt(value any) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0, nil
+		}
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("unsupported number value %v", v)
+	}
+}
@@ -0,0 +1,58 @@
+package shorturl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	csv := `keyword,url,title,timestamp,ip,clicks
+abc,https://example.com,Example,2021-03-04 05:06:07,127.0.0.1,42
+,https://example.org,,,,
+`
+	records, err := ParseImport("text/csv", []byte(csv))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "abc", records[0].Key)
+	assert.Equal(t, "https://example.com", records[0].Target)
+	assert.Equal(t, time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), records[0].Created)
+	assert.Equal(t, 42, records[0].Clicks)
+	assert.Equal(t, "", records[1].Key)
+	assert.True(t, records[1].Created.IsZero())
+}
+
+func TestParseImportCSV_invalidValueMakesOnlyItsRecordInvalid(t *testing.T) {
+	records, err := ParseImport("text/csv", []byte("key,target,clicks\na,https://a.com,many\nb,https://b.com,1\n"))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Error(t, records[0].invalid)
+	assert.NoError(t, records[1].invalid)
+}
+
+func TestParseImportJSON(t *testing.T) {
+	json := `[{"slug":"abc","destination":"https://example.com","created_at":"2021-03-04T05:06:07Z","clicks":3}]`
+	records, err := ParseImport("application/json", []byte(json))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "abc", records[0].Key)
+	assert.Equal(t, "https://example.com", records[0].Target)
+	assert.Equal(t, 3, records[0].Clicks)
+}
+
+func TestParseImportJSON_linksWrapper(t *testing.T) {
+	json := `{"links":[{"link":"https://bit.ly/3xYz","long_url":"https://example.com","created_at":1614834367}]}`
+	records, err := ParseImport("", []byte(json))
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "3xYz", records[0].Key)
+	assert.Equal(t, "https://example.com", records[0].Target)
+	assert.Equal(t, time.Unix(1614834367, 0).UTC(), records[0].Created)
+}
+
+func TestParseImport_keyWinsOverLink(t *testing.T) {
+	records, err := ParseImport("text/csv", []byte("short_url,key,url\nhttps://sho.rt/xyz,abc,https://example.com\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", records[0].Key)
+}
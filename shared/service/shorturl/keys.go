@@ -0,0 +1,338 @@
+package shorturl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+)
+
+// ReservedKeys are the first segments of the paths of the API and the static content: links are served from the root path,
+// so a custom key (or slug) equal to one of them would be shadowed or would shadow the route.
+var ReservedKeys = []string{
+	"api", "go", "ui", "health", "landingpages", "templates", "shorturls", "campaigns", "customers", "organizations", "domains",
+	"stats", "reports", "moderations", "admin", "login", "logout", "static", "assets", "favicon.ico", "robots.txt",
+}
+
+const (
+	defaultKeyCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+	maxKeyLength      = 32 // the size of the key column
+)
+
+// KeyPolicy defines which custom keys (and slugs) are accepted.
+type KeyPolicy struct {
+	Charset       string   // characters allowed in keys
+	MinLength     int      // in characters
+	MaxLength     int      // in characters, at most the size of the key column
+	CaseSensitive bool     // when false, custom keys are lower-cased
+	Reserved      []string // lower-case keys that cannot be used
+	Blocklist     []string // lower-case words that must not appear in keys
+}
+
+// DefaultKeyPolicy accepts case-sensitive keys of 3 to 32 letters, digits, dashes and underscores except the reserved ones.
+func DefaultKeyPolicy() *KeyPolicy {
+	return &KeyPolicy{
+		Charset:       defaultKeyCharset,
+		MinLength:     3,
+		MaxLength:     maxKeyLength,
+		CaseSensitive: true,
+		Reserved:      ReservedKeys,
+	}
+}
+
+// KeyPolicyFromEnvironment overrides the default policy by KEY_CHARSET, KEY_MIN_LENGTH, KEY_MAX_LENGTH, KEY_CASE_SENSITIVE,
+// KEY_RESERVED (comma-separated keys reserved in addition to ReservedKeys) and KEY_BLOCKLIST_FILE (one word per line, # starts a comment).
+func KeyPolicyFromEnvironment() (*KeyPolicy, error) {
+	policy := DefaultKeyPolicy()
+	var err error
+
+	if charset := os.Getenv("KEY_CHARSET"); charset != "" {
+		policy.Charset = charset
+	}
+	if policy.MinLength, err = envInt("KEY_MIN_LENGTH", policy.MinLength); err != nil {
+		return nil, err
+	}
+	if policy.MaxLength, err = envInt("KEY_MAX_LENGTH", policy.MaxLength); err != nil {
+		return nil, err
+	}
+	if policy.MinLength < 1 || policy.MaxLength < policy.MinLength || policy.MaxLength > maxKeyLength {
+		return nil, fmt.Errorf("key length must be between 1 and %d, got %d..%d", maxKeyLength, policy.MinLength, policy.MaxLength)
+	}
+	if value := os.Getenv("KEY_CASE_SENSITIVE"); value != "" {
+		if policy.CaseSensitive, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid KEY_CASE_SENSITIVE %q: %w", value, err)
+		}
+	}
+	for _, key := range strings.Split(os.Getenv("KEY_RESERVED"), ",") {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			policy.Reserved = append(slices.Clip(policy.Reserved), key)
+		}
+	}
+	if path := os.Getenv("KEY_BLOCKLIST_FILE"); path != "" {
+		if policy.Blocklist, err = readBlocklist(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return policy, nil
+}
+
+func envInt(name string, def int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return n, nil
+}
+
+func readBlocklist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key blocklist: %w", err)
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if word := strings.ToLower(strings.TrimSpace(line)); word != "" {
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read key blocklist %q: %w", path, err)
+	}
+	return words, nil
+}
+
+var keyPolicy *KeyPolicy
+
+func init() {
+	var err error
+	keyPolicy, err = KeyPolicyFromEnvironment()
+	if err != nil {
+		fmt.Printf("Failed to initialize key policy: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// IsReserved tells whether the key is reserved; the comparison ignores case.
+func IsReserved(key string) bool {
+	return keyPolicy.isReserved(key)
+}
+
+func (p *KeyPolicy) isReserved(key string) bool {
+	return slices.Contains(p.Reserved, strings.ToLower(key))
+}
+
+func (p *KeyPolicy) isBlocked(key string) bool {
+	key = strings.ToLower(key)
+	return slices.ContainsFunc(p.Blocklist, func(word string) bool { return strings.Contains(key, word) })
+}
+
+// Normalize returns the key as it is stored.
+func (p *KeyPolicy) Normalize(key string) string {
+	if p.CaseSensitive {
+		return key
+	}
+	return strings.ToLower(key)
+}
+
+// Validate checks the (normalized) key; kind names it in the errors.
+func (p *KeyPolicy) Validate(kind string, key string) error {
+	length := len([]rune(key))
+	switch {
+	case length < p.MinLength || length > p.MaxLength:
+		return fmt.Errorf("%s must be %d to %d characters long: %q", kind, p.MinLength, p.MaxLength, key)
+	case strings.IndexFunc(key, func(r rune) bool { return !strings.ContainsRune(p.Charset, r) }) >= 0:
+		return fmt.Errorf("%s %q contains characters other than %q", kind, key, p.Charset)
+	case p.isReserved(key):
+		return fmt.Errorf("%s %q is reserved", kind, key)
+	case p.isBlocked(key):
+		return fmt.Errorf("%s %q is not allowed", kind, key)
+	default:
+		return nil
+	}
+}
+
+// KeySettingsSQL returns the key prefix, the key strategy and the key alphabet of the organization of the customer.
+var KeySettingsSQL = "SELECT o.key_prefix, o.key_strategy, o.key_alphabet FROM customer c JOIN organization o ON o.id = c.organization_id WHERE c.id = $1"
+
+// keySettings are the settings of the organization that apply to the keys of its customers.
+type keySettings struct {
+	prefix   string // required at the beginning of custom keys
+	strategy string // of generated keys, empty - the default one
+	alphabet string // of generated keys, empty - the default one
+}
+
+func retrieveKeySettings(ctx context.Context, q service.Querier, customerID *uuid.UUID) (int, *keySettings, error) {
+	settings := &keySettings{}
+	if customerID == nil {
+		return http.StatusOK, settings, nil
+	}
+
+	err := q.QueryRow(ctx, KeySettingsSQL, customerID).Scan(&settings.prefix, &settings.strategy, &settings.alphabet)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return http.StatusInternalServerError, settings, fmt.Errorf("failed to retrieve key settings of customer %v: %w", customerID, err)
+	}
+	return http.StatusOK, settings, nil
+}
+
+func (s *keySettings) checkPrefix(key string) error {
+	if prefix := keyPolicy.Normalize(s.prefix); !strings.HasPrefix(key, prefix) {
+		return fmt.Errorf("key %q must start with %q", key, prefix)
+	}
+	return nil
+}
+
+func (s *keySettings) keyGenerator() (service.KeyGenerator, error) {
+	return keys.keyGenerator(s.strategy, s.alphabet)
+}
+
+// keyConfig is the configuration of generated keys of the deployment.
+type keyConfig struct {
+	generator    *service.Generator
+	strategy     string // the default one
+	alphabet     string // the default one
+	randomLength int
+	secret       []byte // of permutations, permuted keys are not available without it
+}
+
+var keys *keyConfig
+
+// keyConfigFromEnvironment configures generated keys: KEY_STRATEGY and KEY_ALPHABET are the defaults, KEY_RANDOM_LENGTH is the length
+// of random keys, and KEY_PERMUTATION_SECRET enables permuted keys.
+func keyConfigFromEnvironment(generator *service.Generator) (*keyConfig, error) {
+	config := &keyConfig{
+		generator: generator,
+		strategy:  os.Getenv("KEY_STRATEGY"),
+		alphabet:  os.Getenv("KEY_ALPHABET"),
+		secret:    []byte(os.Getenv("KEY_PERMUTATION_SECRET")),
+	}
+	if config.strategy == "" {
+		config.strategy = service.KeyStrategySequential
+	}
+	if config.alphabet == "" {
+		config.alphabet = service.AlphabetBase62
+	}
+
+	var err error
+	if config.randomLength, err = envInt("KEY_RANDOM_LENGTH", 8); err != nil {
+		return nil, err
+	}
+	if config.randomLength < 6 || config.randomLength > maxKeyLength {
+		return nil, fmt.Errorf("KEY_RANDOM_LENGTH must be between 6 and %d, got %d", maxKeyLength, config.randomLength)
+	}
+
+	// the defaults must work
+	if _, err := config.keyGenerator("", ""); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// keyGenerator returns the generator of the strategy and the alphabet; empty ones are replaced by the defaults.
+func (c *keyConfig) keyGenerator(strategy string, alphabetName string) (service.KeyGenerator, error) {
+	if strategy == "" {
+		strategy = c.strategy
+	}
+	if alphabetName == "" {
+		alphabetName = c.alphabet
+	}
+	alphabet, ok := service.Alphabets[alphabetName]
+	if !ok {
+		return nil, fmt.Errorf("unknown key alphabet %q, use one of %v", alphabetName, service.AlphabetNames())
+	}
+
+	switch strategy {
+	case service.KeyStrategySequential:
+		return &service.SequentialKeyGenerator{Generator: c.generator, Alphabet: alphabet}, nil
+	case service.KeyStrategyRandom:
+		return &service.RandomKeyGenerator{Length: c.randomLength, Alphabet: alphabet}, nil
+	case service.KeyStrategyPermuted:
+		if len(c.secret) == 0 {
+			return nil, fmt.Errorf("key strategy %q requires KEY_PERMUTATION_SECRET", strategy)
+		}
+		return service.NewPermutedKeyGenerator(c.generator, alphabet, c.secret)
+	default:
+		return nil, fmt.Errorf("unknown key strategy %q, use one of %v", strategy, service.KeyStrategies)
+	}
+}
+
+// lookupCandidates are the other keys a human could mean by the key: the keys of case-insensitive alphabets are found in any case
+// (and the custom keys too, when the policy is case-insensitive). The candidates only match the links marked case-insensitive,
+// so a case-sensitive key is never served for another one that differs in case.
+func lookupCandidates(key string) []string {
+	candidates := []string{key}
+	for _, name := range service.AlphabetNames() {
+		if normalized := service.Alphabets[name].Normalize(key); !slices.Contains(candidates, normalized) {
+			candidates = append(candidates, normalized)
+		}
+	}
+	if normalized := keyPolicy.Normalize(key); !slices.Contains(candidates, normalized) {
+		candidates = append(candidates, normalized)
+	}
+	return candidates[1:]
+}
+
+// Availability tells whether a custom key can be used and why not if it cannot.
+type Availability struct {
+	Key       string `json:"key"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// KeyExistsSQL checks the key on the default domain or the slug on the custom one.
+var KeyExistsSQL = "SELECT EXISTS (SELECT 1 FROM shorturl WHERE ($2::uuid IS NULL AND key = $1) OR (domain_id = $2 AND slug = $1))"
+
+// CheckAvailability checks the key against the policy and the existing links of the domain (nil - the default one).
+func CheckAvailability(ctx context.Context, key string, domainID *uuid.UUID, userID *uuid.UUID) (int, string) {
+	key = keyPolicy.Normalize(key)
+	availability := &Availability{Key: key}
+	kind := "key"
+	if domainID != nil {
+		kind = "slug"
+	}
+	if err := keyPolicy.Validate(kind, key); err != nil {
+		availability.Reason = err.Error()
+		return service.Marshal(http.StatusOK, availability, nil)
+	}
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *Availability, error) {
+		if domainID == nil {
+			status, settings, err := retrieveKeySettings(ctx, tx, userID)
+			if err != nil {
+				return status, nil, err
+			}
+			if err := settings.checkPrefix(key); err != nil {
+				availability.Reason = err.Error()
+				return http.StatusOK, availability, nil
+			}
+		}
+
+		var exists bool
+		if err := tx.QueryRow(ctx, KeyExistsSQL, key, domainID).Scan(&exists); err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to check availability of %q: %w", key, err)
+		}
+		if exists {
+			availability.Reason = fmt.Sprintf("%s %q is already taken", kind, key)
+		}
+		availability.Available = !exists
+		return http.StatusOK, availability, nil
+	}))
+}
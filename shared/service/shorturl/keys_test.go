@@ -0,0 +1,153 @@
+package shorturl
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservedKeys(t *testing.T) {
+	assert.True(t, IsReserved("ui"))
+	assert.True(t, IsReserved("API"))
+	assert.False(t, IsReserved("summer"))
+
+	assert.Error(t, (&ShortURL{Target: "https://acme.com", Key: "shorturls"}).Validate())
+	assert.Error(t, (&ShortURL{Target: "https://acme.com", Slug: "Health"}).Validate())
+	assert.NoError(t, (&ShortURL{Target: "https://acme.com", Key: "summer"}).Validate())
+}
+
+func TestKeyPolicyValidate(t *testing.T) {
+	policy := DefaultKeyPolicy()
+	policy.Blocklist = []string{"darn"}
+
+	assert.NoError(t, policy.Validate("key", "summer-2025_sale"))
+	assert.ErrorContains(t, policy.Validate("key", "ab"), "3 to 32 characters")
+	assert.ErrorContains(t, policy.Validate("key", strings.Repeat("a", 33)), "3 to 32 characters")
+	assert.ErrorContains(t, policy.Validate("key", "a/b"), "contains characters")
+	assert.ErrorContains(t, policy.Validate("key", "a b"), "contains characters")
+	assert.ErrorContains(t, policy.Validate("key", "Domains"), "reserved")
+	assert.ErrorContains(t, policy.Validate("key", "DarnIt"), "not allowed")
+
+	assert.Equal(t, "Summer", policy.Normalize("Summer"))
+	policy.CaseSensitive = false
+	assert.Equal(t, "summer", policy.Normalize("Summer"))
+}
+
+func TestKeyPolicyFromEnvironment(t *testing.T) {
+	blocklist := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(blocklist, []byte("# offensive words\nDarn\n\nheck # mild\n"), 0o600))
+
+	t.Setenv("KEY_CHARSET", "abc")
+	t.Setenv("KEY_MIN_LENGTH", "2")
+	t.Setenv("KEY_MAX_LENGTH", "8")
+	t.Setenv("KEY_CASE_SENSITIVE", "false")
+	t.Setenv("KEY_RESERVED", "Blog, shop")
+	t.Setenv("KEY_BLOCKLIST_FILE", blocklist)
+
+	policy, err := KeyPolicyFromEnvironment()
+	assert.NoError(t, err)
+	assert.Equal(t, &KeyPolicy{Charset: "abc", MinLength: 2, MaxLength: 8, Reserved: append(slices.Clone(ReservedKeys), "blog", "shop"), Blocklist: []string{"darn", "heck"}}, policy)
+	assert.Len(t, ReservedKeys, len(policy.Reserved)-2)
+
+	t.Setenv("KEY_MAX_LENGTH", "64")
+	_, err = KeyPolicyFromEnvironment()
+	assert.Error(t, err)
+}
+
+func TestKeyConfigFromEnvironment(t *testing.T) {
+	generator, err := service.NewGenerator(1)
+	assert.NoError(t, err)
+
+	config, err := keyConfigFromEnvironment(generator)
+	assert.NoError(t, err)
+	assert.Equal(t, service.KeyStrategySequential, config.strategy)
+	assert.Equal(t, service.AlphabetBase62, config.alphabet)
+
+	t.Setenv("KEY_STRATEGY", service.KeyStrategyPermuted)
+	_, err = keyConfigFromEnvironment(generator)
+	assert.ErrorContains(t, err, "KEY_PERMUTATION_SECRET")
+
+	t.Setenv("KEY_PERMUTATION_SECRET", "0123456789abcdef")
+	t.Setenv("KEY_ALPHABET", service.AlphabetUnambiguous)
+	t.Setenv("KEY_RANDOM_LENGTH", "12")
+	config, err = keyConfigFromEnvironment(generator)
+	assert.NoError(t, err)
+	assert.Equal(t, service.KeyStrategyPermuted, config.strategy)
+	random, err := config.keyGenerator(service.KeyStrategyRandom, "")
+	assert.NoError(t, err)
+	key, err := random.NextKey()
+	assert.NoError(t, err)
+	assert.Len(t, key, 12)
+
+	t.Setenv("KEY_ALPHABET", "emoji")
+	_, err = keyConfigFromEnvironment(generator)
+	assert.ErrorContains(t, err, "emoji")
+
+	t.Setenv("KEY_ALPHABET", "")
+	t.Setenv("KEY_RANDOM_LENGTH", "4")
+	_, err = keyConfigFromEnvironment(generator)
+	assert.Error(t, err)
+}
+
+func TestKeySettings(t *testing.T) {
+	keyGenerator, err := (&keySettings{}).keyGenerator()
+	assert.NoError(t, err)
+	assert.IsType(t, &service.SequentialKeyGenerator{}, keyGenerator)
+
+	keyGenerator, err = (&keySettings{strategy: service.KeyStrategyRandom, alphabet: service.AlphabetLowercase}).keyGenerator()
+	assert.NoError(t, err)
+	assert.IsType(t, &service.RandomKeyGenerator{}, keyGenerator)
+	key, err := keyGenerator.NextKey()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.ToLower(key), key)
+
+	_, err = (&keySettings{strategy: service.KeyStrategyPermuted}).keyGenerator()
+	assert.Error(t, err)
+
+	_, err = (&keySettings{alphabet: "emoji"}).keyGenerator()
+	assert.Error(t, err)
+
+	assert.NoError(t, (&keySettings{}).checkPrefix("summer"))
+	assert.NoError(t, (&keySettings{prefix: "ts-"}).checkPrefix("ts-summer"))
+	assert.Error(t, (&keySettings{prefix: "ts-"}).checkPrefix("summer"))
+}
+
+func TestGenerateWithKeyGenerator(t *testing.T) {
+	url := &ShortURL{Target: "https://acme.com", keys: &service.RandomKeyGenerator{Length: 16, Alphabet: service.Alphabets[service.AlphabetBase62]}}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.Len(t, url.Key, 16)
+	assert.Equal(t, url.Key, url.Slug)
+}
+
+func TestGenerateCaseInsensitive(t *testing.T) {
+	url := &ShortURL{Target: "https://acme.com", keys: &service.RandomKeyGenerator{Length: 8, Alphabet: service.Alphabets[service.AlphabetBase62]}}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.False(t, url.caseInsensitive)
+
+	url = &ShortURL{Target: "https://acme.com", keys: &service.RandomKeyGenerator{Length: 8, Alphabet: service.Alphabets[service.AlphabetCrockford]}}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.True(t, url.caseInsensitive)
+
+	url = &ShortURL{Key: "Summer", Target: "https://acme.com", keys: &service.RandomKeyGenerator{Length: 8, Alphabet: service.Alphabets[service.AlphabetCrockford]}}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.Equal(t, !keyPolicy.CaseSensitive, url.caseInsensitive)
+}
+
+func TestLookupCandidates(t *testing.T) {
+	assert.Equal(t, []string{"abc0", "abco"}, lookupCandidates("ABCO"))
+	assert.Contains(t, lookupCandidates("Lusab-Babad"), "lusab-babad")
+	assert.Empty(t, lookupCandidates("abc123"))
+}
@@ -0,0 +1,62 @@
+package shorturl
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+	"github.com/lnk.by/shared/utils"
+)
+
+var listStatuses = []utils.Status{utils.StatusActive, utils.StatusCancelled, utils.StatusDeleted, utils.StatusSuspended}
+
+// ListSQL lists the short URLs of the customer, the active ones unless another status is asked for.
+// The tag filter matches the tags of the link or of its campaign, the domain one the host of the target or its subdomains,
+// and q is searched in the key, the target and the Open Graph title, case-insensitively.
+var ListSQL = service.ListSQL[*ShortURL]{
+	Columns: "u.key, u.is_custom, u.target, u.campaign_id, u.customer_id, u.status, u.total_limit, u.daily_limit, u.hourly_limit, u.valid_from, u.valid_until, u.utm, u.passthrough, u.interstitial_delay, u.open_graph, u.redirect_type, u.domain_id, u.slug, u.tags, u.case_insensitive",
+	From:    "FROM shorturl u LEFT JOIN campaign c ON c.id = u.campaign_id WHERE u.customer_id = $1",
+	ID:      "u.key",
+	Sorts:   map[string]string{"key": "u.key", "target": "u.target", "createdAt": "u.created_at", "updatedAt": "u.updated_at"},
+	Filters: map[string]service.Filter{
+		"tag":          {Condition: "u.tags @> ARRAY[%[1]s::text] OR c.tags @> ARRAY[%[1]s::text]", Type: service.TagFilter},
+		"campaignId":   {Condition: "u.campaign_id = %[1]s", Type: service.UUIDFilter},
+		"status":       {Condition: "u.status = %[1]s", Type: statusFilter, Default: string(utils.StatusActive)},
+		"domain":       {Condition: "reversed_target_host(u.target) LIKE %[1]s", Type: domainFilter},
+		"createdFrom":  {Condition: "u.created_at >= %[1]s", Type: service.TimeFilter},
+		"createdUntil": {Condition: "u.created_at < %[1]s", Type: service.TimeFilter},
+		"q":            {Condition: "shorturl_search_text(u.key, u.target, u.open_graph) LIKE %[1]s", Type: searchFilter},
+	},
+	DefaultSort: "createdAt",
+}
+
+func statusFilter(value string) (any, error) {
+	if status := utils.Status(value); slices.Contains(listStatuses, status) {
+		return status, nil
+	}
+	return nil, fmt.Errorf("use one of %v", listStatuses)
+}
+
+// domainFilter matches the reversed_target_host of the domain and its subdomains, see create.sql.
+func domainFilter(value string) (any, error) {
+	domains, err := domain.NormalizeList([]string{value})
+	if err != nil {
+		return nil, err
+	}
+	return reverse("."+domains[0]) + "%", nil
+}
+
+// searchFilter matches shorturl_search_text, which is lowercase, see create.sql.
+func searchFilter(value string) (any, error) {
+	return "%" + service.EscapeLike(strings.ToLower(strings.TrimSpace(value))) + "%", nil
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
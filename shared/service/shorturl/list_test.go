@@ -0,0 +1,31 @@
+package shorturl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/lnk.by/shared/utils"
+)
+
+func TestListFilters(t *testing.T) {
+	status, err := ListSQL.Filters["status"].Type("suspended")
+	assert.NoError(t, err)
+	assert.Equal(t, utils.StatusSuspended, status)
+	_, err = ListSQL.Filters["status"].Type("banned")
+	assert.Error(t, err)
+
+	pattern, err := ListSQL.Filters["domain"].Type("Example.COM")
+	assert.NoError(t, err)
+	assert.Equal(t, "moc.elpmaxe.%", pattern)
+	_, err = ListSQL.Filters["domain"].Type("not a domain")
+	assert.Error(t, err)
+
+	pattern, err = ListSQL.Filters["q"].Type(" 50%_OFF ")
+	assert.NoError(t, err)
+	assert.Equal(t, `%50\%\_off%`, pattern)
+
+	tag, err := ListSQL.Filters["tag"].Type(" Summer ")
+	assert.NoError(t, err)
+	assert.Equal(t, "summer", tag)
+}
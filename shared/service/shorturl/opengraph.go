@@ -0,0 +1,81 @@
+package shorturl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const maxOpenGraphText = 512
+
+// socialCrawlers are the fragments of the user agents of the crawlers that build link previews in social networks and messengers.
+var socialCrawlers = []string{
+	"facebookexternalhit",
+	"facebot",
+	"twitterbot",
+	"linkedinbot",
+	"slackbot",
+	"discordbot",
+	"telegrambot",
+	"whatsapp",
+	"pinterest",
+	"redditbot",
+	"skypeuripreview",
+	"vkshare",
+	"embedly",
+	"mastodon",
+}
+
+// OpenGraph is the metadata shown by social networks instead of the one of the target page.
+type OpenGraph struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+func (o *OpenGraph) validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Title == "" {
+		return errors.New("openGraph title is required")
+	}
+	if len(o.Title) > maxOpenGraphText || len(o.Description) > maxOpenGraphText {
+		return fmt.Errorf("openGraph title and description must not be longer than %d bytes", maxOpenGraphText)
+	}
+	if o.Image != "" && !isWebURL(o.Image) {
+		return fmt.Errorf("openGraph image must be an absolute http(s) URL: %q", o.Image)
+	}
+	return nil
+}
+
+// IsSocialCrawler tells whether the user agent is a known crawler that builds link previews.
+func IsSocialCrawler(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	for _, crawler := range socialCrawlers {
+		if strings.Contains(userAgent, crawler) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenGraphPage renders the page with the OpenGraph and Twitter card metadata of the short URL;
+// it is served to social crawlers only, and a human who still gets it is sent on to the target.
+func (u *ShortURL) OpenGraphPage(target string) ([]byte, error) {
+	if !isWebURL(target) {
+		return nil, fmt.Errorf("metadata page is not supported for %q", target)
+	}
+	data := struct {
+		OpenGraph
+		Link   string
+		Target string
+	}{*u.OpenGraph, u.link(), target}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "opengraph.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render metadata of %q: %w", u.Key, err)
+	}
+	return buf.Bytes(), nil
+}
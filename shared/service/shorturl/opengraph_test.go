@@ -0,0 +1,38 @@
+package shorturl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSocialCrawler(t *testing.T) {
+	assert.True(t, IsSocialCrawler("facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)"))
+	assert.True(t, IsSocialCrawler("Mozilla/5.0 (compatible; Twitterbot/1.0)"))
+	assert.True(t, IsSocialCrawler("Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"))
+	assert.False(t, IsSocialCrawler("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"))
+	assert.False(t, IsSocialCrawler(""))
+}
+
+func TestOpenGraphValidate(t *testing.T) {
+	assert.NoError(t, (*OpenGraph)(nil).validate())
+	assert.NoError(t, (&OpenGraph{Title: "Sale", Image: "https://example.com/a.png"}).validate())
+	assert.Error(t, (&OpenGraph{Description: "no title"}).validate())
+	assert.Error(t, (&OpenGraph{Title: "Sale", Image: "data:image/png;base64,AAAA"}).validate())
+}
+
+func TestOpenGraphPage(t *testing.T) {
+	u := &ShortURL{Key: "abc", OpenGraph: &OpenGraph{Title: `Spring "sale"`, Image: "https://example.com/a.png"}}
+	page, err := u.OpenGraphPage("https://example.com/?a=1&b=2")
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), `<meta property="og:title" content="Spring &#34;sale&#34;">`)
+	assert.Contains(t, string(page), `<meta property="og:image" content="https://example.com/a.png">`)
+	assert.Contains(t, string(page), `<meta name="twitter:card" content="summary_large_image">`)
+	assert.Contains(t, string(page), `<meta property="og:url" content="`+Link("abc")+`">`)
+	assert.NotContains(t, string(page), "og:description")
+
+	u.OpenGraph.Image = ""
+	page, err = u.OpenGraphPage("https://example.com/")
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), `<meta name="twitter:card" content="summary">`)
+}
@@ -0,0 +1,242 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/utils"
+)
+
+const (
+	ContentTypeHTML = "text/html; charset=utf-8"
+
+	// PreviewParam (or a trailing PreviewSuffix of the key) shows the preview page instead of redirecting.
+	PreviewParam  = "preview"
+	PreviewSuffix = "+"
+
+	// MaxInterstitialDelay limits how long (in milliseconds, like auto.delay of the landing pages) the interstitial is shown.
+	MaxInterstitialDelay = 60000
+)
+
+const maxTitleBytes = 256 << 10
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+var templates = template.Must(template.ParseFS(templatesFS, "templates/*.html"))
+
+var (
+	titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	titleClient  = utils.PublicClient(3 * time.Second)
+)
+
+// Preview describes where the short URL leads; showing it does not count as a click.
+type Preview struct {
+	Key          string    `json:"key"`
+	Link         string    `json:"link"`
+	Target       string    `json:"target"`
+	Title        string    `json:"title,omitempty"`
+	Organization string    `json:"organization,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+var PreviewSQL = `
+	SELECT
+		u.key, u.target, NULLIF(COALESCE(c.utm, '{}'::jsonb) || COALESCE(u.utm, '{}'::jsonb), '{}'::jsonb), u.passthrough,
+		u.created_at, COALESCE(o.name, ''), t.title, u.slug, d.name
+	FROM shorturl u
+	LEFT JOIN domain d on d.id=u.domain_id
+	LEFT JOIN target_title t on t.target=u.target
+	LEFT JOIN campaign c on c.id=u.campaign_id
+	LEFT JOIN customer cu on cu.id=u.customer_id
+	LEFT JOIN organization o on o.id=cu.organization_id
+	WHERE u.key = $1 AND u.domain_id IS NOT DISTINCT FROM $2 AND u.status='active' AND now() BETWEEN u.valid_from AND u.valid_until`
+
+// The title of a target is fetched once and cached, on creation of the link or on its first preview: previews never fetch
+// targets on behalf of every visitor.
+var (
+	RetrieveTitleSQL = "SELECT title FROM target_title WHERE target = $1"
+	CreateTitleSQL   = "INSERT INTO target_title (target, title) VALUES ($1, $2) ON CONFLICT (target) DO NOTHING"
+)
+
+// IsPreview tells whether the request asks for the preview and returns the key without the preview suffix.
+func IsPreview(key string, query neturl.Values) (string, bool) {
+	if trimmed, ok := strings.CutSuffix(key, PreviewSuffix); ok {
+		return trimmed, true
+	}
+	preview, _ := strconv.ParseBool(query.Get(PreviewParam))
+	return key, preview
+}
+
+// WantsJSON tells whether the client prefers JSON to the HTML page.
+func WantsJSON(accept string) bool {
+	return strings.Contains(accept, ContentTypeJSON) && !strings.Contains(accept, "text/html")
+}
+
+// PreviewShortURL collects the preview of the short URL of the domain (nil - the default one); the target is built as the redirect would build it.
+func PreviewShortURL(ctx context.Context, key string, domainID *uuid.UUID, incoming neturl.Values) (int, *Preview, error) {
+	var title, domainName *string
+	url := &ShortURL{}
+	status, preview, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *Preview, error) {
+		preview := &Preview{}
+		err := tx.QueryRow(ctx, PreviewSQL, key, domainID).Scan(&url.Key, &url.Target, &url.UTM, &url.Passthrough, &preview.CreatedAt, &preview.Organization, &title, &url.Slug, &domainName)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return http.StatusNotFound, nil, fmt.Errorf("short URL %q is not found", key)
+		case err != nil:
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to retrieve preview of %q: %w", key, err)
+		}
+
+		query := neturl.Values{}
+		for name, values := range incoming {
+			if name != PreviewParam {
+				query[name] = values
+			}
+		}
+		preview.Key, preview.Link, preview.Target = url.Key, Link(url.Key), url.RedirectTarget(query)
+		if domainName != nil {
+			preview.Link = DomainLink(*domainName, url.Slug)
+		}
+		return http.StatusOK, preview, nil
+	})
+	if err != nil {
+		return status, preview, err
+	}
+
+	if title != nil {
+		preview.Title = *title
+	} else {
+		preview.Title = cacheTitle(ctx, url.Target)
+	}
+	return status, preview, nil
+}
+
+// cacheTitle returns the cached title of the target, fetching and caching it if there is none yet.
+func cacheTitle(ctx context.Context, target string) string {
+	status, title, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *string, error) {
+		var title string
+		if err := tx.QueryRow(ctx, RetrieveTitleSQL, target).Scan(&title); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return http.StatusNotFound, nil, nil
+			}
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to retrieve title of %q: %w", target, err)
+		}
+		return http.StatusOK, &title, nil
+	})
+	switch {
+	case err != nil:
+		slog.Warn("Failed to retrieve title", "target", target, "error", err)
+		return ""
+	case status == http.StatusOK:
+		return *title
+	}
+
+	fetched := fetchTitle(ctx, target)
+	if _, _, err := service.InTransaction(ctx, func(tx pgx.Tx) (int, *string, error) {
+		if _, err := tx.Exec(ctx, CreateTitleSQL, target, fetched); err != nil {
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to cache title of %q: %w", target, err)
+		}
+		return http.StatusOK, &fetched, nil
+	}); err != nil {
+		slog.Warn("Failed to cache title", "target", target, "error", err)
+	}
+	return fetched
+}
+
+// fetchTitle returns the title of the target page or an empty string: the preview is useful without it.
+// Only public addresses are fetched, see utils.PublicClient.
+func fetchTitle(ctx context.Context, target string) string {
+	if !isWebURL(target) {
+		return ""
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return ""
+	}
+	resp, err := titleClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return ""
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxTitleBytes))
+	if err != nil {
+		return ""
+	}
+	return parseTitle(content)
+}
+
+func parseTitle(content []byte) string {
+	match := titlePattern.FindSubmatch(content)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
+
+func isWebURL(target string) bool {
+	u, err := neturl.Parse(target)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// PreviewResponse returns the status, content type and body of the preview: the HTML page or JSON for API clients.
+func PreviewResponse(ctx context.Context, key string, domainID *uuid.UUID, incoming neturl.Values, accept string) (int, string, string) {
+	status, preview, err := PreviewShortURL(ctx, key, domainID, incoming)
+	if err != nil || WantsJSON(accept) {
+		status, body := service.Marshal(status, preview, err)
+		return status, ContentTypeJSON, body
+	}
+
+	page, err := RenderPreview(preview)
+	if err != nil {
+		status, body := service.Marshal(http.StatusInternalServerError, preview, err)
+		return status, ContentTypeJSON, body
+	}
+	return status, ContentTypeHTML, string(page)
+}
+
+func RenderPreview(preview *Preview) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "preview.html", preview); err != nil {
+		return nil, fmt.Errorf("failed to render preview of %q: %w", preview.Key, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderInterstitial renders the page that counts down the delay (in milliseconds) before leaving for the target.
+func RenderInterstitial(target string, delay int) ([]byte, error) {
+	if !isWebURL(target) {
+		return nil, fmt.Errorf("interstitial is not supported for %q", target)
+	}
+	data := struct {
+		Target  string
+		Delay   int
+		Seconds int
+	}{target, delay, (delay + 999) / 1000}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "interstitial.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render interstitial of %q: %w", target, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+package shorturl
+
+import (
+	neturl "net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPreview(t *testing.T) {
+	key, preview := IsPreview("abc+", nil)
+	assert.Equal(t, "abc", key)
+	assert.True(t, preview)
+
+	key, preview = IsPreview("abc", neturl.Values{PreviewParam: {"1"}})
+	assert.Equal(t, "abc", key)
+	assert.True(t, preview)
+
+	_, preview = IsPreview("abc", neturl.Values{"x": {"1"}})
+	assert.False(t, preview)
+}
+
+func TestWantsJSON(t *testing.T) {
+	assert.True(t, WantsJSON("application/json"))
+	assert.False(t, WantsJSON("text/html,application/xhtml+xml,application/json;q=0.9"))
+	assert.False(t, WantsJSON(""))
+}
+
+func TestParseTitle(t *testing.T) {
+	assert.Equal(t, "Tom & Jerry", parseTitle([]byte("<html><head><TITLE lang=en>\n  Tom &amp;\n Jerry </TITLE></head>")))
+	assert.Equal(t, "", parseTitle([]byte("<html><body>no title</body></html>")))
+}
+
+func TestRenderPreview(t *testing.T) {
+	page, err := RenderPreview(&Preview{Key: "abc", Link: "http://localhost:8080/go/abc", Target: "https://example.com/?a=<b>", Organization: "ACME", CreatedAt: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)})
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), "https://example.com/?a=&lt;b&gt;")
+	assert.Contains(t, string(page), "ACME")
+	assert.Contains(t, string(page), "March 4, 2025")
+}
+
+func TestRenderInterstitial(t *testing.T) {
+	page, err := RenderInterstitial("https://example.com/", 2500)
+	assert.NoError(t, err)
+	assert.Contains(t, string(page), `content="3;url=https://example.com/"`)
+	assert.Regexp(t, `setTimeout\(.*,\s*2500\s*\)`, string(page))
+
+	_, err = RenderInterstitial("javascript:alert(1)", 1000)
+	assert.Error(t, err)
+}
@@ -0,0 +1,342 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // logos may be GIF
+	_ "image/jpeg" // or JPEG
+	"image/png"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+	"github.com/lnk.by/shared/service/stats"
+	"github.com/lnk.by/shared/utils"
+)
+
+const (
+	QRFormatPNG = "png"
+	QRFormatSVG = "svg"
+
+	ContentTypePNG = "image/png"
+	ContentTypeSVG = "image/svg+xml"
+
+	// SourceParam is added to the link encoded into a QR code, so scans can be told apart from clicks in stats.
+	SourceParam = "src"
+)
+
+const (
+	defaultQRSize    = 256
+	minQRSize        = 64
+	maxQRSize        = 2048
+	defaultQRMargin  = 4
+	maxQRMargin      = 16
+	maxLogoSize      = 1 << 20
+	maxLogoDimension = 1024 // pixels of the width and of the height
+)
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// logoClient fetches the logos given by users, public ones only.
+var logoClient = utils.PublicClient(5 * time.Second)
+
+// QROptions defines how the QR code is rendered; all of them are taken from query parameters.
+type QROptions struct {
+	Format     string      `json:"format"`
+	Size       int         `json:"size"`   // width and height in pixels
+	Margin     int         `json:"margin"` // quiet zone in modules
+	Level      string      `json:"level"`  // error correction: L, M, Q or H
+	Foreground color.NRGBA `json:"-"`
+	Background color.NRGBA `json:"-"`
+	Logo       string      `json:"logo,omitempty"` // URL of an image placed in the center
+}
+
+// ParseQROptions parses format, size, margin, level, fg, bg and logo parameters and fills in the defaults.
+// A logo hides a part of the code, so it raises the error correction to H unless another level is requested.
+func ParseQROptions(params map[string]string) (*QROptions, error) {
+	opts := &QROptions{
+		Format:     strings.ToLower(params["format"]),
+		Size:       defaultQRSize,
+		Margin:     defaultQRMargin,
+		Level:      strings.ToUpper(params["level"]),
+		Foreground: color.NRGBA{A: 0xff},
+		Background: color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+		Logo:       params["logo"],
+	}
+
+	switch opts.Format {
+	case "":
+		opts.Format = QRFormatPNG
+	case QRFormatPNG, QRFormatSVG:
+	default:
+		return opts, fmt.Errorf("unsupported format %q, use %s or %s", opts.Format, QRFormatPNG, QRFormatSVG)
+	}
+
+	var err error
+	if opts.Size, err = intParam(params, "size", defaultQRSize, minQRSize, maxQRSize); err != nil {
+		return opts, err
+	}
+	if opts.Margin, err = intParam(params, "margin", defaultQRMargin, 0, maxQRMargin); err != nil {
+		return opts, err
+	}
+
+	if opts.Level == "" {
+		opts.Level = "M"
+		if opts.Logo != "" {
+			opts.Level = "H"
+		}
+	}
+	if _, ok := qrLevels[opts.Level]; !ok {
+		return opts, fmt.Errorf("unsupported error correction level %q, use L, M, Q or H", opts.Level)
+	}
+
+	if fg := params["fg"]; fg != "" {
+		if opts.Foreground, err = parseHexColor(fg); err != nil {
+			return opts, err
+		}
+	}
+	if bg := params["bg"]; bg != "" {
+		if opts.Background, err = parseHexColor(bg); err != nil {
+			return opts, err
+		}
+	}
+
+	if opts.Logo != "" {
+		u, err := neturl.Parse(opts.Logo)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return opts, fmt.Errorf("logo must be an absolute http(s) URL: %q", opts.Logo)
+		}
+	}
+
+	return opts, nil
+}
+
+func (o *QROptions) ContentType() string {
+	if o.Format == QRFormatSVG {
+		return ContentTypeSVG
+	}
+	return ContentTypePNG
+}
+
+// QRLink is the content of the QR code: the short link marked as scanned from a QR code.
+func QRLink(link string) string {
+	return link + "?" + SourceParam + "=" + stats.SourceQR
+}
+
+// GenerateQRCode renders the QR code of the existing short URL.
+func GenerateQRCode(ctx context.Context, key string, params map[string]string) (int, *QROptions, []byte, error) {
+	opts, err := ParseQROptions(params)
+	if err != nil {
+		return http.StatusBadRequest, opts, nil, err
+	}
+
+	status, url, errStr := service.RetrieveValueAndMarshalError(ctx, RetrieveSQL, key)
+	if errStr != "" {
+		return status, opts, nil, errors.New(errStr)
+	}
+
+	if url.DomainID != nil {
+		status, d, errStr := service.RetrieveValueAndMarshalError(ctx, domain.RetrieveSQL, url.DomainID.String())
+		if errStr != "" {
+			return status, opts, nil, errors.New(errStr)
+		}
+		url.domainName = d.Name
+	}
+
+	content, err := RenderQRCode(QRLink(url.link()), opts)
+	if err != nil {
+		return http.StatusInternalServerError, opts, nil, err
+	}
+	return http.StatusOK, opts, content, nil
+}
+
+// RenderQRCode encodes the content into a PNG or SVG image.
+func RenderQRCode(content string, opts *QROptions) ([]byte, error) {
+	code, err := qrcode.New(content, qrLevels[opts.Level])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %q: %w", content, err)
+	}
+	code.DisableBorder = true // the margin is drawn here, so it can be configured
+	bitmap := code.Bitmap()
+
+	if opts.Format == QRFormatSVG {
+		return renderSVG(bitmap, opts), nil
+	}
+
+	var logo image.Image
+	if opts.Logo != "" {
+		if logo, err = fetchLogo(opts.Logo); err != nil {
+			return nil, err
+		}
+	}
+	return renderPNG(bitmap, opts, logo)
+}
+
+// renderPNG draws the modules scaled to a whole number of pixels and centers them in the image of the requested size.
+func renderPNG(bitmap [][]bool, opts *QROptions, logo image.Image) ([]byte, error) {
+	modules := len(bitmap) + 2*opts.Margin
+	scale := max(opts.Size/modules, 1)
+	size := max(opts.Size, scale*modules)
+	offset := (size-scale*modules)/2 + scale*opts.Margin
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+	fg := &image.Uniform{C: opts.Foreground}
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				r := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+				draw.Draw(img, r, fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	if logo != nil {
+		logoSize := size / 5
+		padding := logoSize / 10
+		origin := (size - logoSize) / 2
+		pad := image.Rect(origin-padding, origin-padding, origin+logoSize+padding, origin+logoSize+padding)
+		draw.Draw(img, pad, &image.Uniform{C: opts.Background}, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(origin, origin, origin+logoSize, origin+logoSize), scaleImage(logo, logoSize), image.Point{}, draw.Over)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG draws the modules in a view box measured in modules; the logo is only referenced, not embedded.
+func renderSVG(bitmap [][]bool, opts *QROptions) []byte {
+	modules := len(bitmap) + 2*opts.Margin
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[2]d %[2]d" shape-rendering="crispEdges">`, opts.Size, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, modules, modules, hexColor(opts.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opts.Foreground))
+	for y, row := range bitmap {
+		for x, set := range row {
+			if set {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+	buf.WriteString(`"/>`)
+
+	if opts.Logo != "" {
+		logoSize := float64(modules) / 5
+		origin := (float64(modules) - logoSize) / 2
+		padding := logoSize / 10
+		fmt.Fprintf(&buf, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s"/>`, origin-padding, origin-padding, logoSize+2*padding, logoSize+2*padding, hexColor(opts.Background))
+		fmt.Fprintf(&buf, `<image href="%s" x="%g" y="%g" width="%g" height="%g" preserveAspectRatio="xMidYMid meet"/>`, html.EscapeString(opts.Logo), origin, origin, logoSize, logoSize)
+	}
+
+	buf.WriteString("</svg>")
+	return buf.Bytes()
+}
+
+func fetchLogo(url string) (image.Image, error) {
+	resp, err := logoClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download logo %q: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download logo %q: %s", url, resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download logo %q: %w", url, err)
+	}
+	return decodeLogo(url, content)
+}
+
+// decodeLogo checks the dimensions before decoding: the size limits the compressed bytes only, while a small image
+// may declare enough pixels to exhaust the memory.
+func decodeLogo(url string, content []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo %q: %w", url, err)
+	}
+	if config.Width > maxLogoDimension || config.Height > maxLogoDimension {
+		return nil, fmt.Errorf("logo %q is %dx%d pixels, at most %dx%d are allowed", url, config.Width, config.Height, maxLogoDimension, maxLogoDimension)
+	}
+	logo, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode logo %q: %w", url, err)
+	}
+	return logo, nil
+}
+
+// scaleImage fits the image into a square of the given size using nearest-neighbor sampling.
+func scaleImage(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	longest := max(bounds.Dx(), bounds.Dy())
+	if longest == 0 {
+		return dst
+	}
+	width, height := bounds.Dx()*size/longest, bounds.Dy()*size/longest
+	left, top := (size-width)/2, (size-height)/2
+	for y := range height {
+		for x := range width {
+			dst.Set(left+x, top+y, src.At(bounds.Min.X+x*longest/size, bounds.Min.Y+y*longest/size))
+		}
+	}
+	return dst
+}
+
+func intParam(params map[string]string, name string, def int, minValue int, maxValue int) (int, error) {
+	value, ok := params[name]
+	if !ok || value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < minValue || n > maxValue {
+		return def, fmt.Errorf("%s must be a number between %d and %d: %q", name, minValue, maxValue, value)
+	}
+	return n, nil
+}
+
+// parseHexColor parses RGB, RRGGBB or RRGGBBAA with an optional leading #.
+func parseHexColor(value string) (color.NRGBA, error) {
+	s := strings.TrimPrefix(value, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 4 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q, use RGB, RRGGBB or RRGGBBAA hex", value)
+	}
+	return color.NRGBA{R: b[0], G: b[1], B: b[2], A: b[3]}, nil
+}
+
+func hexColor(c color.NRGBA) string {
+	if c.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
+}
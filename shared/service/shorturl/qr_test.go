@@ -0,0 +1,109 @@
+package shorturl
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lnk.by/shared/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQROptions_defaults(t *testing.T) {
+	opts, err := ParseQROptions(map[string]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, QRFormatPNG, opts.Format)
+	assert.Equal(t, 256, opts.Size)
+	assert.Equal(t, 4, opts.Margin)
+	assert.Equal(t, "M", opts.Level)
+	assert.Equal(t, ContentTypePNG, opts.ContentType())
+}
+
+func TestParseQROptions_logoRaisesLevel(t *testing.T) {
+	opts, err := ParseQROptions(map[string]string{"logo": "https://example.com/logo.png"})
+	assert.NoError(t, err)
+	assert.Equal(t, "H", opts.Level)
+
+	opts, err = ParseQROptions(map[string]string{"logo": "https://example.com/logo.png", "level": "q"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Q", opts.Level)
+}
+
+func TestParseQROptions_invalid(t *testing.T) {
+	for _, params := range []map[string]string{
+		{"format": "gif"},
+		{"size": "10"},
+		{"size": "big"},
+		{"margin": "-1"},
+		{"level": "X"},
+		{"fg": "black"},
+		{"logo": "file:///etc/passwd"},
+	} {
+		_, err := ParseQROptions(params)
+		assert.Error(t, err, params)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	c, err := parseHexColor("#f00")
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0xff, A: 0xff}, c)
+
+	c, err = parseHexColor("1a237e80")
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0x1a, G: 0x23, B: 0x7e, A: 0x80}, c)
+	assert.Equal(t, "#1a237e80", hexColor(c))
+}
+
+func TestRenderQRCode_png(t *testing.T) {
+	opts, _ := ParseQROptions(map[string]string{"size": "300", "fg": "ff0000"})
+	content, err := RenderQRCode("http://localhost:8080/go/abc?src=qr", opts)
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), img.Bounds())
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b}, "margin has background color")
+}
+
+func TestRenderQRCode_svg(t *testing.T) {
+	opts, _ := ParseQROptions(map[string]string{"format": "svg", "margin": "0", "logo": "https://example.com/logo.png?a=1&b=2"})
+	content, err := RenderQRCode("http://localhost:8080/go/abc?src=qr", opts)
+	assert.NoError(t, err)
+	svg := string(content)
+	assert.Contains(t, svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`)
+	assert.Contains(t, svg, "M0 0h1v1h-1z", "finder pattern starts in the corner without margin")
+	assert.Contains(t, svg, `href="https://example.com/logo.png?a=1&amp;b=2"`)
+}
+
+func TestQRLink(t *testing.T) {
+	assert.Equal(t, Link("abc")+"?src=qr", QRLink(Link("abc")))
+}
+
+func TestFetchLogo_internal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = png.Encode(w, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	}))
+	defer server.Close()
+
+	_, err := fetchLogo(server.URL)
+	assert.ErrorIs(t, err, utils.ErrNotPublicAddress)
+}
+
+func TestDecodeLogo(t *testing.T) {
+	var small, wide bytes.Buffer
+	assert.NoError(t, png.Encode(&small, image.NewGray(image.Rect(0, 0, 16, 16))))
+	assert.NoError(t, png.Encode(&wide, image.NewGray(image.Rect(0, 0, maxLogoDimension+1, 1))))
+
+	logo, err := decodeLogo("https://acme.com/small.png", small.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, 16, logo.Bounds().Dx())
+
+	_, err = decodeLogo("https://acme.com/wide.png", wide.Bytes())
+	assert.ErrorContains(t, err, "pixels")
+}
@@ -0,0 +1,147 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/lnk.by/shared/service"
+)
+
+// RedirectType is how the visitor is sent to the target: an HTTP status or a page that redirects in the browser.
+type RedirectType string
+
+const (
+	RedirectMovedPermanently RedirectType = "301"
+	RedirectFound            RedirectType = "302" // the default: every click reaches the server and is counted
+	RedirectTemporary        RedirectType = "307"
+	RedirectPermanent        RedirectType = "308"
+	RedirectMetaRefresh      RedirectType = "meta"
+	RedirectJavaScript       RedirectType = "js"
+)
+
+const maxPermanentRedirectCache = 24 * time.Hour
+
+func (r RedirectType) IsValid() bool {
+	switch r {
+	case RedirectMovedPermanently, RedirectFound, RedirectTemporary, RedirectPermanent, RedirectMetaRefresh, RedirectJavaScript:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r RedirectType) validate() error {
+	if !r.IsValid() {
+		return fmt.Errorf("unsupported redirect type %q, use 301, 302, 307, 308, %s or %s", r, RedirectMetaRefresh, RedirectJavaScript)
+	}
+	return nil
+}
+
+func (r RedirectType) isPermanent() bool {
+	return r == RedirectMovedPermanently || r == RedirectPermanent
+}
+
+// RetrieveValid retrieves the resolved link to redirect to with its remaining limits, if it belongs to the domain of the resolution;
+// the keys generated with case-insensitive alphabets (and the custom ones of a case-insensitive policy) are found whichever case
+// they are typed in, the others only as they are.
+func RetrieveValid(ctx context.Context, resolution *Resolution, now time.Time) (int, *ShortURL, string) {
+	day := fmt.Sprintf("day%03d", now.YearDay())
+	hour := fmt.Sprintf("hour%02d", now.Hour())
+	retrieve := func(key string) (int, *ShortURL, string) {
+		status, url, errStr := service.RetrieveValueAndMarshalError(ctx, RetrieveValidSQL, key, day, hour)
+		if status == http.StatusOK && !sameDomain(url.DomainID, resolution.DomainID) {
+			status, errStr = service.Marshal(http.StatusNotFound, url, fmt.Errorf("short URL %q is not found on its domain", key))
+		}
+		return status, url, errStr
+	}
+
+	status, url, errStr := retrieve(resolution.Key)
+	for _, candidate := range lookupCandidates(resolution.Key) {
+		if status != http.StatusNotFound {
+			break
+		}
+		if s, u, e := retrieve(candidate); s != http.StatusNotFound && (s != http.StatusOK || u.caseInsensitive) {
+			status, url, errStr = s, u, e
+		}
+	}
+	if status == http.StatusOK {
+		url.domainName = resolution.DomainName
+	}
+	return status, url, errStr
+}
+
+func sameDomain(a *uuid.UUID, b *uuid.UUID) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+// IsLimited tells whether any of the limits is set; RetrieveValidSQL keeps the unset ones at math.MaxInt32.
+func (u *ShortURL) IsLimited() bool {
+	return u.TotalLimit < math.MaxInt32 || u.DailyLimit < math.MaxInt32 || u.HourlyLimit < math.MaxInt32
+}
+
+// CacheControl allows caching only of permanent redirects of unlimited links, and not beyond the end of their validity:
+// a cached redirect is neither counted nor limited.
+func (u *ShortURL) CacheControl(now time.Time) string {
+	if !u.RedirectType.isPermanent() {
+		return "no-cache"
+	}
+	maxAge := min(u.ValidUntil.Sub(now), maxPermanentRedirectCache)
+	if u.IsLimited() || maxAge < time.Second {
+		return "no-store"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+}
+
+// RedirectResponse returns the status, headers and body that send the visitor to the target,
+// so the gin server and the lambda redirect in the same way.
+func (u *ShortURL) RedirectResponse(target string) (int, map[string]string, []byte) {
+	if u.InterstitialDelay > 0 {
+		page, err := RenderInterstitial(target, u.InterstitialDelay)
+		if err == nil {
+			return http.StatusOK, map[string]string{"Content-Type": ContentTypeHTML, "Cache-Control": "no-store"}, page
+		}
+		slog.Warn("Failed to render interstitial", "key", u.Key, "error", err)
+	}
+
+	headers := map[string]string{"Cache-Control": u.CacheControl(time.Now())}
+	switch u.RedirectType {
+	case RedirectMetaRefresh, RedirectJavaScript:
+		page, err := renderRedirectPage(target, u.RedirectType == RedirectJavaScript)
+		if err == nil {
+			headers["Content-Type"] = ContentTypeHTML
+			return http.StatusOK, headers, page
+		}
+		slog.Warn("Failed to render redirect page", "key", u.Key, "error", err)
+	}
+
+	status, err := strconv.Atoi(string(u.RedirectType))
+	if err != nil {
+		status = http.StatusFound
+	}
+	headers["Location"] = target
+	return status, headers, nil
+}
+
+func renderRedirectPage(target string, script bool) ([]byte, error) {
+	if !isWebURL(target) {
+		return nil, fmt.Errorf("redirect page is not supported for %q", target)
+	}
+	data := struct {
+		Target string
+		Script bool
+	}{target, script}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "redirect.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render redirect page of %q: %w", target, err)
+	}
+	return buf.Bytes(), nil
+}
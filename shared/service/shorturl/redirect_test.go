@@ -0,0 +1,75 @@
+package shorturl
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func unlimited(redirectType RedirectType, validUntil time.Time) *ShortURL {
+	return &ShortURL{Key: "abc", TotalLimit: math.MaxInt32, DailyLimit: math.MaxInt32, HourlyLimit: math.MaxInt32, ValidUntil: validUntil, RedirectType: redirectType}
+}
+
+func TestCacheControl(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, "no-cache", unlimited(RedirectFound, defaultValidUntil).CacheControl(now))
+	assert.Equal(t, "no-cache", unlimited(RedirectTemporary, defaultValidUntil).CacheControl(now))
+	assert.Equal(t, "public, max-age=86400", unlimited(RedirectMovedPermanently, defaultValidUntil).CacheControl(now))
+	assert.Equal(t, "public, max-age=600", unlimited(RedirectPermanent, now.Add(10*time.Minute)).CacheControl(now))
+
+	limited := unlimited(RedirectPermanent, defaultValidUntil)
+	limited.DailyLimit = 100
+	assert.Equal(t, "no-store", limited.CacheControl(now))
+}
+
+func TestRedirectResponse(t *testing.T) {
+	status, headers, body := unlimited(RedirectTemporary, defaultValidUntil).RedirectResponse("https://example.com/")
+	assert.Equal(t, http.StatusTemporaryRedirect, status)
+	assert.Equal(t, "https://example.com/", headers["Location"])
+	assert.Empty(t, body)
+
+	status, headers, body = unlimited(RedirectMetaRefresh, defaultValidUntil).RedirectResponse("https://example.com/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, ContentTypeHTML, headers["Content-Type"])
+	assert.Contains(t, string(body), `content="0;url=https://example.com/"`)
+
+	status, _, body = unlimited(RedirectJavaScript, defaultValidUntil).RedirectResponse("https://example.com/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, string(body), "window.location.replace")
+
+	// pages can not be rendered for other schemes, so they fall back to the plain redirect
+	status, headers, _ = unlimited(RedirectJavaScript, defaultValidUntil).RedirectResponse("mailto:info@example.com")
+	assert.Equal(t, http.StatusFound, status)
+	assert.Equal(t, "mailto:info@example.com", headers["Location"])
+
+	interstitial := unlimited(RedirectMovedPermanently, defaultValidUntil)
+	interstitial.InterstitialDelay = 1000
+	status, headers, _ = interstitial.RedirectResponse("https://example.com/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "no-store", headers["Cache-Control"])
+}
+
+func TestValidate_redirectType(t *testing.T) {
+	u := &ShortURL{Target: "https://example.com"}
+	assert.NoError(t, u.Validate())
+	assert.Equal(t, RedirectFound, u.RedirectType)
+
+	u = &ShortURL{Target: "https://example.com", RedirectType: "303"}
+	assert.Error(t, u.Validate())
+}
+
+func TestSameDomain(t *testing.T) {
+	acme, other := uuid.Must(uuid.NewV4()), uuid.Must(uuid.NewV4())
+	acmeAgain := acme
+
+	assert.True(t, sameDomain(nil, nil))
+	assert.True(t, sameDomain(&acme, &acmeAgain))
+	assert.False(t, sameDomain(&acme, nil))
+	assert.False(t, sameDomain(nil, &acme))
+	assert.False(t, sameDomain(&acme, &other))
+}
@@ -0,0 +1,80 @@
+package shorturl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+// Resolution is the key of the link requested by host and slug; an unknown slug of a custom domain has no key, but may have a fallback.
+// Keys are only served on the domain of their links: DomainID is the custom domain of the host, nil for the default one.
+type Resolution struct {
+	Key        string
+	Fallback   string
+	DomainID   *uuid.UUID
+	DomainName string
+}
+
+var ResolveSQL = `
+	SELECT d.id, d.name, d.fallback_url, COALESCE(u.key, '')
+	FROM domain d
+	LEFT JOIN shorturl u ON u.domain_id = d.id AND u.slug = ANY($2) AND (u.slug = $2[1] OR u.case_insensitive)
+	WHERE d.name = $1 AND d.status = 'active' AND d.verified_at IS NOT NULL
+	ORDER BY array_position($2, u.slug)
+	LIMIT 1`
+
+var defaultHost = baseHost()
+
+func baseHost() string {
+	u, err := neturl.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return domain.NormalizeHost(u.Host)
+}
+
+// DomainLink returns the short link of the slug on the custom domain, served by the same paths as the default one, over HTTPS.
+func DomainLink(domainName string, slug string) string {
+	u, err := neturl.Parse(baseURL)
+	if err != nil {
+		return "https://" + domainName + "/" + slug
+	}
+	u.Scheme, u.Host = "https", domainName
+	return u.String() + slug
+}
+
+// IsDefaultHost tells whether the host serves the links by their keys rather than by slugs of a custom domain.
+func IsDefaultHost(host string) bool {
+	host = domain.NormalizeHost(host)
+	return host == "" || host == defaultHost
+}
+
+// Resolve finds the link requested from the host: slugs of the default host (and of unknown hosts) are keys themselves.
+// The slug as typed wins over its case-insensitive candidates.
+func Resolve(ctx context.Context, host string, slug string) (int, *Resolution, error) {
+	if IsDefaultHost(host) {
+		return http.StatusOK, &Resolution{Key: slug}, nil
+	}
+
+	return service.InTransaction(ctx, func(tx pgx.Tx) (int, *Resolution, error) {
+		resolution := &Resolution{}
+		err := tx.QueryRow(ctx, ResolveSQL, domain.NormalizeHost(host), append([]string{slug}, lookupCandidates(slug)...)).Scan(&resolution.DomainID, &resolution.DomainName, &resolution.Fallback, &resolution.Key)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return http.StatusOK, &Resolution{Key: slug}, nil
+		case err != nil:
+			return http.StatusInternalServerError, nil, fmt.Errorf("failed to resolve %q on %q: %w", slug, host, err)
+		case resolution.Key == "" && resolution.Fallback == "":
+			return http.StatusNotFound, resolution, fmt.Errorf("short URL %q is not found on %q", slug, host)
+		}
+		return http.StatusOK, resolution, nil
+	})
+}
@@ -0,0 +1,55 @@
+package shorturl
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDefaultHost(t *testing.T) {
+	assert.True(t, IsDefaultHost(""))
+	assert.True(t, IsDefaultHost("localhost:8080"))
+	assert.True(t, IsDefaultHost("LOCALHOST"))
+	assert.False(t, IsDefaultHost("go.acme.com"))
+}
+
+func TestResolveDefaultHost(t *testing.T) {
+	status, resolution, err := Resolve(context.Background(), "localhost:8080", "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, &Resolution{Key: "abc"}, resolution)
+}
+
+func TestSlugOfCustomDomain(t *testing.T) {
+	domainID := uuid.Must(uuid.NewV4())
+
+	url := &ShortURL{Target: "https://acme.com", Key: "summer", DomainID: &domainID}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.Equal(t, "summer", url.Slug)
+	assert.NotEqual(t, "summer", url.Key)
+	assert.NotEmpty(t, url.Key)
+	assert.Equal(t, 10, url.MaxAttempts()) // the generated key is retried, the slug is checked before
+
+	url = &ShortURL{Target: "https://acme.com", DomainID: &domainID}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.Equal(t, url.Key, url.Slug)
+	assert.Equal(t, 10, url.MaxAttempts())
+
+	url = &ShortURL{Target: "https://acme.com", Key: "summer", Slug: "winter"}
+	assert.NoError(t, url.Validate())
+	url.withDefaults(nil)
+	assert.NoError(t, url.Generate())
+	assert.Equal(t, "summer", url.Key)
+	assert.Equal(t, "summer", url.Slug)
+}
+
+func TestDomainLink(t *testing.T) {
+	assert.Equal(t, "https://go.acme.com/summer", DomainLink("go.acme.com", "summer"))
+}
@@ -0,0 +1,85 @@
+package shorturl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/lnk.by/shared/db"
+	"github.com/lnk.by/shared/service/screening"
+	"github.com/lnk.by/shared/utils"
+)
+
+var blocklists *screening.Blocklists
+
+// screenOnRedirect (SCREEN_ON_REDIRECT) screens the targets of active links on every click as well,
+// so the links flagged by refreshed blocklists are suspended on their next click.
+var screenOnRedirect, _ = strconv.ParseBool(os.Getenv("SCREEN_ON_REDIRECT"))
+
+func init() {
+	var err error
+	blocklists, err = screening.FromEnvironment()
+	if err != nil {
+		fmt.Printf("Failed to load blocklists: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// screen suspends the link if its target is blocklisted.
+func (u *ShortURL) screen() {
+	if reason := blocklists.Check(u.Target); reason != "" {
+		slog.Warn("Suspending short URL with blocklisted target", "key", u.Key, "target", u.Target, "reason", reason)
+		u.Status = utils.StatusSuspended
+	}
+}
+
+var SuspendSQL = "UPDATE shorturl SET status = 'suspended' WHERE key = $1 AND status = 'active'"
+
+// WarningResponse returns the warning page served instead of the redirect of a suspended link; ok is false if the link is not suspended.
+func (u *ShortURL) WarningResponse(ctx context.Context) (status int, headers map[string]string, body []byte, ok bool) {
+	if u.Status == utils.StatusActive && screenOnRedirect {
+		u.screen()
+		if u.Status == utils.StatusSuspended {
+			suspend(ctx, u.Key)
+		}
+	}
+	if u.Status != utils.StatusSuspended {
+		return 0, nil, nil, false
+	}
+
+	page, err := renderWarning("This link has been suspended", "The destination of this link was reported or detected as harmful, so you are not redirected to it.")
+	if err != nil {
+		slog.Warn("Failed to render warning", "key", u.Key, "error", err)
+		return http.StatusForbidden, map[string]string{"Cache-Control": "no-store"}, nil, true
+	}
+	return http.StatusForbidden, map[string]string{"Content-Type": ContentTypeHTML, "Cache-Control": "no-store"}, page, true
+}
+
+func suspend(ctx context.Context, key string) {
+	conn, err := db.Get(ctx)
+	if err != nil {
+		slog.Warn("Failed to suspend short URL", "key", key, "error", err)
+		return
+	}
+	defer conn.Release()
+	if _, err := conn.Exec(ctx, SuspendSQL, key); err != nil {
+		slog.Warn("Failed to suspend short URL", "key", key, "error", err)
+	}
+}
+
+func renderWarning(title string, message string) ([]byte, error) {
+	data := struct {
+		Title   string
+		Message string
+	}{title, message}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "warning.html", data); err != nil {
+		return nil, fmt.Errorf("failed to render warning: %w", err)
+	}
+	return buf.Bytes(), nil
+}
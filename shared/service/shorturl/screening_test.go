@@ -0,0 +1,53 @@
+package shorturl
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lnk.by/shared/service/screening"
+	"github.com/lnk.by/shared/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func withBlocklist(t *testing.T, domains string) {
+	path := filepath.Join(t.TempDir(), "domains.txt")
+	assert.NoError(t, os.WriteFile(path, []byte(domains), 0o600))
+	loaded, err := screening.New(screening.Files{Domains: path}, 0)
+	assert.NoError(t, err)
+
+	previous := blocklists
+	blocklists = loaded
+	t.Cleanup(func() { blocklists = previous })
+}
+
+func TestValidate_suspendsBlocklistedTarget(t *testing.T) {
+	withBlocklist(t, "phish.example\n")
+
+	u := &ShortURL{Target: "https://login.phish.example/"}
+	assert.NoError(t, u.Validate())
+	assert.Equal(t, utils.StatusSuspended, u.Status)
+
+	u = &ShortURL{Target: "https://example.com/"}
+	assert.NoError(t, u.Validate())
+	assert.Empty(t, u.Status)
+
+	target := "https://phish.example/"
+	patch := &BulkPatch{Target: &target}
+	assert.NoError(t, patch.Validate())
+	assert.Equal(t, utils.StatusSuspended, *patch.Status)
+}
+
+func TestWarningResponse(t *testing.T) {
+	_, _, _, suspended := (&ShortURL{Target: "https://example.com/", Status: utils.StatusActive}).WarningResponse(context.Background())
+	assert.False(t, suspended)
+
+	status, headers, body, suspended := (&ShortURL{Target: "https://phish.example/", Status: utils.StatusSuspended}).WarningResponse(context.Background())
+	assert.True(t, suspended)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, ContentTypeHTML, headers["Content-Type"])
+	assert.Contains(t, string(body), "suspended")
+	assert.NotContains(t, string(body), "phish.example")
+}
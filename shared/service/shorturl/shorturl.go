@@ -10,32 +10,68 @@ import (
 	"time"
 
 	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
 
 	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
 	"github.com/lnk.by/shared/service/stats"
 	"github.com/lnk.by/shared/utils"
 )
 
 type ShortURL struct {
-	Key         string       `json:"key"`
-	Target      string       `json:"target"`
-	ValidFrom   time.Time    `json:"validFrom"`
-	ValidUntil  time.Time    `json:"validUntil"`
-	CampaignID  *uuid.UUID   `json:"campaignId"`
-	CustomerID  *uuid.UUID   `json:"customerId"`
-	Status      utils.Status `json:"status"`
-	TotalLimit  int          `json:"totalLimit"`
-	DailyLimit  int          `json:"dailyLimit"`
-	HourlyLimit int          `json:"hourlyLimit"`
-	custom      bool
+	Key               string       `json:"key"`
+	Target            string       `json:"target"`
+	ValidFrom         time.Time    `json:"validFrom"`
+	ValidUntil        time.Time    `json:"validUntil"`
+	CampaignID        *uuid.UUID   `json:"campaignId"`
+	CustomerID        *uuid.UUID   `json:"customerId"`
+	Status            utils.Status `json:"status"`
+	TotalLimit        int          `json:"totalLimit"`
+	DailyLimit        int          `json:"dailyLimit"`
+	HourlyLimit       int          `json:"hourlyLimit"`
+	UTM               *utils.UTM   `json:"utm,omitempty"`
+	Passthrough       Passthrough  `json:"passthrough"`
+	InterstitialDelay int          `json:"interstitialDelay,omitempty"` // milliseconds the target is shown before redirecting, 0 - no interstitial
+	OpenGraph         *OpenGraph   `json:"openGraph,omitempty"`
+	RedirectType      RedirectType `json:"redirectType"`
+	DomainID          *uuid.UUID   `json:"domainId,omitempty"` // custom domain of the link, nil - the default one
+	Slug              string       `json:"slug"`               // path of the link on its domain, the same as the key on the default one
+	Tags              []string     `json:"tags"`               // free-form labels to filter the list by, see ListShortURLs
+	Reuse             bool         `json:"reuse,omitempty"`    // asks for an existing plain link to the same target instead of a new one, see reusable
+	Reused            bool         `json:"reused,omitempty"`   // tells that the returned link existed before the request
+	custom            bool
+	slugIsKey         bool
+	caseInsensitive   bool                 // the slug is found in any case it is typed in, see lookupCandidates
+	keys              service.KeyGenerator // of the organization of the customer, the default one if nil
+	domainName        string               // of the custom domain, when known, see link
 }
 
 func (u *ShortURL) FieldsPtrs() []any {
-	return []any{&u.Key, &u.custom, &u.Target, &u.CampaignID, &u.CustomerID, &u.Status, &u.TotalLimit, &u.DailyLimit, &u.HourlyLimit}
+	return []any{&u.Key, &u.custom, &u.Target, &u.CampaignID, &u.CustomerID, &u.Status, &u.TotalLimit, &u.DailyLimit, &u.HourlyLimit, &u.ValidFrom, &u.ValidUntil, &u.UTM, &u.Passthrough, &u.InterstitialDelay, &u.OpenGraph, &u.RedirectType, &u.DomainID, &u.Slug, &u.Tags, &u.caseInsensitive}
 }
 
 func (u *ShortURL) FieldsVals() []any {
-	return []any{u.Key, u.custom, u.Target, u.CampaignID, u.CustomerID, u.Status, u.TotalLimit, u.DailyLimit, u.HourlyLimit}
+	return []any{u.Key, u.custom, u.Target, u.CampaignID, u.CustomerID, u.Status, u.TotalLimit, u.DailyLimit, u.HourlyLimit, u.ValidFrom, u.ValidUntil, u.UTM, u.Passthrough, u.InterstitialDelay, u.OpenGraph, u.RedirectType, u.DomainID, u.Slug, u.Tags, u.caseInsensitive}
+}
+
+// UpdateVals leaves out the fields decided on creation and passes NULL for an omitted status, limit or validity, so UpdateSQL keeps the stored one.
+func (u *ShortURL) UpdateVals() []any {
+	return []any{u.Key, u.Target, u.CampaignID, u.CustomerID, nilIfZero(u.Status), nilIfZero(u.TotalLimit), nilIfZero(u.DailyLimit), nilIfZero(u.HourlyLimit), nilIfZeroTime(u.ValidFrom), nilIfZeroTime(u.ValidUntil), u.UTM, u.Passthrough, u.InterstitialDelay, u.OpenGraph, u.RedirectType, u.Tags}
+}
+
+func nilIfZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func nilIfZeroTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
 
 var generator *service.Generator
@@ -47,6 +83,16 @@ func init() {
 		fmt.Printf("Failed to initialize snowflake generator: %v\n", err)
 		os.Exit(1)
 	}
+	keys, err = keyConfigFromEnvironment(generator)
+	if err != nil {
+		fmt.Printf("Failed to initialize key generation: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// StartGenerator leases the machine ID of the generator of keys if it is configured so, see service.Generator.Start.
+func StartGenerator(ctx context.Context) error {
+	return generator.Start(ctx)
 }
 
 func (u *ShortURL) ParseID(idString string) (string, error) {
@@ -60,25 +106,92 @@ func (c *ShortURL) WithID(key string) {
 func (u *ShortURL) Validate() error {
 	// TODO: JWT: do not allow custom key, valid_from and valid_until for anonymous users
 	// TODO: JWT+: in future implement limitations on custom key, valid_from and valid_until for authenticated users.
+	u.Key, u.Slug = keyPolicy.Normalize(u.Key), keyPolicy.Normalize(u.Slug)
 	u.custom = u.Key != ""
 
-	if u.Target == "" {
-		return errors.New("target is required")
+	var err error
+	if u.Target, err = NormalizeTarget(u.Target); err != nil {
+		return err
 	}
+	u.screen()
 
-	return nil
+	if u.Tags, err = utils.NormalizeTags(u.Tags); err != nil {
+		return err
+	}
+
+	if u.custom {
+		if err := keyPolicy.Validate("key", u.Key); err != nil {
+			return err
+		}
+	}
+	if u.Slug != "" {
+		if err := keyPolicy.Validate("slug", u.Slug); err != nil {
+			return err
+		}
+	}
+
+	if u.InterstitialDelay < 0 || u.InterstitialDelay > MaxInterstitialDelay {
+		return fmt.Errorf("interstitialDelay must be between 0 and %d milliseconds", MaxInterstitialDelay)
+	}
+
+	if err := u.OpenGraph.validate(); err != nil {
+		return err
+	}
+
+	if u.RedirectType == "" {
+		u.RedirectType = RedirectFound
+	}
+	if err := u.RedirectType.validate(); err != nil {
+		return err
+	}
+
+	if u.Passthrough == "" {
+		u.Passthrough = PassthroughNone
+	}
+	return u.Passthrough.validate()
 }
 
-func (u *ShortURL) Generate() {
+func (u *ShortURL) Generate() error {
+	// typed slugs are found in any case if the policy folds them, generated ones if their alphabet does
+	u.caseInsensitive = !keyPolicy.CaseSensitive
 	if !u.custom {
-		u.Key = generator.NextBase62ID()
+		keyGenerator := u.keys
+		if keyGenerator == nil {
+			keyGenerator, _ = keys.keyGenerator("", "") // the defaults are verified on start
+		}
+		var err error
+		if u.Key, err = keyGenerator.NextKey(); err != nil {
+			return err
+		}
+		for keyPolicy.isBlocked(u.Key) {
+			if u.Key, err = keyGenerator.NextKey(); err != nil {
+				return err
+			}
+		}
+		if u.slugIsKey {
+			u.caseInsensitive = keyGenerator.CaseInsensitive()
+		}
+	}
+	if u.slugIsKey {
+		u.Slug = u.Key
 	}
 
 	if u.Status == "" {
 		u.Status = utils.StatusActive
 	}
+	return nil
 }
 
+// link returns the short link the short URL is served by: its slug on its custom domain, its key on the default one.
+func (u *ShortURL) link() string {
+	if u.DomainID != nil && u.domainName != "" {
+		return DomainLink(u.domainName, u.Slug)
+	}
+	return Link(u.Key)
+}
+
+// MaxAttempts retries the generated keys that collide; a custom key would collide again, and so would a requested slug,
+// which is checked before (see checkSlug).
 func (u *ShortURL) MaxAttempts() int {
 	if u.custom {
 		return 1
@@ -87,54 +200,363 @@ func (u *ShortURL) MaxAttempts() int {
 	return 10
 }
 
+// RetrieveValidSQL returns the remaining limits (unset ones stay at math.MaxInt32, see IsLimited) and merges
+// the UTM defaults of the link over the defaults of its campaign, so the redirect gets the effective ones.
 var (
-	CreateSQL        service.CreateSQL[*ShortURL]   = "INSERT INTO shorturl (key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
-	RetrieveSQL      service.RetrieveSQL[*ShortURL] = "SELECT key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit FROM shorturl WHERE key = $1 AND status='active'"
+	CreateSQL        service.CreateSQL[*ShortURL]   = "INSERT INTO shorturl (key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit, valid_from, valid_until, utm, passthrough, interstitial_delay, open_graph, redirect_type, domain_id, slug, tags, case_insensitive) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)"
+	RetrieveSQL      service.RetrieveSQL[*ShortURL] = "SELECT key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit, valid_from, valid_until, utm, passthrough, interstitial_delay, open_graph, redirect_type, domain_id, slug, tags, case_insensitive FROM shorturl WHERE key = $1 AND status='active'"
 	RetrieveValidSQL service.RetrieveSQL[*ShortURL] = `
 		SELECT 
-			u.key, is_custom, target, campaign_id, customer_id, status, 
-			u.total_limit - t.total as total_limit, u.daily_limit - d.%[1]s as daily_limit, u.hourly_limit - h.%[2]s as hourly_limit 
+			u.key, u.is_custom, u.target, u.campaign_id, u.customer_id, u.status, 
+			CASE WHEN u.total_limit = 2147483647 THEN u.total_limit ELSE u.total_limit - t.total END as total_limit, 
+			CASE WHEN u.daily_limit = 2147483647 THEN u.daily_limit ELSE u.daily_limit - d.%[1]s END as daily_limit, 
+			CASE WHEN u.hourly_limit = 2147483647 THEN u.hourly_limit ELSE u.hourly_limit - h.%[2]s END as hourly_limit, 
+			u.valid_from, u.valid_until, 
+			NULLIF(COALESCE(c.utm, '{}'::jsonb) || COALESCE(u.utm, '{}'::jsonb), '{}'::jsonb) as utm, u.passthrough, u.interstitial_delay, u.open_graph, u.redirect_type, u.domain_id, u.slug, u.tags, u.case_insensitive 
 		FROM shorturl u 
+		LEFT JOIN campaign c on c.id=u.campaign_id 
 		JOIN total_count t on t.key=u.key 
 		JOIN daily_count d on d.key=u.key 
 		JOIN hourly_count h on h.key=u.key 
-		WHERE u.key = $1 AND u.status='active' AND now() BETWEEN u.valid_from AND u.valid_until`
-	UpdateSQL service.UpdateSQL[*ShortURL] = "UPDATE shorturl SET target = $2, campaign_id = $3, customer_id = $4, status = $5 WHERE key = $1"
-	DeleteSQL service.DeleteSQL[*ShortURL] = "DELETE FROM shorturl WHERE key = $1"
-	ListSQL   service.ListSQL[*ShortURL]   = "SELECT key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit FROM shorturl WHERE status='active' AND customer_id=$1 OFFSET $2 LIMIT $3"
+		WHERE u.key = $1 AND u.status IN ('active', 'suspended') AND now() BETWEEN u.valid_from AND u.valid_until`
+	// The arguments are UpdateVals: a NULL customer, status, limit or validity keeps the stored one. Suspended links stay suspended: only moderators restore them.
+	UpdateSQL service.UpdateSQL[*ShortURL] = `
+		UPDATE shorturl SET 
+			target = $2, campaign_id = $3, customer_id = COALESCE($4, customer_id), status = CASE WHEN status = 'suspended' THEN status ELSE COALESCE($5, status) END, 
+			total_limit = COALESCE($6, total_limit), daily_limit = COALESCE($7, daily_limit), hourly_limit = COALESCE($8, hourly_limit), 
+			valid_from = COALESCE($9, valid_from), valid_until = COALESCE($10, valid_until), 
+			utm = $11, passthrough = $12, interstitial_delay = $13, open_graph = $14, redirect_type = $15, tags = $16 
+		WHERE key = $1 
+		RETURNING key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit, valid_from, valid_until, utm, passthrough, interstitial_delay, open_graph, redirect_type, domain_id, slug, tags, case_insensitive`
+	DeleteSQL  service.DeleteSQL[*ShortURL]  = "DELETE FROM shorturl WHERE key = $1"
+	VersionSQL service.VersionSQL[*ShortURL] = "SELECT updated_at FROM shorturl WHERE key = $1"
 )
 
+var BannedSQL = "SELECT EXISTS (SELECT 1 FROM customer WHERE id = $1 AND status = 'banned')"
+
+var errBanned = errors.New("the customer is banned")
+
+// checkNotBanned forbids banned customers to create or change short URLs.
+func checkNotBanned(ctx context.Context, q service.Querier, customerID *uuid.UUID) (int, error) {
+	if customerID == nil {
+		return http.StatusOK, nil
+	}
+	var banned bool
+	if err := q.QueryRow(ctx, BannedSQL, customerID).Scan(&banned); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to check customer %v: %w", customerID, err)
+	}
+	if banned {
+		return http.StatusForbidden, errBanned
+	}
+	return http.StatusOK, nil
+}
+
+var (
+	errForeignDomain     = errors.New("the domain does not belong to the organization of the customer")
+	errDomainNotVerified = errors.New("the domain is not verified yet")
+)
+
+// checkDomain only lets customers create links on the verified domains of their organizations; nil is the default domain.
+func checkDomain(ctx context.Context, q service.Querier, url *ShortURL) (int, error) {
+	if url.DomainID == nil {
+		return http.StatusOK, nil
+	}
+	status, d, err := domain.RetrieveOwned(ctx, q, *url.DomainID, url.CustomerID)
+	switch {
+	case status == http.StatusNotFound:
+		return http.StatusForbidden, fmt.Errorf("domain %v: %w", url.DomainID, errForeignDomain)
+	case err != nil:
+		return status, err
+	case d.VerifiedAt == nil:
+		return http.StatusUnprocessableEntity, fmt.Errorf("domain %q: %w", d.Name, errDomainNotVerified)
+	}
+	url.domainName = d.Name
+	return http.StatusOK, nil
+}
+
+// checkSlug fails with 409 if the slug requested on the custom domain is taken there.
+func checkSlug(ctx context.Context, q service.Querier, url *ShortURL) (int, error) {
+	if url.slugIsKey {
+		return http.StatusOK, nil
+	}
+	var exists bool
+	if err := q.QueryRow(ctx, KeyExistsSQL, url.Slug, url.DomainID).Scan(&exists); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to check availability of %q: %w", url.Slug, err)
+	}
+	if exists {
+		return http.StatusConflict, fmt.Errorf("slug %q is already taken", url.Slug)
+	}
+	return http.StatusOK, nil
+}
+
 func CreateShortURL(ctx context.Context, requestBody []byte, userID *uuid.UUID) (int, string) {
 	url, err := service.Parse[*ShortURL](ctx, requestBody)
 	if err != nil {
 		return http.StatusBadRequest, http.StatusText(http.StatusBadRequest)
 	}
-	if url.CustomerID == nil {
-		url.CustomerID = userID
+	url.withDefaults(userID)
+	cacheTitle(ctx, url.Target) // for the preview, before the transaction not to hold it while fetching
+
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+		return createShortURL(ctx, tx, url)
+	}))
+}
+
+// defaultValidUntil is the same as the default of the valid_until column.
+var defaultValidUntil = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (u *ShortURL) withDefaults(userID *uuid.UUID) {
+	// on a custom domain the requested key is the slug of the link, while the key is always generated to stay unique
+	if u.DomainID != nil {
+		if u.Slug == "" {
+			u.Slug = u.Key
+		}
+		u.Key, u.custom = "", false
+	}
+	u.slugIsKey = u.DomainID == nil || u.Slug == ""
+	if u.CustomerID == nil {
+		u.CustomerID = userID
+	}
+	u.withUnsetLimits()
+}
+
+// withUnsetLimits replaces the unset limits and validity by the defaults of their columns: unlimited and valid from now on.
+func (u *ShortURL) withUnsetLimits() {
+	if u.TotalLimit == 0 {
+		u.TotalLimit = math.MaxInt32
 	}
-	if url.TotalLimit == 0 {
-		url.TotalLimit = math.MaxInt32
+	if u.DailyLimit == 0 {
+		u.DailyLimit = math.MaxInt32
 	}
-	if url.DailyLimit == 0 {
-		url.DailyLimit = math.MaxInt32
+	if u.HourlyLimit == 0 {
+		u.HourlyLimit = math.MaxInt32
 	}
-	if url.HourlyLimit == 0 {
-		url.HourlyLimit = math.MaxInt32
+	if u.ValidFrom.IsZero() {
+		u.ValidFrom = time.Now()
 	}
+	if u.ValidUntil.IsZero() {
+		u.ValidUntil = defaultValidUntil
+	}
+}
 
-	status, body := service.CreateRecord(ctx, CreateSQL, url, 0)
+// ReuseSQL finds the oldest plain link of the owner to the target: active, generated, on the default domain, without limits,
+// validity window or any other option, so it behaves exactly like the requested one.
+var ReuseSQL = `
+	SELECT key, is_custom, target, campaign_id, customer_id, status, total_limit, daily_limit, hourly_limit, valid_from, valid_until, utm, passthrough, interstitial_delay, open_graph, redirect_type, domain_id, slug, tags, case_insensitive
+	FROM shorturl
+	WHERE target = $1 AND customer_id IS NOT DISTINCT FROM $2 AND campaign_id IS NOT DISTINCT FROM $3
+	AND status = 'active' AND NOT is_custom AND domain_id IS NULL
+	AND total_limit = 2147483647 AND daily_limit = 2147483647 AND hourly_limit = 2147483647
+	AND valid_from <= now() AND valid_until >= $4
+	AND utm IS NULL AND open_graph IS NULL AND passthrough = 'none' AND interstitial_delay = 0 AND redirect_type = '302'
+	AND cardinality(tags) = 0
+	ORDER BY created_at
+	LIMIT 1`
 
-	if status < http.StatusMultipleChoices {
-		e := stats.Event{Key: url.Key}
-		createSQLs := []service.CreateSQL[*stats.Event]{stats.CreateTotalSQL, stats.CreateDailySQL, stats.CreateHourlySQL, stats.CreateUserAgentSQL, stats.CreateCountrySQL}
-		for _, sql := range createSQLs {
-			status, body := service.CreateRecord(ctx, sql, &e, 0)
-			if status >= http.StatusBadRequest {
-				return status, body
-			}
+// LockTargetSQL serializes the creation of links to the same target, so concurrent requests do not both miss the link to reuse.
+var LockTargetSQL = "SELECT pg_advisory_xact_lock(hashtext($1))"
+
+// reusable tells whether the requested link may be served by an existing one: it asks for reuse and has no option of its own.
+func (u *ShortURL) reusable() bool {
+	return u.Reuse && !u.custom && u.DomainID == nil && u.Slug == "" && u.Status == "" &&
+		u.TotalLimit == math.MaxInt32 && u.DailyLimit == math.MaxInt32 && u.HourlyLimit == math.MaxInt32 &&
+		!u.ValidFrom.After(time.Now()) && u.ValidUntil.Equal(defaultValidUntil) &&
+		u.UTM == nil && u.OpenGraph == nil && u.Passthrough == PassthroughNone && u.InterstitialDelay == 0 && u.RedirectType == RedirectFound && len(u.Tags) == 0
+}
+
+// findReusable replaces the requested link by the existing one it may be served by, if there is one.
+func findReusable(ctx context.Context, tx pgx.Tx, url *ShortURL) (bool, error) {
+	if _, err := tx.Exec(ctx, LockTargetSQL, url.Target); err != nil {
+		return false, fmt.Errorf("failed to lock target %q: %w", url.Target, err)
+	}
+	existing := &ShortURL{}
+	err := tx.QueryRow(ctx, ReuseSQL, url.Target, url.CustomerID, url.CampaignID, defaultValidUntil).Scan(existing.FieldsPtrs()...)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to look up a link to %q: %w", url.Target, err)
+	}
+	*url = *existing
+	url.Reused = true
+	return true, nil
+}
+
+// createShortURL inserts the short URL together with its counter rows: the redirect query joins them, so a link without counters is unreachable.
+func createShortURL(ctx context.Context, tx pgx.Tx, url *ShortURL) (int, *ShortURL, error) {
+	status, settings, err := retrieveKeySettings(ctx, tx, url.CustomerID)
+	if err != nil {
+		return status, url, err
+	}
+	if url.custom {
+		if err := settings.checkPrefix(url.Key); err != nil {
+			return http.StatusBadRequest, url, err
+		}
+	} else if url.keys, err = settings.keyGenerator(); err != nil {
+		return http.StatusInternalServerError, url, err
+	}
+
+	if status, err := checkNotBanned(ctx, tx, url.CustomerID); err != nil {
+		return status, url, err
+	}
+	if status, err := checkDomain(ctx, tx, url); err != nil {
+		return status, url, err
+	}
+	if status, err := checkSlug(ctx, tx, url); err != nil {
+		return status, url, err
+	}
+	if status, err := checkTarget(ctx, tx, url.CustomerID, url.Target); err != nil {
+		return status, url, err
+	}
+	if url.reusable() {
+		reused, err := findReusable(ctx, tx, url)
+		if err != nil {
+			return http.StatusInternalServerError, url, err
+		}
+		if reused {
+			return http.StatusOK, url, nil
+		}
+	}
+
+	status, url, err = service.CreateRecordInTx(ctx, tx, CreateSQL, url, 0)
+	if err != nil {
+		return status, url, err
+	}
+
+	if status, err := stats.CreateCounters(ctx, tx, url.Key); err != nil {
+		return status, url, err
+	}
+
+	return status, url, nil
+}
+
+// UpdateShortURL updates the short URL after checking its target like on creation; the customer defaults to the current user.
+// It fails with 412 unless the If-Match header (if any) matches the ETag of the short URL, and returns the new ETag.
+func UpdateShortURL(ctx context.Context, key string, requestBody []byte, ifMatch string) (int, string, string) {
+	url, err := service.Parse[*ShortURL](ctx, requestBody)
+	if err != nil {
+		status, body := service.Marshal(http.StatusBadRequest, url, err)
+		return status, body, ""
+	}
+	url.Key = key
+
+	var etag string
+	status, body := service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+		if status, err := service.CheckVersion(ctx, tx, VersionSQL, key, ifMatch); err != nil {
+			return status, url, err
 		}
+		status, customerID, err := customerOf(ctx, tx, url)
+		if err != nil {
+			return status, url, err
+		}
+		if status, err := checkNotBanned(ctx, tx, customerID); err != nil {
+			return status, url, err
+		}
+		if status, err := checkTarget(ctx, tx, customerID, url.Target); err != nil {
+			return status, url, err
+		}
+		return updateVersioned(ctx, tx, url, &etag)
+	}))
+	if status != http.StatusOK {
+		etag = ""
+	}
+	return status, body, etag
+}
+
+// PatchShortURL updates only the fields given in the JSON Merge Patch, checking the result like UpdateShortURL.
+func PatchShortURL(ctx context.Context, key string, patch []byte, ifMatch string) (int, string, string) {
+	var etag string
+	status, body := service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+		if status, err := service.CheckVersion(ctx, tx, VersionSQL, key, ifMatch); err != nil {
+			return status, nil, err
+		}
+		status, url, err := service.RetrieveForUpdate(ctx, tx, RetrieveSQL, key)
+		if err != nil {
+			return status, url, err
+		}
+		if url, err = mergeShortURL(url, patch); err != nil {
+			return http.StatusBadRequest, url, err
+		}
+		url.Key = key
+		status, customerID, err := customerOf(ctx, tx, url)
+		if err != nil {
+			return status, url, err
+		}
+
+		if status, err := checkNotBanned(ctx, tx, customerID); err != nil {
+			return status, url, err
+		}
+		if status, err := checkTarget(ctx, tx, customerID, url.Target); err != nil {
+			return status, url, err
+		}
+		return updateVersioned(ctx, tx, url, &etag)
+	}))
+	if status != http.StatusOK {
+		etag = ""
+	}
+	return status, body, etag
+}
+
+// mergeShortURL applies the merge patch to the stored short URL. The limits and the validity removed by the patch
+// are reset to their defaults, as the NULL of an omitted one would keep the stored value (see UpdateSQL).
+func mergeShortURL(url *ShortURL, patch []byte) (*ShortURL, error) {
+	url.Slug = "" // decided on creation, like the key
+	merged, err := service.Merge(url, patch)
+	if err != nil {
+		return merged, err
 	}
-	return status, body
+	merged.withUnsetLimits()
+	return merged, nil
+}
+
+// CustomerSQL returns the stored customer of the short URL, which an update without a customer keeps.
+var CustomerSQL = "SELECT customer_id FROM shorturl WHERE key = $1"
+
+// customerOf returns the customer the updated short URL is checked for: the given one, or the stored one if none is given.
+func customerOf(ctx context.Context, tx pgx.Tx, url *ShortURL) (int, *uuid.UUID, error) {
+	if url.CustomerID != nil {
+		return http.StatusOK, url.CustomerID, nil
+	}
+	var customerID *uuid.UUID
+	if err := tx.QueryRow(ctx, CustomerSQL, url.Key).Scan(&customerID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, nil, fmt.Errorf("failed to retrieve the customer of %T %q: %w", url, url.Key, err)
+		}
+		return http.StatusInternalServerError, nil, fmt.Errorf("failed to retrieve the customer of %T %q: %w", url, url.Key, err)
+	}
+	return http.StatusOK, customerID, nil
+}
+
+// updateVersioned updates the short URL and reads its new ETag. The stored short URL is returned, as omitted fields keep their values.
+func updateVersioned(ctx context.Context, tx pgx.Tx, url *ShortURL, etag *string) (int, *ShortURL, error) {
+	updated := &ShortURL{}
+	if err := tx.QueryRow(ctx, string(UpdateSQL), url.UpdateVals()...).Scan(updated.FieldsPtrs()...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return http.StatusNotFound, url, fmt.Errorf("failed to update %T %v: %w", url, url, err)
+		}
+		return http.StatusInternalServerError, url, fmt.Errorf("failed to update %T %v: %w", url, url, err)
+	}
+	status, version, err := service.VersionInTx(ctx, tx, VersionSQL, updated.Key)
+	*etag = version
+	return status, updated, err
+}
+
+// DeleteShortURL deletes the short URL and its counters unless the If-Match header (if any) does not match its ETag.
+func DeleteShortURL(ctx context.Context, key string, ifMatch string) (int, string) {
+	return service.Marshal(service.InTransaction(ctx, func(tx pgx.Tx) (int, *ShortURL, error) {
+		if status, err := service.CheckVersion(ctx, tx, VersionSQL, key, ifMatch); err != nil {
+			return status, nil, err
+		}
+		if status, err := service.DeleteInTx(ctx, tx, DeleteSQL, key); err != nil {
+			return status, nil, err
+		}
+
+		if status, err := stats.DeleteCounters(ctx, tx, key); err != nil {
+			return status, nil, err
+		}
+
+		return http.StatusNoContent, nil, nil
+	}))
 }
 
 func GetLimitExceededMessage(url *ShortURL) (string, int) {
@@ -0,0 +1,60 @@
+package shorturl
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReusable(t *testing.T) {
+	parse := func(content string) *ShortURL {
+		url := &ShortURL{}
+		assert.NoError(t, json.Unmarshal([]byte(content), url))
+		assert.NoError(t, url.Validate())
+		url.withDefaults(nil)
+		return url
+	}
+
+	assert.True(t, parse(`{"target": "https://acme.com/spring", "reuse": true}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring"}`).reusable())
+
+	// links with options of their own are always created
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "key": "spring"}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "totalLimit": 100}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "validUntil": "2030-01-01T00:00:00Z"}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "utm": {"source": "mail"}}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "redirectType": "301"}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "interstitialDelay": 1000}`).reusable())
+	assert.False(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "tags": ["spring"]}`).reusable())
+	assert.True(t, parse(`{"target": "https://acme.com/spring", "reuse": true, "tags": [" "]}`).reusable())
+}
+
+func TestValidateTags(t *testing.T) {
+	url := &ShortURL{Target: "https://acme.com/spring", Tags: []string{"Spring", "sale", "spring "}}
+	assert.NoError(t, url.Validate())
+	assert.Equal(t, []string{"sale", "spring"}, url.Tags)
+
+	url = &ShortURL{Target: "https://acme.com/spring"}
+	assert.NoError(t, url.Validate())
+	assert.Equal(t, []string{}, url.Tags)
+}
+
+func TestMergeShortURL_removesLimits(t *testing.T) {
+	stored := &ShortURL{Key: "spring", Target: "https://acme.com/spring", TotalLimit: 100, DailyLimit: 10, HourlyLimit: math.MaxInt32,
+		ValidFrom: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), ValidUntil: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)}
+
+	merged, err := mergeShortURL(stored, []byte(`{"totalLimit": null, "validUntil": null}`))
+	assert.NoError(t, err)
+	assert.Equal(t, math.MaxInt32, merged.TotalLimit)
+	assert.Equal(t, 10, merged.DailyLimit)
+	assert.Equal(t, defaultValidUntil, merged.ValidUntil)
+	assert.Equal(t, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), merged.ValidFrom)
+
+	// the defaults are passed to UpdateSQL rather than NULLs that would keep the stored values
+	vals := merged.UpdateVals()
+	assert.Equal(t, math.MaxInt32, *vals[5].(*int))
+	assert.Equal(t, defaultValidUntil, *vals[9].(*time.Time))
+}
@@ -0,0 +1,199 @@
+package shorturl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/lnk.by/shared/service"
+	"github.com/lnk.by/shared/service/domain"
+)
+
+// allowedSchemes of targets; TARGET_SCHEMES replaces them with a comma-separated list.
+var allowedSchemes = schemesFromEnvironment()
+
+func schemesFromEnvironment() []string {
+	value := os.Getenv("TARGET_SCHEMES")
+	if value == "" {
+		return []string{"http", "https"}
+	}
+	var schemes []string
+	for _, scheme := range strings.Split(value, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+var ErrTargetRequired = errors.New("target is required")
+
+// NormalizeTarget parses the target strictly: an absolute URL of an allowed scheme with no credentials (mostly used to disguise
+// the real host), whose host is converted to punycode. Targets on the short link host are rejected, they would redirect in a loop.
+func NormalizeTarget(target string) (string, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", ErrTargetRequired
+	}
+	u, err := neturl.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	switch {
+	case !u.IsAbs():
+		return "", fmt.Errorf("target %q must be an absolute URL", target)
+	case !slices.Contains(allowedSchemes, u.Scheme):
+		return "", fmt.Errorf("scheme %q of target is not allowed, use one of %v", u.Scheme, allowedSchemes)
+	case u.User != nil:
+		return "", fmt.Errorf("target %q must not contain credentials", target)
+	case u.Host == "" && (u.Scheme == "http" || u.Scheme == "https"):
+		return "", fmt.Errorf("target %q must have a host", target)
+	case u.Host == "":
+		return u.String(), nil
+	}
+
+	host, err := domain.ToASCII(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	if IsDefaultHost(host) {
+		return "", fmt.Errorf("target %q points to a short link, the redirect would loop", target)
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+// TargetPolicySQL returns the domains the organization of the customer allows and denies in targets.
+var TargetPolicySQL = "SELECT o.target_allowlist, o.target_denylist FROM customer c JOIN organization o ON o.id = c.organization_id WHERE c.id = $1"
+
+// CustomDomainSQL tells whether the host is a custom domain of short links.
+var CustomDomainSQL = "SELECT EXISTS (SELECT 1 FROM domain WHERE name = $1)"
+
+type targetPolicy struct {
+	allow []string
+	deny  []string
+}
+
+func (p *targetPolicy) check(host string) error {
+	matches := func(d string) bool { return domain.Matches(host, d) }
+	if slices.ContainsFunc(p.deny, matches) {
+		return fmt.Errorf("targets on %q are denied by the organization", host)
+	}
+	if len(p.allow) > 0 && !slices.ContainsFunc(p.allow, matches) {
+		return fmt.Errorf("targets on %q are not allowed by the organization", host)
+	}
+	return nil
+}
+
+// checkTarget rejects normalized targets on the custom domains of short links and the ones the organization of the customer does not allow.
+func checkTarget(ctx context.Context, q service.Querier, customerID *uuid.UUID, target string) (int, error) {
+	u, err := neturl.Parse(target)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid target %q: %w", target, err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return http.StatusOK, nil
+	}
+
+	var custom bool
+	if err := q.QueryRow(ctx, CustomDomainSQL, host).Scan(&custom); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to check domain of target %q: %w", target, err)
+	}
+	if custom {
+		return http.StatusBadRequest, fmt.Errorf("target %q points to a short link, the redirect would loop", target)
+	}
+
+	if customerID == nil {
+		return http.StatusOK, nil
+	}
+	policy := &targetPolicy{}
+	err = q.QueryRow(ctx, TargetPolicySQL, customerID).Scan(&policy.allow, &policy.deny)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return http.StatusInternalServerError, fmt.Errorf("failed to retrieve target policy of customer %v: %w", customerID, err)
+	}
+	if err := policy.check(host); err != nil {
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// Passthrough defines what happens with the query parameters the visitor arrives with.
+type Passthrough string
+
+const (
+	PassthroughNone     Passthrough = "none"     // dropped
+	PassthroughAppend   Passthrough = "append"   // forwarded unless the target or the UTM defaults already have them
+	PassthroughOverride Passthrough = "override" // forwarded, replacing the parameters of the target
+)
+
+func (p Passthrough) IsValid() bool {
+	switch p {
+	case PassthroughNone, PassthroughAppend, PassthroughOverride:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p Passthrough) validate() error {
+	if !p.IsValid() {
+		return fmt.Errorf("unsupported passthrough %q, use %s, %s or %s", p, PassthroughNone, PassthroughAppend, PassthroughOverride)
+	}
+	return nil
+}
+
+// RedirectTarget builds the URL the visitor is redirected to. The parameters already present in the target always win
+// over the UTM defaults (of the link, then of its campaign); the incoming parameters are forwarded according to Passthrough.
+// The target is returned verbatim when nothing is added.
+func (u *ShortURL) RedirectTarget(incoming neturl.Values) string {
+	target, err := neturl.Parse(u.Target)
+	if err != nil {
+		return u.Target
+	}
+
+	query := target.Query()
+	changed := false
+	set := func(name string, values []string, override bool) {
+		if query.Has(name) && !override {
+			return
+		}
+		query[name] = values
+		changed = true
+	}
+
+	for name, value := range u.UTM.Params() {
+		set(name, []string{value}, false)
+	}
+	if u.Passthrough == PassthroughAppend || u.Passthrough == PassthroughOverride {
+		for name, values := range incoming {
+			if name == SourceParam {
+				continue // our own marker, see QRLink
+			}
+			set(name, values, u.Passthrough == PassthroughOverride)
+		}
+	}
+
+	if !changed {
+		return u.Target
+	}
+	target.RawQuery = query.Encode()
+	return target.String()
+}
@@ -2,8 +2,8 @@ package service
 
 import (
 	"errors"
-	"hash/fnv"
-	"os"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -28,10 +28,26 @@ type Generator struct {
 	lastUnixMs int64
 	sequence   int64
 	machineID  int64
+	lease      bool          // the machine ID is leased on Start
+	leasedTill int64         // milliseconds since the Unix epoch the lease is sure to hold till, 0 - not leased
+	renewed    *sync.Cond    // signals a new leasedTill to NextID waiting for it
+	leaseWait  time.Duration // NextID waits for a renewal at most, machineLeaseWait but in tests
+	clock      func() int64  // milliseconds since the Unix epoch
+	behind     bool          // the clock went back and has not caught up yet
 }
 
+// NewDefaultGenerator creates a generator with the machine ID of MACHINE_ID, see MachineIDFromEnvironment.
 func NewDefaultGenerator() (*Generator, error) {
-	return NewGenerator(GetMachineID())
+	machineID, lease, err := MachineIDFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	g, err := NewGenerator(machineID)
+	if err != nil {
+		return nil, err
+	}
+	g.lease = lease
+	return g, nil
 }
 
 // NewGenerator creates a new Snowflake ID generator with the given machine ID (0–1023).
@@ -39,24 +55,63 @@ func NewGenerator(machineID int64) (*Generator, error) {
 	if machineID < 0 || machineID > maxMachineID {
 		return nil, errors.New("machine ID out of range")
 	}
-	return &Generator{
+	g := &Generator{
 		machineID: machineID,
-	}, nil
+		clock:     func() int64 { return time.Now().UnixMilli() },
+		leaseWait: machineLeaseWait,
+	}
+	g.renewed = sync.NewCond(&g.mu)
+	return g, nil
 }
 
-// NextID generates a new unique 64-bit Snowflake ID.
-func (g *Generator) NextID() int64 {
+// ErrLeaseExpired is returned by NextID while the lease of the machine ID cannot be renewed.
+var ErrLeaseExpired = errors.New("the lease of the machine ID has expired")
+
+// NextID generates a new unique 64-bit Snowflake ID. When the clock goes back, the IDs keep counting from the last timestamp,
+// running ahead of the clock by a millisecond per 4096 IDs until it catches up. Once a leased machine ID may have expired,
+// it waits for the lease to be renewed (as another machine may have taken the ID over) and fails with ErrLeaseExpired if it is not.
+func (g *Generator) NextID() (int64, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	now := time.Now().UnixMilli()
+	now := g.clock()
+	if g.leasedTill != 0 && now >= g.leasedTill {
+		// wakes up the wait below once it is over
+		timer := time.AfterFunc(g.leaseWait, func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.renewed.Broadcast()
+		})
+		defer timer.Stop()
+		giveUp := time.Now().Add(g.leaseWait)
+		for now >= g.leasedTill {
+			if !time.Now().Before(giveUp) {
+				return 0, fmt.Errorf("%w: machine ID %d", ErrLeaseExpired, g.machineID)
+			}
+			g.renewed.Wait()
+			now = g.clock()
+		}
+	}
+
+	if now < g.lastUnixMs {
+		if !g.behind {
+			slog.Warn("Clock moved backwards", "byMs", g.lastUnixMs-now, "machineId", g.machineID)
+			g.behind = true
+		}
+		now = g.lastUnixMs
+	} else {
+		g.behind = false
+	}
 
 	if now == g.lastUnixMs {
 		g.sequence = (g.sequence + 1) & maxSequence
 		if g.sequence == 0 {
-			// Sequence overflow, wait for next millisecond
+			// Sequence overflow, wait for next millisecond (or take it ahead of a clock that went back)
+			if g.behind {
+				now = g.lastUnixMs + 1
+			}
 			for now <= g.lastUnixMs {
-				now = time.Now().UnixMilli()
+				now = g.clock()
 			}
 		}
 	} else {
@@ -67,31 +122,17 @@ func (g *Generator) NextID() int64 {
 
 	return ((now - epoch) << timestampShift) |
 		(g.machineID << machineIDShift) |
-		g.sequence
+		g.sequence, nil
 }
 
-func GetMachineID() int64 {
-	val := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME")
-	if val == "" {
-		val = "default-machine"
+func (g *Generator) NextBase62ID() (string, error) {
+	id, err := g.NextID()
+	if err != nil {
+		return "", err
 	}
-	h := fnv.New32a()
-	h.Write([]byte(val))
-	return int64(h.Sum32() & 0x3FF) // 10 bits = 1023 max
-}
-
-func (g *Generator) NextBase62ID() string {
-	return EncodeBase62(g.NextID())
+	return EncodeBase62(id), nil
 }
 
 func EncodeBase62(n int64) string {
-	if n == 0 {
-		return string(base62Chars[0])
-	}
-	result := make([]byte, 0)
-	for n > 0 {
-		result = append([]byte{base62Chars[n%62]}, result...)
-		n /= 62
-	}
-	return string(result)
+	return Alphabets[AlphabetBase62].Encode(uint64(n))
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -10,10 +11,14 @@ func TestGenerateId(t *testing.T) {
 	generator, err := NewDefaultGenerator()
 	assert.NoError(t, err)
 
-	id1 := EncodeBase62(generator.NextID())
+	id, err := generator.NextID()
+	assert.NoError(t, err)
+	id1 := EncodeBase62(id)
 	assert.Len(t, id1, 10)
 
-	id2 := EncodeBase62(generator.NextID())
+	id, err = generator.NextID()
+	assert.NoError(t, err)
+	id2 := EncodeBase62(id)
 	assert.Len(t, id2, 10)
 
 	assert.NotEqual(t, id1, id2)
@@ -23,11 +28,40 @@ func TestGenerateBase62Id(t *testing.T) {
 	generator, err := NewDefaultGenerator()
 	assert.NoError(t, err)
 
-	id1 := generator.NextBase62ID()
+	id1, err := generator.NextBase62ID()
+	assert.NoError(t, err)
 	assert.Len(t, id1, 10)
 
-	id2 := generator.NextBase62ID()
+	id2, err := generator.NextBase62ID()
+	assert.NoError(t, err)
 	assert.Len(t, id2, 10)
 
 	assert.NotEqual(t, id1, id2)
 }
+
+func TestNextIDWithClockRollback(t *testing.T) {
+	generator, err := NewGenerator(7)
+	assert.NoError(t, err)
+	now := time.Now().UnixMilli()
+	generator.clock = func() int64 { return now }
+
+	first, _ := generator.NextID()
+	now -= 1000
+	second, _ := generator.NextID()
+	assert.Greater(t, second, first)
+	assert.True(t, generator.behind)
+
+	// the sequence overflows into the next millisecond without waiting for the clock
+	last := second
+	for range maxSequence + 1 {
+		id, _ := generator.NextID()
+		assert.Greater(t, id, last)
+		last = id
+	}
+	assert.Equal(t, now+1001, generator.lastUnixMs)
+
+	now += 2000
+	id, _ := generator.NextID()
+	assert.Greater(t, id, last)
+	assert.False(t, generator.behind)
+}
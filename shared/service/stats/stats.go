@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/lnk.by/shared/db"
 	"github.com/lnk.by/shared/service"
 	"github.com/lnk.by/shared/service/stats/maxmind"
@@ -19,11 +21,15 @@ type Event struct {
 	Referer   string    `json:"referer,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
 	Language  string    `json:"language,omitempty"`
+	Source    string    `json:"source,omitempty"` // e.g. "qr" when the link was scanned from a QR code
 }
 
+// SourceQR marks the events of links scanned from QR codes.
+const SourceQR = "qr"
+
 var receivers []func(context.Context, Event) string = []func(context.Context, Event) string{
 	func(ctx context.Context, e Event) string {
-		return "UPDATE total_count SET total = total + 1 WHERE key = $1"
+		return fmt.Sprintf("UPDATE total_count SET total = total + 1, qr = qr + %d WHERE key = $1", b2i(e.Source == SourceQR))
 	},
 	func(ctx context.Context, e Event) string {
 		columnName := fmt.Sprintf("day%03d", e.Timestamp.YearDay())
@@ -58,7 +64,8 @@ func (e *Event) Validate() error {
 	return nil
 }
 
-func (u *Event) Generate() {
+func (u *Event) Generate() error {
+	return nil
 }
 
 var (
@@ -68,3 +75,43 @@ var (
 	CreateUserAgentSQL service.CreateSQL[*Event] = "INSERT INTO useragent_count (key) VALUES ($1)"
 	CreateCountrySQL   service.CreateSQL[*Event] = "INSERT INTO country_count (key) VALUES ($1)"
 )
+
+var deleteCountersSQLs = []string{
+	"DELETE FROM total_count WHERE key = ANY($1)",
+	"DELETE FROM daily_count WHERE key = ANY($1)",
+	"DELETE FROM hourly_count WHERE key = ANY($1)",
+	"DELETE FROM useragent_count WHERE key = ANY($1)",
+	"DELETE FROM country_count WHERE key = ANY($1)",
+}
+
+// CreateCounters creates the zeroed counter rows for the given key as a part of the transaction.
+func CreateCounters(ctx context.Context, tx pgx.Tx, key string) (int, error) {
+	e := Event{Key: key}
+	for _, sql := range []service.CreateSQL[*Event]{CreateTotalSQL, CreateDailySQL, CreateHourlySQL, CreateUserAgentSQL, CreateCountrySQL} {
+		if status, _, err := service.CreateRecordInTx(ctx, tx, sql, &e, 0); err != nil {
+			return status, err
+		}
+	}
+	return http.StatusCreated, nil
+}
+
+var SeedTotalSQL = "UPDATE total_count SET total = $2 WHERE key = $1"
+
+// SeedTotal sets the total count of the given key, e.g. to keep the history of a link imported from another shortener.
+func SeedTotal(ctx context.Context, tx pgx.Tx, key string, total int) (int, error) {
+	if _, err := tx.Exec(ctx, SeedTotalSQL, key, total); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("failed to seed total count of %q: %w", key, err)
+	}
+	return http.StatusOK, nil
+}
+
+// DeleteCounters deletes the counter rows of the given keys as a part of the transaction.
+// Missing rows are not an error: links created before counters were transactional may not have all of them.
+func DeleteCounters(ctx context.Context, tx pgx.Tx, keys ...string) (int, error) {
+	for _, sql := range deleteCountersSQLs {
+		if _, err := tx.Exec(ctx, sql, keys); err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("failed to delete counters of %v: %w", keys, err)
+		}
+	}
+	return http.StatusNoContent, nil
+}
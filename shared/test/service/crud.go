@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"testing"
 
 	"github.com/lnk.by/shared/service"
@@ -37,10 +38,11 @@ func Delete[K any, T service.Identifiable[K]](t *testing.T, deleteSQL service.De
 }
 
 func List[K any, T service.Retrievable[K]](t *testing.T, listSQL service.ListSQL[T], offset int, limit int) []T {
-	status, body := service.List(t.Context(), listSQL, nil, offset, limit, func(t T) (T, error) { return t, nil })
+	params := map[string]string{service.OffsetParam: strconv.Itoa(offset), service.LimitParam: strconv.Itoa(limit)}
+	status, body := service.List(t.Context(), listSQL, nil, params, func(t T) (T, error) { return t, nil })
 	assert.Equal(t, http.StatusOK, status)
 
-	return unmarshal[[]T](t, body)
+	return unmarshal[service.Page[T]](t, body).Items
 }
 
 func marshal(t *testing.T, entity any) []byte {
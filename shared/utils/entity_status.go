@@ -6,4 +6,17 @@ const (
 	StatusActive    Status = "active"
 	StatusCancelled Status = "cancelled"
 	StatusDeleted   Status = "deleted"
+	// StatusSuspended is set on short URLs only, when their targets are found harmful; they are not valid in requests.
+	StatusSuspended Status = "suspended"
+	// StatusBanned is set on customers by moderators; banned customers cannot create short URLs.
+	StatusBanned Status = "banned"
 )
+
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusActive, StatusCancelled, StatusDeleted:
+		return true
+	default:
+		return false
+	}
+}
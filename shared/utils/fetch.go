@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublicAddress is returned by the clients of PublicClient for URLs that lead to internal addresses.
+var ErrNotPublicAddress = errors.New("the address is not public")
+
+var notPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this" network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+}
+
+// IsPublicAddress tells whether the address is reachable on the internet: not loopback, private, link-local (like the metadata
+// service of the cloud), multicast or unspecified.
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range notPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicClient returns a client for the URLs given by users (targets, logos): it only connects to public addresses.
+// The address is checked when connecting, after DNS resolution, so neither names nor redirects lead to internal services.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: func(network string, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !IsPublicAddress(addrPort.Addr()) {
+			return fmt.Errorf("%w: %s", ErrNotPublicAddress, addrPort.Addr())
+		}
+		return nil
+	}}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would connect on behalf of the client
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
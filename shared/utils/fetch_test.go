@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946", "::ffff:93.184.216.34"} {
+		assert.True(t, IsPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fd00::1",
+		"0.0.0.0", "0.1.2.3", "::", "100.64.0.1", "224.0.0.1", "255.255.255.255", "::ffff:127.0.0.1",
+	} {
+		assert.False(t, IsPublicAddress(netip.MustParseAddr(addr)), addr)
+	}
+	assert.False(t, IsPublicAddress(netip.Addr{}))
+}
+
+func TestPublicClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := PublicClient(time.Second).Get(server.URL)
+	assert.ErrorIs(t, err, ErrNotPublicAddress)
+	_, err = PublicClient(time.Second).Get("http://localhost:1/")
+	assert.ErrorIs(t, err, ErrNotPublicAddress)
+}
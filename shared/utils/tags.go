@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	MaxTags      = 20
+	MaxTagLength = 32
+)
+
+// NormalizeTag trims and lowercases the tag, so it can be compared with the normalized ones.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// NormalizeTags trims and lowercases the tags, drops blank and repeated ones and sorts the rest.
+// It never returns nil, so the tags are stored as an empty array rather than NULL.
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		switch {
+		case tag == "":
+			continue
+		case len([]rune(tag)) > MaxTagLength:
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		case strings.ContainsFunc(tag, unicode.IsControl):
+			return nil, fmt.Errorf("tag %q contains control characters", tag)
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed, got %d", MaxTags, len(normalized))
+	}
+	return normalized, nil
+}
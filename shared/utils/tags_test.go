@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := NormalizeTags(nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, tags)
+	assert.Empty(t, tags)
+
+	tags, err = NormalizeTags([]string{" Summer ", "sale", "", "SALE", "  "})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sale", "summer"}, tags)
+
+	_, err = NormalizeTags([]string{strings.Repeat("x", MaxTagLength+1)})
+	assert.Error(t, err)
+
+	_, err = NormalizeTags([]string{"new\nline"})
+	assert.Error(t, err)
+
+	many := make([]string, MaxTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("x", i+1)
+	}
+	_, err = NormalizeTags(many)
+	assert.Error(t, err)
+	_, err = NormalizeTags(many[:MaxTags])
+	assert.NoError(t, err)
+}
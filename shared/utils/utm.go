@@ -0,0 +1,30 @@
+package utils
+
+// UTM holds the defaults of the utm_* parameters added to the target of a short URL.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Params returns the non-empty values keyed by their query parameter names.
+func (u *UTM) Params() map[string]string {
+	params := map[string]string{}
+	if u == nil {
+		return params
+	}
+	for name, value := range map[string]string{
+		"utm_source":   u.Source,
+		"utm_medium":   u.Medium,
+		"utm_campaign": u.Campaign,
+		"utm_term":     u.Term,
+		"utm_content":  u.Content,
+	} {
+		if value != "" {
+			params[name] = value
+		}
+	}
+	return params
+}